@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 	"gorm.io/driver/mysql"
@@ -21,6 +22,32 @@ type Config struct {
 	JWTSecret  string
 	ServerPort string
 	CORSOrigin string
+
+	// WebSocket 事件保留時數（斷線重連補發用）
+	EventRetentionHours int
+
+	// WebSocket 心跳設定
+	WSPingIntervalSeconds int
+	WSPongTimeoutSeconds  int
+	WSWriteTimeoutSeconds int
+	WSMaxMessageBytes     int
+
+	// 連線閒置多久後自動顯示為 away（分鐘）
+	PresenceIdleMinutes int
+
+	// 訊息發送後可編輯的時間（分鐘），0 表示不限制
+	MessageEditWindowMinutes int
+
+	// 訊息發送後可收回的時間（分鐘），0 表示不限制
+	MessageRecallWindowMinutes int
+
+	// 訊息搜尋索引：mysql（FULLTEXT 索引）或 memory（行程內倒排索引，單機與測試用）
+	SearchIndex string
+
+	// 多實例部署設定（REDIS_ADDR 為空時僅在單一實例內推送）
+	RedisAddr     string
+	RedisPassword string
+	InstanceID    string
 }
 
 // DB 全域資料庫連接
@@ -45,6 +72,24 @@ func LoadConfig() *Config {
 		JWTSecret:  getEnv("JWT_SECRET", "default-secret-key"),
 		ServerPort: getEnv("SERVER_PORT", "8080"),
 		CORSOrigin: getEnv("CORS_ORIGIN", "http://localhost:5173"),
+
+		EventRetentionHours: getEnvInt("EVENT_RETENTION_HOURS", 72),
+
+		WSPingIntervalSeconds: getEnvInt("WS_PING_INTERVAL_SECONDS", 54),
+		WSPongTimeoutSeconds:  getEnvInt("WS_PONG_TIMEOUT_SECONDS", 60),
+		WSWriteTimeoutSeconds: getEnvInt("WS_WRITE_TIMEOUT_SECONDS", 10),
+		WSMaxMessageBytes:     getEnvInt("WS_MAX_MESSAGE_BYTES", 64*1024),
+
+		PresenceIdleMinutes: getEnvInt("PRESENCE_IDLE_MINUTES", 5),
+
+		MessageEditWindowMinutes:   getEnvInt("MESSAGE_EDIT_WINDOW_MINUTES", 15),
+		MessageRecallWindowMinutes: getEnvInt("MESSAGE_RECALL_WINDOW_MINUTES", 2),
+
+		SearchIndex: getEnv("SEARCH_INDEX", "mysql"),
+
+		RedisAddr:     os.Getenv("REDIS_ADDR"),
+		RedisPassword: os.Getenv("REDIS_PASSWORD"),
+		InstanceID:    os.Getenv("INSTANCE_ID"),
 	}
 
 	return AppConfig
@@ -86,3 +131,17 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvInt 取得整數環境變數，如果不存在或格式錯誤則返回預設值
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("警告: 環境變數 %s 格式錯誤，使用預設值 %d", key, defaultValue)
+		return defaultValue
+	}
+	return n
+}
@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"gin-project/config"
 	"gin-project/middleware"
 	"gin-project/models"
+	"gin-project/services"
 	"gin-project/utils"
 	"io"
 	"os"
@@ -14,83 +16,81 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // SendMessageInput 發送訊息輸入
 type SendMessageInput struct {
-	ReceiverID  uint   `json:"receiver_id" binding:"required"`
-	Content     string `json:"content" binding:"required"`
-	MessageType string `json:"message_type"`
-	FileURL     string `json:"file_url"`
-	FileName    string `json:"file_name"`
-	FileSize    int64  `json:"file_size"`
+	ReceiverID   uint           `json:"receiver_id"` // 私訊接收者
+	RoomID       uint           `json:"room_id"`     // 群組聊天室（與 receiver_id 擇一）
+	Content      string         `json:"content"`     // 投票、位置與名片訊息可省略，由伺服器產生內容
+	MessageType  string         `json:"message_type"`
+	FileURL      string         `json:"file_url"`
+	FileName     string         `json:"file_name"`
+	FileSize     int64          `json:"file_size"`
+	ClientMsgID  string         `json:"client_msg_id"`  // 客戶端產生的冪等鍵，重送時不會重複建立訊息
+	ReplyToID    uint           `json:"reply_to_id"`    // 回覆的訊息
+	ThreadRootID uint           `json:"thread_root_id"` // 發送到討論串
+	Poll         *PollInput     `json:"poll"`           // 投票內容（message_type 為 poll 時必填）
+	Location     *LocationInput `json:"location"`       // 位置內容（message_type 為 location 時必填）
+	Contact      *ContactInput  `json:"contact"`        // 名片內容（message_type 為 contact 時必填）
 }
 
 // SendMessage 發送訊息
-func SendMessage(c *gin.Context) {
-	userID := middleware.GetUserID(c)
-
-	var input SendMessageInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		utils.BadRequest(c, "請求資料格式錯誤")
-		return
-	}
-
-	// 設定預設訊息類型
-	if input.MessageType == "" {
-		input.MessageType = "text"
-	}
+func SendMessage(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+
+		var input SendMessageInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
 
-	// 驗證訊息類型
-	if input.MessageType != "text" && input.MessageType != "image" && input.MessageType != "video" && input.MessageType != "file" {
-		utils.BadRequest(c, "無效的訊息類型")
-		return
-	}
+		message, duplicate, err := services.SaveMessageToDB(services.SendMessageParams{
+			SenderID:     userID,
+			ReceiverID:   input.ReceiverID,
+			RoomID:       input.RoomID,
+			Content:      input.Content,
+			MessageType:  input.MessageType,
+			FileURL:      input.FileURL,
+			FileName:     input.FileName,
+			FileSize:     input.FileSize,
+			ClientMsgID:  input.ClientMsgID,
+			ReplyToID:    input.ReplyToID,
+			ThreadRootID: input.ThreadRootID,
+			Poll:         input.Poll.params(),
+			Location:     input.Location.payload(),
+			Contact:      input.Contact.payload(),
+		})
+		if err != nil {
+			respondSendError(c, err)
+			return
+		}
 
-	// 驗證接收者存在
-	var receiver models.User
-	if err := config.DB.First(&receiver, input.ReceiverID).Error; err != nil {
-		utils.NotFound(c, "接收者不存在")
-		return
-	}
+		// 透過 WebSocket 推送給接收者與發送者的其他裝置，並回報 ack / delivered
+		hub.DispatchChatMessage(message, duplicate)
 
-	// 不能發訊息給自己
-	if receiver.ID == userID {
-		utils.BadRequest(c, "不能發訊息給自己")
-		return
-	}
-
-	// 檢查是否為好友
-	var friendship models.Friendship
-	if err := config.DB.Where(
-		"((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)) AND status = ?",
-		userID, receiver.ID, receiver.ID, userID, models.FriendshipStatusAccepted,
-	).First(&friendship).Error; err != nil {
-		utils.Forbidden(c, "只能發訊息給好友")
-		return
-	}
-
-	// 建立訊息
-	message := models.Message{
-		SenderID:    userID,
-		ReceiverID:  input.ReceiverID,
-		Content:     input.Content,
-		MessageType: input.MessageType,
-		FileURL:     input.FileURL,
-		FileName:    input.FileName,
-		FileSize:    input.FileSize,
-		IsRead:      false,
+		utils.SuccessWithData(c, services.MessageResponseFor(message, userID))
 	}
+}
 
-	if err := config.DB.Create(&message).Error; err != nil {
+// respondSendError 將發送訊息的錯誤轉換為對應的 HTTP 響應
+func respondSendError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidMessageType), errors.Is(err, services.ErrEmptyContent), errors.Is(err, services.ErrSendToSelf),
+		errors.Is(err, services.ErrInvalidClientMsgID), errors.Is(err, services.ErrReservedClientMsgID), errors.Is(err, services.ErrMissingTarget),
+		errors.Is(err, services.ErrInvalidReplyTo), errors.Is(err, services.ErrInvalidThreadRoot), errors.Is(err, services.ErrInvalidFileURL),
+		errors.Is(err, services.ErrInvalidPoll), errors.Is(err, services.ErrInvalidPollCloseTime),
+		errors.Is(err, services.ErrInvalidLocation), errors.Is(err, services.ErrInvalidLiveLocation), errors.Is(err, services.ErrInvalidContact):
+		utils.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrReceiverNotFound), errors.Is(err, services.ErrRoomNotFound), errors.Is(err, services.ErrContactNotFound):
+		utils.NotFound(c, err.Error())
+	case errors.Is(err, services.ErrNotFriend), errors.Is(err, services.ErrNotRoomMember), errors.Is(err, services.ErrMemberMuted):
+		utils.Forbidden(c, err.Error())
+	default:
 		utils.InternalError(c, "發送訊息失敗")
-		return
 	}
-
-	// 載入發送者資訊
-	config.DB.Preload("Sender").First(&message, message.ID)
-
-	utils.SuccessWithData(c, message.ToResponse())
 }
 
 // GetMessages 取得與特定使用者的聊天記錄
@@ -112,184 +112,115 @@ func GetMessages(c *gin.Context) {
 		return
 	}
 
-	// 取得分頁參數
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
-	if page < 1 {
-		page = 1
-	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 50
+	cursor, ok := parseMessageCursor(c)
+	if !ok {
+		return
 	}
 
-	offset := (page - 1) * pageSize
-
 	// 查詢雙向訊息
-	var messages []models.Message
-	if err := config.DB.
-		Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)",
-			userID, friendID, friendID, userID).
-		Order("created_at DESC").
-		Limit(pageSize).
-		Offset(offset).
-		Preload("Sender").
-		Find(&messages).Error; err != nil {
-		utils.InternalError(c, "取得訊息失敗")
+	page, err := services.PageMessages(func(db *gorm.DB) *gorm.DB {
+		return db.
+			Where("((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))",
+				userID, friendID, friendID, userID).
+			Where("thread_root_id IS NULL").
+			Scopes(services.NotDeletedForUser(userID))
+	}, cursor)
+	if err != nil {
+		respondPageError(c, err)
 		return
 	}
 
-	// 反轉順序（最舊的在前）
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
-	}
+	// 已讀狀態由客戶端透過已讀 API 或 WebSocket read 訊息回報
+	response := messagePageResponse(page, userID)
+	response["read_watermarks"] = services.ConversationWatermarks(userID, uint(friendID), 0)
 
-	// 轉換為響應格式
-	var messagesResponse []models.MessageResponse
-	for _, message := range messages {
-		messagesResponse = append(messagesResponse, message.ToResponse())
-	}
-
-	// 標記收到的訊息為已讀
-	go func() {
-		config.DB.Model(&models.Message{}).
-			Where("sender_id = ? AND receiver_id = ? AND is_read = ?", friendID, userID, false).
-			Update("is_read", true)
-	}()
-
-	utils.SuccessWithData(c, gin.H{
-		"messages":  messagesResponse,
-		"page":      page,
-		"page_size": pageSize,
-	})
+	utils.SuccessWithData(c, response)
 }
 
-// MarkAsRead 標記訊息為已讀
-func MarkAsRead(c *gin.Context) {
-	userID := middleware.GetUserID(c)
-	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
-	if err != nil {
-		utils.BadRequest(c, "無效的訊息 ID")
-		return
+// parseMessageCursor 解析分頁游標（before、after、around 擇一）與 limit，失敗時已回應錯誤
+func parseMessageCursor(c *gin.Context) (services.MessageCursor, bool) {
+	var cursor services.MessageCursor
+	var ok bool
+	if cursor.Before, ok = parseOptionalID(c, "before"); !ok {
+		return cursor, false
+	}
+	if cursor.After, ok = parseOptionalID(c, "after"); !ok {
+		return cursor, false
+	}
+	if cursor.Around, ok = parseOptionalID(c, "around"); !ok {
+		return cursor, false
 	}
 
-	var message models.Message
-	if err := config.DB.First(&message, messageID).Error; err != nil {
-		utils.NotFound(c, "訊息不存在")
-		return
+	cursor.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if cursor.Limit < 1 || cursor.Limit > 100 {
+		cursor.Limit = 50
 	}
+	return cursor, true
+}
 
-	// 只有接收者可以標記為已讀
-	if message.ReceiverID != userID {
-		utils.Forbidden(c, "無權限操作此訊息")
-		return
+// messagePageResponse 將訊息分頁轉換為響應格式（含表情回應統計）
+func messagePageResponse(page *services.MessagePage, userID uint) gin.H {
+	messagesResponse := make([]models.MessageResponse, 0, len(page.Messages))
+	for _, message := range page.Messages {
+		messagesResponse = append(messagesResponse, message.ToResponse())
 	}
+	services.AttachReactions(messagesResponse, userID)
+	services.AttachPolls(messagesResponse, userID)
 
-	// 更新已讀狀態
-	message.IsRead = true
-	if err := config.DB.Save(&message).Error; err != nil {
-		utils.InternalError(c, "更新失敗")
-		return
+	return gin.H{
+		"messages":        messagesResponse,
+		"has_more_before": page.HasMoreBefore,
+		"has_more_after":  page.HasMoreAfter,
 	}
+}
 
-	utils.Success(c, "已標記為已讀")
+// respondPageError 將訊息分頁的錯誤轉換為對應的 HTTP 響應
+func respondPageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidMessageCursor):
+		utils.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrCursorNotInChat):
+		utils.NotFound(c, err.Error())
+	default:
+		utils.InternalError(c, "取得訊息失敗")
+	}
 }
 
-// GetUnreadCount 取得未讀訊息數量
+// GetUnreadCount 取得未讀訊息數量（好友私訊與群組聊天室）
 func GetUnreadCount(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
-	// 總未讀數
-	var totalUnread int64
-	config.DB.Model(&models.Message{}).
-		Where("receiver_id = ? AND is_read = ?", userID, false).
-		Count(&totalUnread)
-
-	// 每個好友的未讀數
-	type UnreadCount struct {
-		SenderID uint  `json:"sender_id"`
-		Count    int64 `json:"count"`
-	}
-
-	var unreadCounts []UnreadCount
-	config.DB.Model(&models.Message{}).
-		Select("sender_id, COUNT(*) as count").
-		Where("receiver_id = ? AND is_read = ?", userID, false).
-		Group("sender_id").
-		Scan(&unreadCounts)
-
-	// 取得發送者資訊
-	var unreadDetails []gin.H
-	for _, uc := range unreadCounts {
-		var sender models.User
-		if err := config.DB.First(&sender, uc.SenderID).Error; err == nil {
-			unreadDetails = append(unreadDetails, gin.H{
-				"sender": sender.ToResponse(),
-				"count":  uc.Count,
-			})
-		}
+	summary, err := services.GetUnreadSummary(userID)
+	if err != nil {
+		utils.InternalError(c, "取得未讀數失敗")
+		return
 	}
 
-	utils.SuccessWithData(c, gin.H{
-		"total":   totalUnread,
-		"details": unreadDetails,
-	})
+	utils.SuccessWithData(c, summary)
 }
 
-// GetRecentChats 取得最近聊天列表
+// GetRecentChats 取得最近聊天列表（好友私訊與群組聊天室）
+// 查詢參數：archived=true 列出封存的對話、cursor 為上一頁的 next_cursor、limit 每頁筆數
 func GetRecentChats(c *gin.Context) {
 	userID := middleware.GetUserID(c)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 
-	// 子查詢：找出與每個使用者的最後一條訊息
-	type RecentChat struct {
-		FriendID        uint      `json:"friend_id"`
-		LastMessage     string    `json:"last_message"`
-		LastMessageAt   time.Time `json:"last_message_at"`
-		UnreadCount     int64     `json:"unread_count"`
-		LastMessageType string    `json:"last_message_type"`
-	}
-
-	var recentChats []RecentChat
-
-	// 使用原生 SQL 查詢最近聊天
-	config.DB.Raw(`
-		SELECT 
-			CASE 
-				WHEN sender_id = ? THEN receiver_id 
-				ELSE sender_id 
-			END as friend_id,
-			content as last_message,
-			message_type as last_message_type,
-			created_at as last_message_at,
-			(SELECT COUNT(*) FROM messages m2 
-			 WHERE m2.sender_id = friend_id AND m2.receiver_id = ? AND m2.is_read = false) as unread_count
-		FROM messages m1
-		WHERE (sender_id = ? OR receiver_id = ?)
-		AND created_at = (
-			SELECT MAX(created_at) 
-			FROM messages m3 
-			WHERE (m3.sender_id = m1.sender_id AND m3.receiver_id = m1.receiver_id)
-			   OR (m3.sender_id = m1.receiver_id AND m3.receiver_id = m1.sender_id)
-		)
-		ORDER BY last_message_at DESC
-		LIMIT 20
-	`, userID, userID, userID, userID).Scan(&recentChats)
-
-	// 載入好友資訊
-	var chatsWithUser []gin.H
-	for _, chat := range recentChats {
-		var friend models.User
-		if err := config.DB.First(&friend, chat.FriendID).Error; err == nil {
-			chatsWithUser = append(chatsWithUser, gin.H{
-				"friend":            friend.ToResponse(),
-				"last_message":      chat.LastMessage,
-				"last_message_type": chat.LastMessageType,
-				"last_message_at":   chat.LastMessageAt,
-				"unread_count":      chat.UnreadCount,
-			})
+	page, err := services.ListRecentConversations(services.RecentConversationParams{
+		UserID:   userID,
+		Archived: c.Query("archived") == "true",
+		Cursor:   c.Query("cursor"),
+		Limit:    limit,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidChatCursor) {
+			utils.BadRequest(c, err.Error())
+			return
 		}
+		utils.InternalError(c, "取得最近聊天失敗")
+		return
 	}
 
-	utils.SuccessWithData(c, chatsWithUser)
+	utils.SuccessWithData(c, page)
 }
 
 // UploadFile 上傳檔案
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"errors"
+	"gin-project/middleware"
+	"gin-project/services"
+	"gin-project/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateConversationInput 更新對話設定輸入（省略的欄位不變更）
+type UpdateConversationInput struct {
+	MuteSeconds  *int64  `json:"mute_seconds"` // 0 取消靜音，-1 永久靜音
+	Pinned       *bool   `json:"pinned"`
+	Archived     *bool   `json:"archived"`
+	MarkedUnread *bool   `json:"marked_unread"`
+	Draft        *string `json:"draft"`
+}
+
+// GetChatConversation 取得與好友對話的個人設定
+func GetChatConversation(c *gin.Context) {
+	friendID, ok := parseFriendID(c)
+	if !ok {
+		return
+	}
+	getConversation(c, friendID, 0)
+}
+
+// GetRoomConversation 取得聊天室對話的個人設定
+func GetRoomConversation(c *gin.Context) {
+	roomID, ok := parseRoomID(c)
+	if !ok {
+		return
+	}
+	getConversation(c, 0, roomID)
+}
+
+// UpdateChatConversation 更新與好友對話的個人設定
+func UpdateChatConversation(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		friendID, ok := parseFriendID(c)
+		if !ok {
+			return
+		}
+		updateConversation(c, hub, friendID, 0)
+	}
+}
+
+// UpdateRoomConversation 更新聊天室對話的個人設定
+func UpdateRoomConversation(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID, ok := parseRoomID(c)
+		if !ok {
+			return
+		}
+		updateConversation(c, hub, 0, roomID)
+	}
+}
+
+// getConversation 取得對話設定
+func getConversation(c *gin.Context, peerID, roomID uint) {
+	conversation, err := services.GetConversation(middleware.GetUserID(c), peerID, roomID)
+	if err != nil {
+		respondConversationError(c, err, "取得對話設定失敗")
+		return
+	}
+
+	utils.SuccessWithData(c, conversation.ToResponse(time.Now()))
+}
+
+// updateConversation 更新對話設定並同步到自己的其他裝置
+func updateConversation(c *gin.Context, hub *services.Hub, peerID, roomID uint) {
+	userID := middleware.GetUserID(c)
+
+	var input UpdateConversationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.BadRequest(c, "請求資料格式錯誤")
+		return
+	}
+
+	conversation, err := services.UpdateConversation(services.UpdateConversationParams{
+		UserID:       userID,
+		PeerID:       peerID,
+		RoomID:       roomID,
+		MuteSeconds:  input.MuteSeconds,
+		Pinned:       input.Pinned,
+		Archived:     input.Archived,
+		MarkedUnread: input.MarkedUnread,
+		Draft:        input.Draft,
+	})
+	if err != nil {
+		respondConversationError(c, err, "更新對話設定失敗")
+		return
+	}
+
+	response := conversation.ToResponse(time.Now())
+	hub.PushConversationUpdated(userID, response)
+
+	utils.SuccessWithData(c, response)
+}
+
+// parseFriendID 解析路徑中的好友 ID，失敗時已回應錯誤
+func parseFriendID(c *gin.Context) (uint, bool) {
+	friendID, err := strconv.ParseUint(c.Param("friendId"), 10, 32)
+	if err != nil {
+		utils.BadRequest(c, "無效的好友 ID")
+		return 0, false
+	}
+	return uint(friendID), true
+}
+
+// respondConversationError 將對話設定的錯誤轉換為對應的 HTTP 響應
+func respondConversationError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrConversationTarget), errors.Is(err, services.ErrInvalidMuteSetting),
+		errors.Is(err, services.ErrDraftTooLong):
+		utils.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrNotFriend), errors.Is(err, services.ErrNotRoomMember):
+		utils.Forbidden(c, err.Error())
+	default:
+		utils.InternalError(c, fallback)
+	}
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin-project/middleware"
+	"gin-project/models"
+	"gin-project/services"
+	"gin-project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetDisappearingTimerInput 設定訊息自動銷毀輸入
+type SetDisappearingTimerInput struct {
+	Seconds *int   `json:"seconds" binding:"required"` // 0 表示關閉
+	Mode    string `json:"mode"`                       // after_read（預設）或 after_send
+}
+
+// GetChatDisappearingTimer 取得與好友對話的訊息自動銷毀設定
+func GetChatDisappearingTimer(c *gin.Context) {
+	friendID, ok := parseFriendID(c)
+	if !ok {
+		return
+	}
+	getDisappearingTimer(c, friendID, 0)
+}
+
+// GetRoomDisappearingTimer 取得聊天室的訊息自動銷毀設定
+func GetRoomDisappearingTimer(c *gin.Context) {
+	roomID, ok := parseRoomID(c)
+	if !ok {
+		return
+	}
+	getDisappearingTimer(c, 0, roomID)
+}
+
+// UpdateChatDisappearingTimer 設定與好友對話的訊息自動銷毀（雙方皆可設定）
+func UpdateChatDisappearingTimer(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		friendID, ok := parseFriendID(c)
+		if !ok {
+			return
+		}
+		updateDisappearingTimer(c, hub, friendID, 0)
+	}
+}
+
+// UpdateRoomDisappearingTimer 設定聊天室的訊息自動銷毀（管理員以上）
+func UpdateRoomDisappearingTimer(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID, ok := parseRoomID(c)
+		if !ok {
+			return
+		}
+		updateDisappearingTimer(c, hub, 0, roomID)
+	}
+}
+
+// getDisappearingTimer 取得對話的自動銷毀設定
+func getDisappearingTimer(c *gin.Context, peerID, roomID uint) {
+	userID := middleware.GetUserID(c)
+
+	timer, err := services.GetDisappearingTimer(userID, peerID, roomID)
+	if err != nil {
+		respondDisappearingError(c, err, "取得自動銷毀設定失敗")
+		return
+	}
+
+	utils.SuccessWithData(c, timer.ToResponse(userID))
+}
+
+// updateDisappearingTimer 設定對話的自動銷毀，有變動時通知所有參與者
+func updateDisappearingTimer(c *gin.Context, hub *services.Hub, peerID, roomID uint) {
+	userID := middleware.GetUserID(c)
+
+	var input SetDisappearingTimerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.BadRequest(c, "請求資料格式錯誤")
+		return
+	}
+
+	timer, changed, err := services.SetDisappearingTimer(services.SetDisappearingTimerParams{
+		UserID:  userID,
+		PeerID:  peerID,
+		RoomID:  roomID,
+		Seconds: *input.Seconds,
+		Mode:    input.Mode,
+	})
+	if err != nil {
+		respondDisappearingError(c, err, "設定自動銷毀失敗")
+		return
+	}
+
+	if changed {
+		hub.PushDisappearingTimer(userID, timer)
+		if roomID != 0 {
+			content := fmt.Sprintf("%s 關閉了訊息自動銷毀", services.RoomDisplayName(userID))
+			if timer.Enabled() {
+				content = fmt.Sprintf("%s 將訊息設為%s %s後自動銷毀", services.RoomDisplayName(userID),
+					disappearModeLabel(timer.Mode), services.FormatDisappearDuration(timer.Seconds))
+			}
+			hub.PostSystemMessage(roomID, userID, content)
+		}
+	}
+
+	utils.SuccessWithData(c, timer.ToResponse(userID))
+}
+
+// disappearModeLabel 系統訊息中顯示的計時方式
+func disappearModeLabel(mode string) string {
+	if mode == models.DisappearAfterSend {
+		return "發送"
+	}
+	return "讀取"
+}
+
+// respondDisappearingError 將自動銷毀設定的錯誤轉換為對應的 HTTP 響應
+func respondDisappearingError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidDisappearTimer), errors.Is(err, services.ErrInvalidDisappearMode),
+		errors.Is(err, services.ErrConversationTarget):
+		utils.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrRoomNotFound):
+		utils.NotFound(c, err.Error())
+	case errors.Is(err, services.ErrNotFriend), errors.Is(err, services.ErrNotRoomMember),
+		errors.Is(err, services.ErrRoomPermissionDenied):
+		utils.Forbidden(c, err.Error())
+	default:
+		utils.InternalError(c, fallback)
+	}
+}
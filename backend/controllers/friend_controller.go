@@ -36,73 +36,78 @@ func SendFriendRequest(hub *services.Hub) gin.HandlerFunc {
 			return
 		}
 
-		// 不能加自己為好友
-		if friend.ID == userID {
-			utils.BadRequest(c, "不能加自己為好友")
-			return
-		}
+		sendFriendRequest(c, hub, userID, &friend)
+	}
+}
 
-		// 檢查是否已經是好友或已有請求（包含已刪除的記錄）
-		var existingFriendship models.Friendship
-		err := config.DB.Unscoped().Where(
-			"(user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)",
-			userID, friend.ID, friend.ID, userID,
-		).First(&existingFriendship).Error
-
-		if err == nil {
-			// 已存在記錄
-			if existingFriendship.DeletedAt.Valid {
-				// 如果是已刪除的記錄（被拒絕），恢復並更新為 pending
-				existingFriendship.DeletedAt = gorm.DeletedAt{}
-				existingFriendship.Status = models.FriendshipStatusPending
-				existingFriendship.UserID = userID
-				existingFriendship.FriendID = friend.ID
-				if err := config.DB.Unscoped().Save(&existingFriendship).Error; err != nil {
-					utils.InternalError(c, "發送好友請求失敗")
-					return
-				}
-			} else if existingFriendship.Status == models.FriendshipStatusAccepted {
-				utils.BadRequest(c, "已經是好友了")
-				return
-			} else {
-				utils.BadRequest(c, "好友請求已存在")
-				return
-			}
-		} else {
-			// 不存在記錄，建立新的好友請求
-			existingFriendship = models.Friendship{
-				UserID:   userID,
-				FriendID: friend.ID,
-				Status:   models.FriendshipStatusPending,
-			}
+// sendFriendRequest 向指定使用者發送好友請求並通知對方
+func sendFriendRequest(c *gin.Context, hub *services.Hub, userID uint, friend *models.User) {
+	// 不能加自己為好友
+	if friend.ID == userID {
+		utils.BadRequest(c, "不能加自己為好友")
+		return
+	}
 
-			if err := config.DB.Create(&existingFriendship).Error; err != nil {
+	// 檢查是否已經是好友或已有請求（包含已刪除的記錄）
+	var existingFriendship models.Friendship
+	err := config.DB.Unscoped().Where(
+		"(user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)",
+		userID, friend.ID, friend.ID, userID,
+	).First(&existingFriendship).Error
+
+	if err == nil {
+		// 已存在記錄
+		if existingFriendship.DeletedAt.Valid {
+			// 如果是已刪除的記錄（被拒絕），恢復並更新為 pending
+			existingFriendship.DeletedAt = gorm.DeletedAt{}
+			existingFriendship.Status = models.FriendshipStatusPending
+			existingFriendship.UserID = userID
+			existingFriendship.FriendID = friend.ID
+			if err := config.DB.Unscoped().Save(&existingFriendship).Error; err != nil {
 				utils.InternalError(c, "發送好友請求失敗")
 				return
 			}
+		} else if existingFriendship.Status == models.FriendshipStatusAccepted {
+			utils.BadRequest(c, "已經是好友了")
+			return
+		} else {
+			utils.BadRequest(c, "好友請求已存在")
+			return
+		}
+	} else {
+		// 不存在記錄，建立新的好友請求
+		existingFriendship = models.Friendship{
+			UserID:   userID,
+			FriendID: friend.ID,
+			Status:   models.FriendshipStatusPending,
 		}
 
-		// 載入發送者資訊
-		var sender models.User
-		if err := config.DB.First(&sender, userID).Error; err == nil {
-			// 透過 WebSocket 通知接收者有新的好友請求（失敗不影響主流程）
-			hub.SendToUser(friend.ID, &services.Message{
-				Type:       "friend_request",
-				SenderID:   userID,
-				ReceiverID: friend.ID,
-				Timestamp:  time.Now().Format(time.RFC3339),
-				Data: map[string]interface{}{
-					"request_id": existingFriendship.ID,
-					"user":       sender.ToResponse(),
-				},
-			})
+		if err := config.DB.Create(&existingFriendship).Error; err != nil {
+			utils.InternalError(c, "發送好友請求失敗")
+			return
 		}
+	}
 
-		utils.SuccessWithData(c, gin.H{
-			"message": "好友請求已發送",
-			"friend":  friend.ToResponse(),
+	// 載入發送者資訊
+	var sender models.User
+	if err := config.DB.First(&sender, userID).Error; err == nil {
+		// 透過 WebSocket 通知接收者有新的好友請求（失敗不影響主流程）
+		hub.SendToUser(friend.ID, &services.Message{
+			Type:       "friend_request",
+			SenderID:   userID,
+			ReceiverID: friend.ID,
+			Timestamp:  time.Now().Format(time.RFC3339),
+			Data: map[string]interface{}{
+				"request_id": existingFriendship.ID,
+				"user":       sender.ToResponse(),
+			},
 		})
 	}
+
+	utils.SuccessWithData(c, gin.H{
+		"message": "好友請求已發送",
+		"friend":  friend.ToResponse(),
+	})
 }
 
 // GetFriendRequests 取得收到的好友請求
@@ -266,41 +271,43 @@ func RejectFriendRequest(hub *services.Hub) gin.HandlerFunc {
 	}
 }
 
-// GetFriends 取得好友列表
-func GetFriends(c *gin.Context) {
-	userID := middleware.GetUserID(c)
+// GetFriends 取得好友列表（含在線狀態與最後上線時間）
+func GetFriends(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
 
-	var friendships []models.Friendship
-	// 查找所有已接受的好友關係（雙向）
-	if err := config.DB.
-		Where("(user_id = ? OR friend_id = ?) AND status = ?",
-			userID, userID, models.FriendshipStatusAccepted).
-		Preload("User").
-		Preload("Friend").
-		Find(&friendships).Error; err != nil {
-		utils.InternalError(c, "取得好友列表失敗")
-		return
-	}
+		var friendships []models.Friendship
+		// 查找所有已接受的好友關係（雙向）
+		if err := config.DB.
+			Where("(user_id = ? OR friend_id = ?) AND status = ?",
+				userID, userID, models.FriendshipStatusAccepted).
+			Preload("User").
+			Preload("Friend").
+			Find(&friendships).Error; err != nil {
+			utils.InternalError(c, "取得好友列表失敗")
+			return
+		}
 
-	// 整理好友列表
-	friendsMap := make(map[uint]models.UserResponse)
-	for _, friendship := range friendships {
-		if friendship.UserID == userID {
-			// 我是發起者，對方是 Friend
-			friendsMap[friendship.FriendID] = friendship.Friend.ToResponse()
-		} else {
-			// 對方是發起者，我是 Friend
-			friendsMap[friendship.UserID] = friendship.User.ToResponse()
+		// 整理好友列表
+		friendsMap := make(map[uint]models.FriendPresenceResponse)
+		for _, friendship := range friendships {
+			if friendship.UserID == userID {
+				// 我是發起者，對方是 Friend
+				friendsMap[friendship.FriendID] = hub.FriendPresence(&friendship.Friend)
+			} else {
+				// 對方是發起者，我是 Friend
+				friendsMap[friendship.UserID] = hub.FriendPresence(&friendship.User)
+			}
 		}
-	}
 
-	// 轉換為陣列
-	var friends []models.UserResponse
-	for _, friend := range friendsMap {
-		friends = append(friends, friend)
-	}
+		// 轉換為陣列
+		var friends []models.FriendPresenceResponse
+		for _, friend := range friendsMap {
+			friends = append(friends, friend)
+		}
 
-	utils.SuccessWithData(c, friends)
+		utils.SuccessWithData(c, friends)
+	}
 }
 
 // RemoveFriend 刪除好友
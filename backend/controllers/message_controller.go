@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"gin-project/middleware"
+	"gin-project/services"
+	"gin-project/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EditMessageInput 編輯訊息輸入
+type EditMessageInput struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// EditMessage 編輯自己發送的文字訊息
+func EditMessage(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		messageID, ok := parseMessageID(c)
+		if !ok {
+			return
+		}
+
+		var input EditMessageInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		message, err := services.EditMessage(messageID, userID, input.Content)
+		if err != nil {
+			respondMessageError(c, err, "編輯訊息失敗")
+			return
+		}
+
+		// 推送給對話另一方（群組為所有成員）與自己的其他裝置
+		response := message.ToResponse()
+		hub.PushMessageEvent("message_edited", userID, message, response)
+
+		utils.SuccessWithData(c, response)
+	}
+}
+
+// GetMessageEdits 取得訊息的編輯歷史
+func GetMessageEdits(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	messageID, ok := parseMessageID(c)
+	if !ok {
+		return
+	}
+
+	edits, err := services.GetMessageEdits(messageID, userID)
+	if err != nil {
+		respondMessageError(c, err, "取得編輯歷史失敗")
+		return
+	}
+
+	utils.SuccessWithData(c, edits)
+}
+
+// DeleteMessageForMe 刪除訊息（僅對自己隱藏，對方仍看得到）
+func DeleteMessageForMe(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	messageID, ok := parseMessageID(c)
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteMessageForUser(messageID, userID); err != nil {
+		respondMessageError(c, err, "刪除訊息失敗")
+		return
+	}
+
+	utils.Success(c, "已刪除訊息")
+}
+
+// RecallMessage 收回訊息（所有參與者都會看到已收回）
+func RecallMessage(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		messageID, ok := parseMessageID(c)
+		if !ok {
+			return
+		}
+
+		message, err := services.RecallMessage(messageID, userID)
+		if err != nil {
+			respondMessageError(c, err, "收回訊息失敗")
+			return
+		}
+
+		response := message.ToResponse()
+		hub.PushMessageEvent("message_recalled", userID, message, response)
+
+		utils.SuccessWithData(c, response)
+	}
+}
+
+// ReactionInput 表情回應輸入
+type ReactionInput struct {
+	Emoji string `json:"emoji" binding:"required"`
+}
+
+// AddReaction 對訊息加上表情回應
+func AddReaction(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		messageID, ok := parseMessageID(c)
+		if !ok {
+			return
+		}
+
+		var input ReactionInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		message, count, err := services.AddReaction(messageID, userID, input.Emoji)
+		if err != nil {
+			respondMessageError(c, err, "回應訊息失敗")
+			return
+		}
+
+		data := gin.H{
+			"message_id": message.ID,
+			"user_id":    userID,
+			"emoji":      input.Emoji,
+			"count":      count,
+		}
+		hub.PushMessageEvent("reaction_added", userID, message, data)
+
+		utils.SuccessWithData(c, data)
+	}
+}
+
+// RemoveReaction 移除自己對訊息的表情回應
+func RemoveReaction(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		messageID, ok := parseMessageID(c)
+		if !ok {
+			return
+		}
+		emoji := c.Param("emoji")
+
+		message, count, err := services.RemoveReaction(messageID, userID, emoji)
+		if err != nil {
+			respondMessageError(c, err, "移除回應失敗")
+			return
+		}
+
+		data := gin.H{
+			"message_id": message.ID,
+			"user_id":    userID,
+			"emoji":      emoji,
+			"count":      count,
+		}
+		hub.PushMessageEvent("reaction_removed", userID, message, data)
+
+		utils.SuccessWithData(c, data)
+	}
+}
+
+// parseMessageID 解析路徑中的訊息 ID，失敗時已回應錯誤
+func parseMessageID(c *gin.Context) (uint, bool) {
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.BadRequest(c, "無效的訊息 ID")
+		return 0, false
+	}
+	return uint(messageID), true
+}
+
+// respondMessageError 將訊息操作的錯誤轉換為對應的 HTTP 響應
+func respondMessageError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrEmptyContent), errors.Is(err, services.ErrMessageNotEditable),
+		errors.Is(err, services.ErrContentUnchanged), errors.Is(err, services.ErrMessageRecalled),
+		errors.Is(err, services.ErrInvalidEmoji):
+		utils.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrMessageNotFound), errors.Is(err, services.ErrReactionNotFound):
+		utils.NotFound(c, err.Error())
+	case errors.Is(err, services.ErrNotMessageSender), errors.Is(err, services.ErrEditWindowExpired),
+		errors.Is(err, services.ErrNotRecallable), errors.Is(err, services.ErrRecallWindowExpired):
+		utils.Forbidden(c, err.Error())
+	default:
+		utils.InternalError(c, fallback)
+	}
+}
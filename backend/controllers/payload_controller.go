@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"errors"
+	"gin-project/middleware"
+	"gin-project/models"
+	"gin-project/services"
+	"gin-project/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LocationInput 位置內容輸入（message_type 為 location 時使用）
+type LocationInput struct {
+	Latitude  *float64   `json:"latitude" binding:"required"`
+	Longitude *float64   `json:"longitude" binding:"required"`
+	Label     string     `json:"label"`      // 地點名稱，同時作為訊息內容
+	LiveUntil *time.Time `json:"live_until"` // RFC3339，提供時為即時位置分享，最長 8 小時
+}
+
+// payload 轉換為位置內容
+func (l *LocationInput) payload() *models.LocationPayload {
+	if l == nil {
+		return nil
+	}
+	return &models.LocationPayload{
+		Latitude:  *l.Latitude,
+		Longitude: *l.Longitude,
+		Label:     l.Label,
+		LiveUntil: l.LiveUntil,
+	}
+}
+
+// ContactInput 名片內容輸入（message_type 為 contact 時使用）
+type ContactInput struct {
+	UserID uint `json:"user_id" binding:"required"` // 分享的使用者（自己或好友）
+}
+
+// payload 轉換為名片內容，名片資料由伺服器填入
+func (i *ContactInput) payload() *models.ContactPayload {
+	if i == nil {
+		return nil
+	}
+	return &models.ContactPayload{UserID: i.UserID}
+}
+
+// StopLiveLocation 提前結束自己的即時位置分享
+func StopLiveLocation(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		messageID, ok := parseMessageID(c)
+		if !ok {
+			return
+		}
+
+		message, location, err := services.StopLiveLocation(messageID, userID, time.Now())
+		if err != nil {
+			respondPayloadError(c, err, "結束位置分享失敗")
+			return
+		}
+		hub.PushLocationUpdated(message, location)
+
+		utils.SuccessWithData(c, location)
+	}
+}
+
+// RequestContactFriend 向名片中分享的使用者發送好友請求
+func RequestContactFriend(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		messageID, ok := parseMessageID(c)
+		if !ok {
+			return
+		}
+
+		contact, err := services.GetSharedContact(messageID, userID)
+		if err != nil {
+			respondPayloadError(c, err, "發送好友請求失敗")
+			return
+		}
+		sendFriendRequest(c, hub, userID, contact)
+	}
+}
+
+// respondPayloadError 將位置與名片訊息的錯誤轉換為對應的 HTTP 響應
+func respondPayloadError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrNotLiveLocation), errors.Is(err, services.ErrLiveLocationEnded),
+		errors.Is(err, services.ErrNotContact):
+		utils.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrMessageNotFound), errors.Is(err, services.ErrContactNotFound):
+		utils.NotFound(c, err.Error())
+	default:
+		utils.InternalError(c, fallback)
+	}
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"errors"
+	"gin-project/middleware"
+	"gin-project/models"
+	"gin-project/services"
+	"gin-project/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PollInput 投票內容輸入（message_type 為 poll 時使用，題目即為訊息內容）
+type PollInput struct {
+	Question       string     `json:"question"`
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	Anonymous      bool       `json:"anonymous"`
+	ClosesAt       *time.Time `json:"closes_at"` // RFC3339，省略表示不截止
+}
+
+// params 轉換為建立投票參數
+func (p *PollInput) params() *services.PollParams {
+	if p == nil {
+		return nil
+	}
+	return &services.PollParams{
+		Question:       p.Question,
+		Options:        p.Options,
+		MultipleChoice: p.MultipleChoice,
+		Anonymous:      p.Anonymous,
+		ClosesAt:       p.ClosesAt,
+	}
+}
+
+// VotePollInput 投票輸入，取代先前的選擇
+type VotePollInput struct {
+	OptionIDs []uint `json:"option_ids" binding:"required"`
+}
+
+// VotePoll 對投票訊息投票
+func VotePoll(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		messageID, ok := parseMessageID(c)
+		if !ok {
+			return
+		}
+
+		var input VotePollInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		message, poll, err := services.VotePoll(messageID, userID, input.OptionIDs, time.Now())
+		if err != nil {
+			respondPollError(c, err, "投票失敗")
+			return
+		}
+		respondPollUpdated(c, hub, userID, message, poll)
+	}
+}
+
+// RetractPollVote 收回自己的投票
+func RetractPollVote(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		messageID, ok := parseMessageID(c)
+		if !ok {
+			return
+		}
+
+		message, poll, err := services.RetractPollVote(messageID, userID, time.Now())
+		if err != nil {
+			respondPollError(c, err, "收回投票失敗")
+			return
+		}
+		respondPollUpdated(c, hub, userID, message, poll)
+	}
+}
+
+// respondPollUpdated 推送最新統計給對話所有參與者，並回傳自己角度的統計
+func respondPollUpdated(c *gin.Context, hub *services.Hub, userID uint, message *models.Message, poll *models.Poll) {
+	hub.PushPollUpdated(userID, message, poll)
+
+	tally, err := services.PollTally(poll, userID)
+	if err != nil {
+		utils.InternalError(c, "取得投票結果失敗")
+		return
+	}
+	utils.SuccessWithData(c, tally)
+}
+
+// respondPollError 將投票的錯誤轉換為對應的 HTTP 響應
+func respondPollError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrNotPoll), errors.Is(err, services.ErrPollClosed),
+		errors.Is(err, services.ErrInvalidPollVote), errors.Is(err, services.ErrMessageRecalled):
+		utils.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrMessageNotFound):
+		utils.NotFound(c, err.Error())
+	default:
+		utils.InternalError(c, fallback)
+	}
+}
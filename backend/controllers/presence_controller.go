@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"errors"
+	"gin-project/middleware"
+	"gin-project/services"
+	"gin-project/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdatePresenceInput 更新在線狀態輸入
+type UpdatePresenceInput struct {
+	Status           string `json:"status" binding:"required"` // online, away, busy, invisible
+	StatusText       string `json:"status_text"`
+	ExpiresInSeconds int64  `json:"expires_in_seconds"` // 狀態有效秒數，0 表示不會到期
+}
+
+// GetMyPresence 取得自己設定的在線狀態
+func GetMyPresence(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	utils.SuccessWithData(c, services.GetUserPresence(userID))
+}
+
+// UpdatePresence 設定在線狀態與自訂狀態文字，並通知好友
+func UpdatePresence(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+
+		var input UpdatePresenceInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		if input.ExpiresInSeconds < 0 {
+			utils.BadRequest(c, "狀態有效秒數不能為負數")
+			return
+		}
+
+		var expiresAt *time.Time
+		if input.ExpiresInSeconds > 0 {
+			t := time.Now().Add(time.Duration(input.ExpiresInSeconds) * time.Second)
+			expiresAt = &t
+		}
+
+		presence, err := services.SetUserPresence(userID, input.Status, input.StatusText, expiresAt)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidPresenceStatus) ||
+				errors.Is(err, services.ErrStatusTextTooLong) ||
+				errors.Is(err, services.ErrInvalidStatusExpiry) {
+				utils.BadRequest(c, err.Error())
+				return
+			}
+			utils.InternalError(c, "更新在線狀態失敗")
+			return
+		}
+
+		// 通知好友狀態變更
+		hub.BroadcastPresence(userID)
+
+		utils.SuccessWithData(c, presence)
+	}
+}
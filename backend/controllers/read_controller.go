@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"errors"
+	"gin-project/middleware"
+	"gin-project/services"
+	"gin-project/utils"
+	"io"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MarkReadInput 標記已讀輸入
+type MarkReadInput struct {
+	MessageID uint `json:"message_id"` // 已讀到的訊息，省略時為對話中最新的訊息
+}
+
+// MarkAsRead 將訊息所在對話的已讀位置前進到此訊息
+func MarkAsRead(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		messageID, ok := parseMessageID(c)
+		if !ok {
+			return
+		}
+
+		message, err := services.GetAccessibleMessage(messageID, userID)
+		if err != nil {
+			respondMessageError(c, err, "更新失敗")
+			return
+		}
+
+		params := services.MarkReadParams{UserID: userID, MessageID: message.ID}
+		switch {
+		case message.IsRoomMessage():
+			params.RoomID = message.GetRoomID()
+		case message.GetReceiverID() == userID:
+			params.PeerID = message.SenderID
+		default:
+			// 只有接收者可以標記為已讀
+			utils.Forbidden(c, "無權限操作此訊息")
+			return
+		}
+
+		markRead(c, hub, params)
+	}
+}
+
+// MarkChatRead 將與好友的私訊已讀位置前進到指定訊息
+func MarkChatRead(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		friendID, ok := parseFriendID(c)
+		if !ok {
+			return
+		}
+
+		var input MarkReadInput
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		markRead(c, hub, services.MarkReadParams{
+			UserID:    middleware.GetUserID(c),
+			PeerID:    friendID,
+			MessageID: input.MessageID,
+		})
+	}
+}
+
+// MarkRoomRead 將聊天室的已讀位置前進到指定訊息
+func MarkRoomRead(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID, ok := parseRoomID(c)
+		if !ok {
+			return
+		}
+
+		var input MarkReadInput
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		markRead(c, hub, services.MarkReadParams{
+			UserID:    middleware.GetUserID(c),
+			RoomID:    roomID,
+			MessageID: input.MessageID,
+		})
+	}
+}
+
+// markRead 前進已讀位置，位置有變動時推送已讀回執
+func markRead(c *gin.Context, hub *services.Hub, params services.MarkReadParams) {
+	receipt, err := services.MarkConversationRead(params)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrReadTargetMissing):
+			utils.BadRequest(c, err.Error())
+		case errors.Is(err, services.ErrMessageNotFound), errors.Is(err, services.ErrNothingToRead):
+			utils.NotFound(c, err.Error())
+		case errors.Is(err, services.ErrNotFriend), errors.Is(err, services.ErrNotRoomMember):
+			utils.Forbidden(c, err.Error())
+		default:
+			utils.InternalError(c, "更新失敗")
+		}
+		return
+	}
+
+	if receipt == nil {
+		utils.SuccessWithData(c, gin.H{"advanced": false})
+		return
+	}
+	hub.PushReadReceipt(receipt)
+
+	utils.SuccessWithData(c, gin.H{
+		"advanced":             true,
+		"last_read_message_id": receipt.LastReadMessageID,
+		"read_at":              receipt.ReadAt,
+	})
+}
+
+// GetMessageReads 取得訊息的已讀狀態（群組為每位成員是否已讀）
+func GetMessageReads(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	messageID, ok := parseMessageID(c)
+	if !ok {
+		return
+	}
+
+	status, err := services.GetMessageReadStatus(messageID, userID)
+	if err != nil {
+		respondMessageError(c, err, "取得已讀狀態失敗")
+		return
+	}
+
+	utils.SuccessWithData(c, status)
+}
@@ -0,0 +1,487 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin-project/middleware"
+	"gin-project/models"
+	"gin-project/services"
+	"gin-project/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateRoomInput 建立聊天室輸入
+type CreateRoomInput struct {
+	Name      string `json:"name" binding:"required"`
+	MemberIDs []uint `json:"member_ids"` // 要加入的好友
+}
+
+// AddRoomMembersInput 邀請成員輸入
+type AddRoomMembersInput struct {
+	UserIDs []uint `json:"user_ids" binding:"required"`
+}
+
+// UpdateRoomInput 修改聊天室輸入
+type UpdateRoomInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// SetRoomRoleInput 設定成員角色輸入
+type SetRoomRoleInput struct {
+	Role string `json:"role" binding:"required"` // admin 或 member
+}
+
+// MuteRoomMemberInput 禁言成員輸入
+type MuteRoomMemberInput struct {
+	DurationSeconds int64 `json:"duration_seconds"` // 0 表示解除禁言
+}
+
+// TransferRoomInput 轉移聊天室輸入
+type TransferRoomInput struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+// SendRoomMessageInput 發送群組訊息輸入
+type SendRoomMessageInput struct {
+	Content      string         `json:"content"` // 投票、位置與名片訊息可省略，由伺服器產生內容
+	MessageType  string         `json:"message_type"`
+	FileURL      string         `json:"file_url"`
+	FileName     string         `json:"file_name"`
+	FileSize     int64          `json:"file_size"`
+	ClientMsgID  string         `json:"client_msg_id"`
+	ReplyToID    uint           `json:"reply_to_id"`
+	ThreadRootID uint           `json:"thread_root_id"`
+	Poll         *PollInput     `json:"poll"`     // 投票內容（message_type 為 poll 時必填）
+	Location     *LocationInput `json:"location"` // 位置內容（message_type 為 location 時必填）
+	Contact      *ContactInput  `json:"contact"`  // 名片內容（message_type 為 contact 時必填）
+}
+
+// CreateRoom 建立群組聊天室
+func CreateRoom(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+
+		var input CreateRoomInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		room, err := services.CreateRoom(userID, input.Name, input.MemberIDs)
+		if err != nil {
+			respondRoomError(c, err, "建立聊天室失敗")
+			return
+		}
+
+		// 通知其他成員已被加入聊天室
+		response := room.ToResponse()
+		var others []uint
+		for _, member := range room.Members {
+			if member.UserID != userID {
+				others = append(others, member.UserID)
+			}
+		}
+		hub.NotifyRoom("room_joined", userID, room.ID, others, response)
+		hub.PostSystemMessage(room.ID, userID, fmt.Sprintf("%s 建立了聊天室「%s」", services.RoomDisplayName(userID), room.Name))
+
+		utils.SuccessWithData(c, response)
+	}
+}
+
+// GetRooms 取得我加入的聊天室
+func GetRooms(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	rooms, err := services.ListUserRooms(userID)
+	if err != nil {
+		utils.InternalError(c, "取得聊天室列表失敗")
+		return
+	}
+
+	roomsResponse := make([]models.ChatRoomResponse, 0, len(rooms))
+	for _, room := range rooms {
+		roomsResponse = append(roomsResponse, room.ToResponse())
+	}
+
+	utils.SuccessWithData(c, roomsResponse)
+}
+
+// GetRoom 取得聊天室資訊
+func GetRoom(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	roomID, ok := parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	room, err := services.GetRoomForMember(roomID, userID)
+	if err != nil {
+		respondRoomError(c, err, "取得聊天室失敗")
+		return
+	}
+
+	utils.SuccessWithData(c, room.ToResponse())
+}
+
+// AddRoomMembers 邀請好友加入聊天室
+func AddRoomMembers(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		roomID, ok := parseRoomID(c)
+		if !ok {
+			return
+		}
+
+		var input AddRoomMembersInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		added, err := services.AddRoomMembers(roomID, userID, input.UserIDs)
+		if err != nil {
+			respondRoomError(c, err, "邀請成員失敗")
+			return
+		}
+
+		room, err := services.GetRoomForMember(roomID, userID)
+		if err != nil {
+			respondRoomError(c, err, "取得聊天室失敗")
+			return
+		}
+		response := room.ToResponse()
+
+		if len(added) > 0 {
+			// 新成員收到完整聊天室資訊，既有成員收到成員異動
+			hub.NotifyRoom("room_joined", userID, roomID, added, response)
+			hub.NotifyRoom("room_members_added", userID, roomID, services.RoomMemberIDs(roomID), gin.H{
+				"room_id":  roomID,
+				"user_ids": added,
+			})
+
+			names := make([]string, 0, len(added))
+			for _, addedID := range added {
+				names = append(names, services.RoomDisplayName(addedID))
+			}
+			hub.PostSystemMessage(roomID, userID, fmt.Sprintf("%s 邀請 %s 加入聊天室",
+				services.RoomDisplayName(userID), strings.Join(names, "、")))
+		}
+
+		utils.SuccessWithData(c, response)
+	}
+}
+
+// RemoveRoomMember 移除聊天室成員（自己退出，或管理員移除成員）
+func RemoveRoomMember(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		roomID, memberID, ok := parseRoomMemberIDs(c)
+		if !ok {
+			return
+		}
+
+		if err := services.RemoveRoomMember(roomID, userID, memberID); err != nil {
+			respondRoomError(c, err, "移除成員失敗")
+			return
+		}
+
+		// 通知剩餘成員與被移除的使用者
+		remaining := services.RoomMemberIDs(roomID)
+		hub.NotifyRoom("room_member_removed", userID, roomID, append(remaining, memberID), gin.H{
+			"room_id": roomID,
+			"user_id": memberID,
+		})
+
+		// 最後一位成員退出後聊天室已刪除，不需再寫入系統訊息
+		if len(remaining) > 0 {
+			if memberID == userID {
+				hub.PostSystemMessage(roomID, userID, fmt.Sprintf("%s 退出了聊天室", services.RoomDisplayName(userID)))
+			} else {
+				hub.PostSystemMessage(roomID, userID, fmt.Sprintf("%s 將 %s 移出聊天室",
+					services.RoomDisplayName(userID), services.RoomDisplayName(memberID)))
+			}
+		}
+
+		utils.Success(c, "已移除成員")
+	}
+}
+
+// UpdateRoom 修改聊天室名稱（擁有者與管理員）
+func UpdateRoom(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		roomID, ok := parseRoomID(c)
+		if !ok {
+			return
+		}
+
+		var input UpdateRoomInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		if err := services.RenameRoom(roomID, userID, input.Name); err != nil {
+			respondRoomError(c, err, "修改聊天室失敗")
+			return
+		}
+
+		room, err := services.GetRoomForMember(roomID, userID)
+		if err != nil {
+			respondRoomError(c, err, "取得聊天室失敗")
+			return
+		}
+		hub.PostSystemMessage(roomID, userID, fmt.Sprintf("%s 將聊天室名稱改為「%s」", services.RoomDisplayName(userID), room.Name))
+
+		utils.SuccessWithData(c, room.ToResponse())
+	}
+}
+
+// SetRoomMemberRole 設定成員為管理員或一般成員（僅擁有者）
+func SetRoomMemberRole(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		roomID, memberID, ok := parseRoomMemberIDs(c)
+		if !ok {
+			return
+		}
+
+		var input SetRoomRoleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		if err := services.SetRoomMemberRole(roomID, userID, memberID, input.Role); err != nil {
+			respondRoomError(c, err, "設定角色失敗")
+			return
+		}
+
+		action := "設為管理員"
+		if input.Role == models.RoomRoleMember {
+			action = "取消管理員"
+		}
+		hub.PostSystemMessage(roomID, userID, fmt.Sprintf("%s 將 %s %s",
+			services.RoomDisplayName(userID), services.RoomDisplayName(memberID), action))
+
+		utils.Success(c, "已設定角色")
+	}
+}
+
+// MuteRoomMember 禁言或解除禁言成員（擁有者與管理員）
+func MuteRoomMember(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		roomID, memberID, ok := parseRoomMemberIDs(c)
+		if !ok {
+			return
+		}
+
+		var input MuteRoomMemberInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		mutedUntil, err := services.MuteRoomMember(roomID, userID, memberID, time.Duration(input.DurationSeconds)*time.Second)
+		if err != nil {
+			respondRoomError(c, err, "禁言失敗")
+			return
+		}
+
+		content := fmt.Sprintf("%s 解除了 %s 的禁言", services.RoomDisplayName(userID), services.RoomDisplayName(memberID))
+		if mutedUntil != nil {
+			content = fmt.Sprintf("%s 將 %s 禁言至 %s", services.RoomDisplayName(userID),
+				services.RoomDisplayName(memberID), mutedUntil.Format("2006-01-02 15:04"))
+		}
+		hub.PostSystemMessage(roomID, userID, content)
+
+		utils.SuccessWithData(c, gin.H{
+			"user_id":     memberID,
+			"muted_until": mutedUntil,
+		})
+	}
+}
+
+// TransferRoom 轉移聊天室擁有者（僅擁有者）
+func TransferRoom(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		roomID, ok := parseRoomID(c)
+		if !ok {
+			return
+		}
+
+		var input TransferRoomInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		if err := services.TransferRoomOwnership(roomID, userID, input.UserID); err != nil {
+			respondRoomError(c, err, "轉移聊天室失敗")
+			return
+		}
+
+		hub.PostSystemMessage(roomID, userID, fmt.Sprintf("%s 將聊天室轉移給 %s",
+			services.RoomDisplayName(userID), services.RoomDisplayName(input.UserID)))
+
+		utils.Success(c, "已轉移聊天室")
+	}
+}
+
+// DeleteRoomMessage 刪除聊天室訊息（自己的訊息，或管理員刪除成員訊息）
+func DeleteRoomMessage(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		roomID, ok := parseRoomID(c)
+		if !ok {
+			return
+		}
+		messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 32)
+		if err != nil {
+			utils.BadRequest(c, "無效的訊息 ID")
+			return
+		}
+
+		message, err := services.DeleteRoomMessage(roomID, userID, uint(messageID))
+		if err != nil {
+			respondRoomError(c, err, "刪除訊息失敗")
+			return
+		}
+
+		hub.NotifyRoom("message_deleted", userID, roomID, services.RoomMemberIDs(roomID), gin.H{
+			"room_id":    roomID,
+			"message_id": message.ID,
+		})
+		if message.SenderID != userID {
+			hub.PostSystemMessage(roomID, userID, fmt.Sprintf("%s 刪除了 %s 的一則訊息",
+				services.RoomDisplayName(userID), services.RoomDisplayName(message.SenderID)))
+		}
+
+		utils.Success(c, "已刪除訊息")
+	}
+}
+
+// SendRoomMessage 發送群組訊息
+func SendRoomMessage(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		roomID, ok := parseRoomID(c)
+		if !ok {
+			return
+		}
+
+		var input SendRoomMessageInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		message, duplicate, err := services.SaveMessageToDB(services.SendMessageParams{
+			SenderID:     userID,
+			RoomID:       roomID,
+			Content:      input.Content,
+			MessageType:  input.MessageType,
+			FileURL:      input.FileURL,
+			FileName:     input.FileName,
+			FileSize:     input.FileSize,
+			ClientMsgID:  input.ClientMsgID,
+			ReplyToID:    input.ReplyToID,
+			ThreadRootID: input.ThreadRootID,
+			Poll:         input.Poll.params(),
+			Location:     input.Location.payload(),
+			Contact:      input.Contact.payload(),
+		})
+		if err != nil {
+			respondSendError(c, err)
+			return
+		}
+
+		// 推送給聊天室所有成員，並回報 ack / delivered
+		hub.DispatchChatMessage(message, duplicate)
+
+		utils.SuccessWithData(c, services.MessageResponseFor(message, userID))
+	}
+}
+
+// GetRoomMessages 取得群組聊天記錄
+func GetRoomMessages(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	roomID, ok := parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	if !services.IsRoomMember(roomID, userID) {
+		utils.Forbidden(c, "只能查看已加入聊天室的聊天記錄")
+		return
+	}
+
+	cursor, ok := parseMessageCursor(c)
+	if !ok {
+		return
+	}
+
+	page, err := services.PageMessages(func(db *gorm.DB) *gorm.DB {
+		return db.
+			Where("room_id = ? AND thread_root_id IS NULL", roomID).
+			Scopes(services.NotDeletedForUser(userID))
+	}, cursor)
+	if err != nil {
+		respondPageError(c, err)
+		return
+	}
+
+	response := messagePageResponse(page, userID)
+	response["read_watermarks"] = services.ConversationWatermarks(userID, 0, roomID)
+
+	utils.SuccessWithData(c, response)
+}
+
+// parseRoomID 解析路徑中的聊天室 ID，失敗時已回應錯誤
+func parseRoomID(c *gin.Context) (uint, bool) {
+	roomID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.BadRequest(c, "無效的聊天室 ID")
+		return 0, false
+	}
+	return uint(roomID), true
+}
+
+// parseRoomMemberIDs 解析路徑中的聊天室 ID 與成員 ID，失敗時已回應錯誤
+func parseRoomMemberIDs(c *gin.Context) (uint, uint, bool) {
+	roomID, ok := parseRoomID(c)
+	if !ok {
+		return 0, 0, false
+	}
+	memberID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		utils.BadRequest(c, "無效的使用者 ID")
+		return 0, 0, false
+	}
+	return roomID, uint(memberID), true
+}
+
+// respondRoomError 將聊天室操作的錯誤轉換為對應的 HTTP 響應
+func respondRoomError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidRoomName), errors.Is(err, services.ErrInvalidRoomRole),
+		errors.Is(err, services.ErrInvalidMuteTime), errors.Is(err, services.ErrTransferToSelf),
+		errors.Is(err, services.ErrOwnerMustTransfer):
+		utils.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrRoomNotFound), errors.Is(err, services.ErrMemberNotInRoom),
+		errors.Is(err, services.ErrMessageNotInRoom):
+		utils.NotFound(c, err.Error())
+	case errors.Is(err, services.ErrNotRoomMember), errors.Is(err, services.ErrMemberNotFriend),
+		errors.Is(err, services.ErrRoomPermissionDenied):
+		utils.Forbidden(c, err.Error())
+	default:
+		utils.InternalError(c, fallback)
+	}
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gin-project/middleware"
+	"gin-project/models"
+	"gin-project/services"
+	"gin-project/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateRoomInviteInput 建立邀請連結輸入
+type CreateRoomInviteInput struct {
+	ExpiresInSeconds int64 `json:"expires_in_seconds"` // 0 表示永不過期
+	MaxUses          int   `json:"max_uses"`           // 0 表示不限次數
+	RequireApproval  bool  `json:"require_approval"`   // 加入前需管理員審核
+}
+
+// CreateRoomInvite 建立聊天室邀請連結（擁有者與管理員）
+func CreateRoomInvite(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	roomID, ok := parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	var input CreateRoomInviteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.BadRequest(c, "請求資料格式錯誤")
+		return
+	}
+
+	invite, err := services.CreateRoomInvite(roomID, userID, services.CreateRoomInviteParams{
+		ExpiresIn:       time.Duration(input.ExpiresInSeconds) * time.Second,
+		MaxUses:         input.MaxUses,
+		RequireApproval: input.RequireApproval,
+	})
+	if err != nil {
+		respondInviteError(c, err, "建立邀請連結失敗")
+		return
+	}
+
+	utils.SuccessWithData(c, invite.ToResponse())
+}
+
+// GetRoomInvites 取得聊天室邀請連結與加入記錄（擁有者與管理員）
+func GetRoomInvites(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	roomID, ok := parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	invites, err := services.ListRoomInvites(roomID, userID)
+	if err != nil {
+		respondInviteError(c, err, "取得邀請連結失敗")
+		return
+	}
+
+	invitesResponse := make([]models.RoomInviteResponse, 0, len(invites))
+	for _, invite := range invites {
+		invitesResponse = append(invitesResponse, invite.ToResponse())
+	}
+
+	utils.SuccessWithData(c, invitesResponse)
+}
+
+// RevokeRoomInvite 撤銷邀請連結（擁有者與管理員）
+func RevokeRoomInvite(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	roomID, ok := parseRoomID(c)
+	if !ok {
+		return
+	}
+	inviteID, err := strconv.ParseUint(c.Param("inviteId"), 10, 32)
+	if err != nil {
+		utils.BadRequest(c, "無效的邀請連結 ID")
+		return
+	}
+
+	if err := services.RevokeRoomInvite(roomID, userID, uint(inviteID)); err != nil {
+		respondInviteError(c, err, "撤銷邀請連結失敗")
+		return
+	}
+
+	utils.Success(c, "已撤銷邀請連結")
+}
+
+// PreviewRoomInvite 以邀請碼預覽聊天室
+func PreviewRoomInvite(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	preview, err := services.PreviewRoomInvite(c.Param("code"), userID)
+	if err != nil {
+		respondInviteError(c, err, "取得邀請資訊失敗")
+		return
+	}
+
+	utils.SuccessWithData(c, preview)
+}
+
+// JoinRoomByInvite 使用邀請碼加入聊天室，需要審核時送出加入申請
+func JoinRoomByInvite(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+
+		join, err := services.JoinRoomByInvite(c.Param("code"), userID)
+		if err != nil {
+			respondInviteError(c, err, "加入聊天室失敗")
+			return
+		}
+
+		if join.Status == models.InviteJoinPending {
+			// 通知管理員有新的加入申請
+			hub.NotifyRoom("room_join_request", userID, join.RoomID, services.RoomAdminIDs(join.RoomID), join.ToResponse())
+			utils.SuccessWithData(c, gin.H{
+				"status":  join.Status,
+				"request": join.ToResponse(),
+			})
+			return
+		}
+
+		room := notifyInviteJoined(hub, join)
+		utils.SuccessWithData(c, gin.H{
+			"status": join.Status,
+			"room":   room,
+		})
+	}
+}
+
+// GetRoomJoinRequests 取得待審核的加入申請（擁有者與管理員）
+func GetRoomJoinRequests(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	roomID, ok := parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	joins, err := services.ListRoomJoinRequests(roomID, userID)
+	if err != nil {
+		respondInviteError(c, err, "取得加入申請失敗")
+		return
+	}
+
+	requestsResponse := make([]models.RoomInviteJoinResponse, 0, len(joins))
+	for _, join := range joins {
+		requestsResponse = append(requestsResponse, join.ToResponse())
+	}
+
+	utils.SuccessWithData(c, requestsResponse)
+}
+
+// ApproveRoomJoinRequest 核准加入申請
+func ApproveRoomJoinRequest(hub *services.Hub) gin.HandlerFunc {
+	return reviewRoomJoinRequest(hub, true)
+}
+
+// RejectRoomJoinRequest 拒絕加入申請
+func RejectRoomJoinRequest(hub *services.Hub) gin.HandlerFunc {
+	return reviewRoomJoinRequest(hub, false)
+}
+
+// reviewRoomJoinRequest 審核加入申請並通知申請者
+func reviewRoomJoinRequest(hub *services.Hub, approve bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		roomID, ok := parseRoomID(c)
+		if !ok {
+			return
+		}
+		requestID, err := strconv.ParseUint(c.Param("requestId"), 10, 32)
+		if err != nil {
+			utils.BadRequest(c, "無效的申請 ID")
+			return
+		}
+
+		join, err := services.ReviewRoomJoinRequest(roomID, userID, uint(requestID), approve)
+		if err != nil {
+			respondInviteError(c, err, "審核加入申請失敗")
+			return
+		}
+
+		if !approve {
+			hub.NotifyRoom("room_join_rejected", userID, roomID, []uint{join.UserID}, join.ToResponse())
+			utils.Success(c, "已拒絕加入申請")
+			return
+		}
+
+		notifyInviteJoined(hub, join)
+		utils.Success(c, "已核准加入申請")
+	}
+}
+
+// notifyInviteJoined 通知新成員與既有成員，並在時間軸寫入系統訊息，回傳聊天室資訊
+func notifyInviteJoined(hub *services.Hub, join *models.RoomInviteJoin) *models.ChatRoomResponse {
+	room, err := services.GetRoomForMember(join.RoomID, join.UserID)
+	if err != nil {
+		return nil
+	}
+	response := room.ToResponse()
+
+	hub.NotifyRoom("room_joined", join.UserID, join.RoomID, []uint{join.UserID}, response)
+	hub.NotifyRoom("room_members_added", join.UserID, join.RoomID, services.RoomMemberIDs(join.RoomID), gin.H{
+		"room_id":   join.RoomID,
+		"user_ids":  []uint{join.UserID},
+		"invite_id": join.InviteID,
+	})
+	hub.PostSystemMessage(join.RoomID, join.UserID, fmt.Sprintf("%s 透過邀請連結加入聊天室", services.RoomDisplayName(join.UserID)))
+
+	return &response
+}
+
+// respondInviteError 將邀請連結操作的錯誤轉換為對應的 HTTP 響應
+func respondInviteError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInviteOptions), errors.Is(err, services.ErrAlreadyInRoom):
+		utils.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrInviteNotFound), errors.Is(err, services.ErrJoinRequestNotFound):
+		utils.NotFound(c, err.Error())
+	case errors.Is(err, services.ErrInviteUnusable):
+		utils.Forbidden(c, err.Error())
+	default:
+		respondRoomError(c, err, fallback)
+	}
+}
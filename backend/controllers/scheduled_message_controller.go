@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"errors"
+	"gin-project/middleware"
+	"gin-project/services"
+	"gin-project/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScheduleMessageInput 建立排程訊息輸入
+type ScheduleMessageInput struct {
+	ReceiverID  uint      `json:"receiver_id"` // 私訊接收者
+	RoomID      uint      `json:"room_id"`     // 群組聊天室（與 receiver_id 擇一）
+	Content     string    `json:"content" binding:"required"`
+	MessageType string    `json:"message_type"`
+	FileURL     string    `json:"file_url"`
+	FileName    string    `json:"file_name"`
+	FileSize    int64     `json:"file_size"`
+	ReplyToID   uint      `json:"reply_to_id"`
+	ScheduledAt time.Time `json:"scheduled_at" binding:"required"` // RFC3339
+}
+
+// UpdateScheduledMessageInput 修改排程訊息輸入（省略的欄位不變更）
+type UpdateScheduledMessageInput struct {
+	Content     *string    `json:"content"`
+	ScheduledAt *time.Time `json:"scheduled_at"`
+	FileURL     *string    `json:"file_url"`
+	FileName    *string    `json:"file_name"`
+	FileSize    *int64     `json:"file_size"`
+}
+
+// CreateScheduledMessage 建立排程訊息
+func CreateScheduledMessage(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var input ScheduleMessageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.BadRequest(c, "請求資料格式錯誤")
+		return
+	}
+
+	scheduled, err := services.CreateScheduledMessage(services.ScheduleMessageParams{
+		SenderID:    userID,
+		ReceiverID:  input.ReceiverID,
+		RoomID:      input.RoomID,
+		Content:     input.Content,
+		MessageType: input.MessageType,
+		FileURL:     input.FileURL,
+		FileName:    input.FileName,
+		FileSize:    input.FileSize,
+		ReplyToID:   input.ReplyToID,
+		ScheduledAt: input.ScheduledAt,
+	}, time.Now())
+	if err != nil {
+		respondScheduledError(c, err)
+		return
+	}
+
+	utils.SuccessWithData(c, scheduled)
+}
+
+// GetScheduledMessages 取得自己的排程訊息，可用 status 篩選（預設 pending）
+func GetScheduledMessages(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	scheduled, err := services.ListScheduledMessages(userID, c.Query("status"))
+	if err != nil {
+		utils.InternalError(c, "取得排程訊息失敗")
+		return
+	}
+
+	utils.SuccessWithData(c, scheduled)
+}
+
+// UpdateScheduledMessage 修改尚未發送的排程訊息
+func UpdateScheduledMessage(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	id, ok := parseScheduledID(c)
+	if !ok {
+		return
+	}
+
+	var input UpdateScheduledMessageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.BadRequest(c, "請求資料格式錯誤")
+		return
+	}
+
+	scheduled, err := services.UpdateScheduledMessage(id, userID, services.UpdateScheduledMessageParams{
+		Content:     input.Content,
+		ScheduledAt: input.ScheduledAt,
+		FileURL:     input.FileURL,
+		FileName:    input.FileName,
+		FileSize:    input.FileSize,
+	}, time.Now())
+	if err != nil {
+		respondScheduledError(c, err)
+		return
+	}
+
+	utils.SuccessWithData(c, scheduled)
+}
+
+// CancelScheduledMessage 取消尚未發送的排程訊息
+func CancelScheduledMessage(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	id, ok := parseScheduledID(c)
+	if !ok {
+		return
+	}
+
+	scheduled, err := services.CancelScheduledMessage(id, userID)
+	if err != nil {
+		respondScheduledError(c, err)
+		return
+	}
+
+	utils.SuccessWithData(c, scheduled)
+}
+
+// parseScheduledID 解析路徑中的排程訊息 ID，失敗時已回應錯誤
+func parseScheduledID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.BadRequest(c, "無效的排程訊息 ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondScheduledError 將排程訊息的錯誤轉換為對應的 HTTP 響應
+func respondScheduledError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidScheduleTime), errors.Is(err, services.ErrScheduledNotPending):
+		utils.BadRequest(c, err.Error())
+	case errors.Is(err, services.ErrScheduledNotFound):
+		utils.NotFound(c, err.Error())
+	default:
+		respondSendError(c, err)
+	}
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"errors"
+	"gin-project/middleware"
+	"gin-project/services"
+	"gin-project/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchMessages 在自己參與的私訊與聊天室中搜尋訊息
+// 查詢參數：q、friend_id 或 room_id、sender_id、type、from、to（RFC3339 或 YYYY-MM-DD）、cursor、limit
+func SearchMessages(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	params := services.SearchMessagesParams{
+		UserID:      userID,
+		Query:       c.Query("q"),
+		MessageType: c.Query("type"),
+	}
+
+	var ok bool
+	if params.PeerID, ok = parseOptionalID(c, "friend_id"); !ok {
+		return
+	}
+	if params.RoomID, ok = parseOptionalID(c, "room_id"); !ok {
+		return
+	}
+	if params.SenderID, ok = parseOptionalID(c, "sender_id"); !ok {
+		return
+	}
+	if params.Cursor, ok = parseOptionalID(c, "cursor"); !ok {
+		return
+	}
+	if params.From, ok = parseSearchTime(c, "from", false); !ok {
+		return
+	}
+	if params.To, ok = parseSearchTime(c, "to", true); !ok {
+		return
+	}
+
+	params.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if params.Limit < 1 || params.Limit > 50 {
+		params.Limit = 20
+	}
+
+	result, err := services.SearchMessages(params)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidSearchQuery), errors.Is(err, services.ErrInvalidSearchFilter),
+			errors.Is(err, services.ErrInvalidMessageType):
+			utils.BadRequest(c, err.Error())
+		case errors.Is(err, services.ErrRoomNotFound), errors.Is(err, services.ErrNotRoomMember):
+			utils.NotFound(c, services.ErrRoomNotFound.Error())
+		default:
+			utils.InternalError(c, "搜尋訊息失敗")
+		}
+		return
+	}
+
+	utils.SuccessWithData(c, result)
+}
+
+// parseOptionalID 解析選填的 ID 查詢參數，未提供時回傳 0，格式錯誤時已回應錯誤
+func parseOptionalID(c *gin.Context, key string) (uint, bool) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		utils.BadRequest(c, "無效的 "+key)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// parseSearchTime 解析時間查詢參數；只給日期時，作為上限的日期包含當天整天
+func parseSearchTime(c *gin.Context, key string, endOfDay bool) (time.Time, bool) {
+	value := c.Query(key)
+	if value == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		utils.BadRequest(c, "無效的 "+key+" 時間格式")
+		return time.Time{}, false
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
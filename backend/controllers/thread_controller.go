@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"errors"
+	"gin-project/middleware"
+	"gin-project/models"
+	"gin-project/services"
+	"gin-project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SendThreadReplyInput 回覆討論串輸入
+type SendThreadReplyInput struct {
+	Content     string `json:"content" binding:"required"`
+	MessageType string `json:"message_type"`
+	FileURL     string `json:"file_url"`
+	FileName    string `json:"file_name"`
+	FileSize    int64  `json:"file_size"`
+	ClientMsgID string `json:"client_msg_id"`
+	ReplyToID   uint   `json:"reply_to_id"`
+}
+
+// GetThread 取得討論串（根訊息與分頁的回覆，由舊到新；before、after、around 游標同聊天記錄）
+func GetThread(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	messageID, ok := parseMessageID(c)
+	if !ok {
+		return
+	}
+
+	root, err := services.GetThreadRoot(messageID, userID)
+	if err != nil {
+		respondThreadError(c, err, "取得討論串失敗")
+		return
+	}
+
+	cursor, ok := parseMessageCursor(c)
+	if !ok {
+		return
+	}
+
+	page, err := services.GetThreadReplies(root.ID, userID, cursor)
+	if err != nil {
+		respondPageError(c, err)
+		return
+	}
+
+	responses := make([]models.MessageResponse, 0, len(page.Messages)+1)
+	responses = append(responses, root.ToResponse())
+	for _, reply := range page.Messages {
+		responses = append(responses, reply.ToResponse())
+	}
+	services.AttachReactions(responses, userID)
+	services.AttachPolls(responses, userID)
+
+	utils.SuccessWithData(c, gin.H{
+		"root":            responses[0],
+		"replies":         responses[1:],
+		"following":       services.IsFollowingThread(root.ID, userID),
+		"has_more_before": page.HasMoreBefore,
+		"has_more_after":  page.HasMoreAfter,
+	})
+}
+
+// SendThreadReply 在討論串中回覆，只推送給追蹤討論串的參與者
+func SendThreadReply(hub *services.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := middleware.GetUserID(c)
+		messageID, ok := parseMessageID(c)
+		if !ok {
+			return
+		}
+
+		var input SendThreadReplyInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			utils.BadRequest(c, "請求資料格式錯誤")
+			return
+		}
+
+		root, err := services.GetThreadRoot(messageID, userID)
+		if err != nil {
+			respondThreadError(c, err, "回覆討論串失敗")
+			return
+		}
+
+		params := services.SendMessageParams{
+			SenderID:     userID,
+			Content:      input.Content,
+			MessageType:  input.MessageType,
+			FileURL:      input.FileURL,
+			FileName:     input.FileName,
+			FileSize:     input.FileSize,
+			ClientMsgID:  input.ClientMsgID,
+			ReplyToID:    input.ReplyToID,
+			ThreadRootID: root.ID,
+		}
+		// 發送到根訊息所在的對話
+		switch {
+		case root.IsRoomMessage():
+			params.RoomID = root.GetRoomID()
+		case root.SenderID == userID:
+			params.ReceiverID = root.GetReceiverID()
+		default:
+			params.ReceiverID = root.SenderID
+		}
+
+		message, duplicate, err := services.SaveMessageToDB(params)
+		if err != nil {
+			respondSendError(c, err)
+			return
+		}
+
+		hub.DispatchChatMessage(message, duplicate)
+
+		utils.SuccessWithData(c, services.MessageResponseFor(message, userID))
+	}
+}
+
+// FollowThread 追蹤討論串
+func FollowThread(c *gin.Context) {
+	setThreadFollow(c, true)
+}
+
+// UnfollowThread 取消追蹤討論串
+func UnfollowThread(c *gin.Context) {
+	setThreadFollow(c, false)
+}
+
+// setThreadFollow 設定討論串追蹤狀態
+func setThreadFollow(c *gin.Context, following bool) {
+	userID := middleware.GetUserID(c)
+	messageID, ok := parseMessageID(c)
+	if !ok {
+		return
+	}
+
+	if err := services.SetThreadFollow(messageID, userID, following); err != nil {
+		respondThreadError(c, err, "設定追蹤失敗")
+		return
+	}
+
+	utils.SuccessWithData(c, gin.H{
+		"message_id": messageID,
+		"following":  following,
+	})
+}
+
+// respondThreadError 將討論串操作的錯誤轉換為對應的 HTTP 響應
+func respondThreadError(c *gin.Context, err error, fallback string) {
+	if errors.Is(err, services.ErrInvalidThreadRoot) {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	respondMessageError(c, err, fallback)
+}
@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"gin-project/config"
 	"gin-project/middleware"
+	"gin-project/models"
 	"gin-project/services"
 	"gin-project/utils"
 	"log"
@@ -63,17 +65,19 @@ func HandleWebSocket(hub *services.Hub) gin.HandlerFunc {
 			return
 		}
 
-		// 建立新客戶端
-		client := &services.Client{
-			Hub:      hub,
-			Conn:     conn,
-			UserID:   userID,
-			Username: username,
-			Send:     make(chan []byte, 256),
+		// 建立新客戶端（同一使用者可同時擁有多個連線）
+		client := services.NewClient(hub, conn, userID, username, c.Query("device_id"))
+
+		// 重連時帶上最後收到的事件序號，補發斷線期間遺漏的事件
+		if lastSeq := c.Query("last_seq"); lastSeq != "" {
+			if seq, err := strconv.ParseUint(lastSeq, 10, 64); err == nil {
+				client.Resume = true
+				client.LastSeq = seq
+			}
 		}
 
 		// 註冊客戶端
-		client.Hub.Register <- client
+		hub.RegisterClient(client)
 
 		// 啟動讀寫 goroutine
 		go client.WritePump()
@@ -81,7 +85,7 @@ func HandleWebSocket(hub *services.Hub) gin.HandlerFunc {
 	}
 }
 
-// GetOnlineUsers 取得在線使用者列表
+// GetOnlineUsers 取得在線好友列表
 func GetOnlineUsers(hub *services.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := middleware.GetUserID(c)
@@ -90,7 +94,14 @@ func GetOnlineUsers(hub *services.Hub) gin.HandlerFunc {
 			return
 		}
 
-		onlineUsers := hub.GetOnlineUsers()
+		// 只回傳好友的在線狀態
+		onlineUsers := make([]uint, 0)
+		for _, friendID := range services.FriendIDs(userID) {
+			if hub.IsUserOnline(friendID) {
+				onlineUsers = append(onlineUsers, friendID)
+			}
+		}
+
 		utils.SuccessWithData(c, gin.H{
 			"online_users": onlineUsers,
 			"total":        len(onlineUsers),
@@ -98,7 +109,7 @@ func GetOnlineUsers(hub *services.Hub) gin.HandlerFunc {
 	}
 }
 
-// CheckUserOnline 檢查指定使用者是否在線
+// CheckUserOnline 檢查指定好友是否在線
 func CheckUserOnline(hub *services.Hub) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := middleware.GetUserID(c)
@@ -115,10 +126,18 @@ func CheckUserOnline(hub *services.Hub) gin.HandlerFunc {
 			return
 		}
 
-		isOnline := hub.IsUserOnline(uint(checkID))
-		utils.SuccessWithData(c, gin.H{
-			"user_id":   uint(checkID),
-			"is_online": isOnline,
-		})
+		// 只能查詢自己或好友的在線狀態
+		if uint(checkID) != userID && !services.AreFriends(userID, uint(checkID)) {
+			utils.Forbidden(c, "只能查看好友的在線狀態")
+			return
+		}
+
+		var user models.User
+		if err := config.DB.First(&user, checkID).Error; err != nil {
+			utils.NotFound(c, "使用者不存在")
+			return
+		}
+
+		utils.SuccessWithData(c, hub.ResolvePresence(&user))
 	}
 }
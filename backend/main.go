@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"gin-project/config"
 	"gin-project/models"
@@ -27,18 +34,90 @@ func main() {
 		&models.User{},
 		&models.Friendship{},
 		&models.Message{},
+		&models.MessageEdit{},
+		&models.MessageDeletion{},
+		&models.MessageReaction{},
+		&models.ThreadFollow{},
+		&models.ReadWatermark{},
+		&models.Conversation{},
+		&models.ScheduledMessage{},
+		&models.DisappearingTimer{},
+		&models.Poll{},
+		&models.PollOption{},
+		&models.PollVote{},
 		&models.ChatRoom{},
 		&models.RoomMember{},
+		&models.RoomInvite{},
+		&models.RoomInviteJoin{},
+		&models.UserEvent{},
+		&models.UserEventCursor{},
+		&models.UserPresence{},
 	); err != nil {
 		log.Fatalf("資料表遷移失敗: %v", err)
 	}
 	log.Println("✓ 資料表遷移成功")
 
+	// 訊息搜尋索引
+	switch cfg.SearchIndex {
+	case "mysql":
+		// 預設使用 messages.content 的 FULLTEXT 索引，由 MySQL 自行維護，不需額外設定
+	case "memory":
+		index := services.NewMemoryMessageIndex()
+		if err := services.RebuildMessageIndex(index); err != nil {
+			log.Fatalf("建立訊息搜尋索引失敗: %v", err)
+		}
+		services.SetMessageIndex(index)
+		log.Println("✓ 已使用記憶體訊息搜尋索引")
+	default:
+		log.Fatalf("未知的訊息搜尋索引: %s", cfg.SearchIndex)
+	}
+
 	// 建立 WebSocket Hub 並啟動
 	hub := services.NewHub()
+	hub.Heartbeat = services.HeartbeatConfig{
+		PingInterval:   time.Duration(cfg.WSPingIntervalSeconds) * time.Second,
+		PongWait:       time.Duration(cfg.WSPongTimeoutSeconds) * time.Second,
+		WriteWait:      time.Duration(cfg.WSWriteTimeoutSeconds) * time.Second,
+		MaxMessageSize: int64(cfg.WSMaxMessageBytes),
+	}
+	if hub.Heartbeat.PingInterval >= hub.Heartbeat.PongWait {
+		log.Fatalf("WebSocket 設定錯誤: ping 間隔必須小於 pong 逾時")
+	}
+
+	// 多實例部署：透過 Redis 共享推送訊息與在線狀態
+	if cfg.InstanceID != "" {
+		hub.InstanceID = cfg.InstanceID
+	}
+	if cfg.RedisAddr != "" {
+		broker, err := services.NewRedisBroker(cfg.RedisAddr, cfg.RedisPassword)
+		if err != nil {
+			log.Fatalf("Redis 訊息代理初始化失敗: %v", err)
+		}
+		presence, err := services.NewRedisPresence(cfg.RedisAddr, cfg.RedisPassword, hub.InstanceID)
+		if err != nil {
+			log.Fatalf("Redis 在線狀態初始化失敗: %v", err)
+		}
+		hub.Broker = broker
+		hub.Presence = presence
+		log.Printf("✓ 已啟用 Redis 跨實例推送（實例 ID: %s）", hub.InstanceID)
+	}
+
+	// 閒置偵測與自訂狀態到期
+	hub.IdleTimeout = time.Duration(cfg.PresenceIdleMinutes) * time.Minute
+
 	go hub.Run()
+	go hub.RunPresenceMonitor(30 * time.Second)
 	log.Println("✓ WebSocket Hub 啟動成功")
 
+	// 定期清除過期的 WebSocket 事件紀錄
+	go services.StartEventPruner(time.Duration(cfg.EventRetentionHours) * time.Hour)
+
+	// 排程訊息：重新啟動後會補發停機期間到期的訊息
+	go services.NewMessageScheduler(hub).Run(5 * time.Second)
+
+	// 自動銷毀：永久刪除到期的訊息
+	go services.NewMessageSweeper(hub).Run(5 * time.Second)
+
 	// 設定 Gin 模式
 	gin.SetMode(gin.ReleaseMode)
 
@@ -55,7 +134,29 @@ func main() {
 	log.Printf("✓ WebSocket 端點: ws://localhost:%s/api/ws", cfg.ServerPort)
 	log.Printf("✓ 健康檢查: http://localhost:%s/health", cfg.ServerPort)
 
-	if err := r.Run(serverAddr); err != nil {
-		log.Fatalf("伺服器啟動失敗: %v", err)
+	server := &http.Server{Addr: serverAddr, Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("伺服器啟動失敗: %v", err)
+		}
+	}()
+
+	// 收到終止訊號後停止接受請求，並關閉跨實例連線（其他實例會立即將本實例的連線視為離線）
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("正在關閉伺服器...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("❌ 伺服器關閉失敗: %v", err)
+	}
+	if err := hub.Presence.Close(); err != nil {
+		log.Printf("❌ 關閉在線狀態登記失敗: %v", err)
+	}
+	if err := hub.Broker.Close(); err != nil {
+		log.Printf("❌ 關閉訊息代理失敗: %v", err)
 	}
+	log.Println("✓ 伺服器已關閉")
 }
@@ -0,0 +1,12 @@
+-- 訊息冪等鍵與送達回報 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 為 messages 表新增客戶端訊息 ID，避免重送時建立重複訊息
+
+-- 新增客戶端訊息 ID 欄位（同一發送者內唯一，NULL 表示未提供）
+ALTER TABLE messages ADD COLUMN client_msg_id VARCHAR(64) NULL AFTER file_size;
+
+-- 建立發送者 + 客戶端訊息 ID 唯一索引
+CREATE UNIQUE INDEX idx_sender_client_msg ON messages (sender_id, client_msg_id);
+
+-- 查看變更結果
+DESCRIBE messages;
@@ -0,0 +1,60 @@
+-- 最近聊天摘要 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 對話設定表記錄每位參與者的最後訊息指標與未讀數，最近聊天列表改以 keyset 分頁查詢
+
+-- 新增最後訊息與未讀數欄位
+ALTER TABLE conversations ADD COLUMN last_message_id BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER draft_updated_at;
+ALTER TABLE conversations ADD COLUMN last_message_at DATETIME(3) NULL AFTER last_message_id;
+ALTER TABLE conversations ADD COLUMN unread_count BIGINT NOT NULL DEFAULT 0 AFTER last_message_at;
+
+-- 建立索引
+CREATE INDEX idx_user_last_message ON conversations (user_id, last_message_at);
+
+-- 回填私訊的最後訊息
+INSERT INTO conversations (user_id, peer_id, room_id, last_message_id, last_message_at, unread_count, marked_unread, draft, updated_at)
+SELECT u.user_id, u.peer_id, 0, u.last_id, m.created_at, 0, FALSE, '', NOW(3)
+FROM (
+    SELECT user_id, peer_id, MAX(last_id) AS last_id
+    FROM (
+        SELECT sender_id AS user_id, receiver_id AS peer_id, MAX(id) AS last_id
+        FROM messages
+        WHERE receiver_id IS NOT NULL AND thread_root_id IS NULL AND deleted_at IS NULL
+        GROUP BY sender_id, receiver_id
+        UNION ALL
+        SELECT receiver_id AS user_id, sender_id AS peer_id, MAX(id) AS last_id
+        FROM messages
+        WHERE receiver_id IS NOT NULL AND thread_root_id IS NULL AND deleted_at IS NULL
+        GROUP BY receiver_id, sender_id
+    ) pairs
+    GROUP BY user_id, peer_id
+) u
+JOIN messages m ON m.id = u.last_id
+ON DUPLICATE KEY UPDATE last_message_id = VALUES(last_message_id), last_message_at = VALUES(last_message_at);
+
+-- 回填聊天室的最後訊息（每位成員各一筆）
+INSERT INTO conversations (user_id, peer_id, room_id, last_message_id, last_message_at, unread_count, marked_unread, draft, updated_at)
+SELECT rm.user_id, 0, rm.room_id, r.last_id, m.created_at, 0, FALSE, '', NOW(3)
+FROM room_members rm
+JOIN (
+    SELECT room_id, MAX(id) AS last_id
+    FROM messages
+    WHERE room_id IS NOT NULL AND thread_root_id IS NULL AND deleted_at IS NULL
+    GROUP BY room_id
+) r ON r.room_id = rm.room_id
+JOIN messages m ON m.id = r.last_id
+ON DUPLICATE KEY UPDATE last_message_id = VALUES(last_message_id), last_message_at = VALUES(last_message_at);
+
+-- 依已讀位置計算未讀數
+UPDATE conversations c
+SET c.unread_count = (
+    SELECT COUNT(*) FROM messages m
+    WHERE m.thread_root_id IS NULL AND m.deleted_at IS NULL
+    AND (
+        (c.room_id = 0 AND m.sender_id = c.peer_id AND m.receiver_id = c.user_id)
+        OR (c.room_id <> 0 AND m.room_id = c.room_id AND m.sender_id <> c.user_id)
+    )
+    AND m.id > COALESCE((
+        SELECT w.last_read_message_id FROM read_watermarks w
+        WHERE w.user_id = c.user_id AND w.peer_id = c.peer_id AND w.room_id = c.room_id
+    ), 0)
+);
@@ -0,0 +1,19 @@
+-- 對話設定 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 使用者可對好友私訊與群組聊天室個別設定靜音、置頂、封存、標記未讀與草稿
+
+-- 建立對話設定表
+CREATE TABLE IF NOT EXISTS conversations (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL COMMENT '使用者 ID',
+    peer_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '私訊對象 ID，群組為 0',
+    room_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '聊天室 ID，私訊為 0',
+    muted_until DATETIME(3) NULL COMMENT '靜音到期時間',
+    pinned_at DATETIME(3) NULL COMMENT '置頂時間',
+    archived_at DATETIME(3) NULL COMMENT '封存時間',
+    marked_unread BOOLEAN NOT NULL DEFAULT FALSE COMMENT '手動標記為未讀',
+    draft TEXT NOT NULL COMMENT '草稿',
+    draft_updated_at DATETIME(3) NULL COMMENT '草稿更新時間',
+    updated_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_user_conversation (user_id, peer_id, room_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='對話設定表';
@@ -0,0 +1,26 @@
+-- 訊息自動銷毀 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 對話可設定訊息在讀取或發送後一段時間自動銷毀，到期的訊息由背景清除程序永久刪除
+
+-- 建立自動銷毀設定表（私訊雙方共用一筆，user_id 為 ID 較小者）
+CREATE TABLE IF NOT EXISTS disappearing_timers (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '私訊中 ID 較小的使用者，群組為 0',
+    peer_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '私訊中 ID 較大的使用者，群組為 0',
+    room_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '聊天室 ID，私訊為 0',
+    seconds INT NOT NULL DEFAULT 0 COMMENT '自動銷毀秒數，0 表示關閉',
+    mode ENUM('after_read','after_send') NOT NULL DEFAULT 'after_read' COMMENT '計時方式',
+    updated_by BIGINT UNSIGNED NULL COMMENT '最後設定者',
+    updated_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_disappearing_conversation (user_id, peer_id, room_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='訊息自動銷毀設定表';
+
+-- 訊息加上自動銷毀秒數與到期時間
+ALTER TABLE messages
+    ADD COLUMN disappear_seconds INT NOT NULL DEFAULT 0 COMMENT '發送時的自動銷毀秒數' AFTER recalled_at,
+    ADD COLUMN expires_at DATETIME(3) NULL COMMENT '到期時間' AFTER disappear_seconds,
+    ADD INDEX idx_messages_expires_at (expires_at);
+
+-- 移除 reply_to_id 的外鍵約束（由 GORM 自動遷移建立）：被回覆的訊息到期永久刪除後保留引用，預覽顯示為已刪除
+-- 若資料庫未曾由自動遷移建立此約束，略過此步驟
+ALTER TABLE messages DROP FOREIGN KEY fk_messages_reply_to;
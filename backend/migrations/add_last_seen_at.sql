@@ -0,0 +1,9 @@
+-- 好友在線狀態 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 為 users 表新增最後上線時間（僅提供給好友）
+
+-- 新增最後上線時間欄位
+ALTER TABLE users ADD COLUMN last_seen_at DATETIME(3) NULL AFTER avatar_url;
+
+-- 查看變更結果
+DESCRIBE users;
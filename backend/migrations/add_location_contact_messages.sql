@@ -0,0 +1,9 @@
+-- 位置與名片訊息 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 新增 location 與 contact 訊息類型，結構化內容（經緯度、即時位置分享、名片）存放於 payload 欄位
+
+-- 訊息類型加入 location 與 contact
+ALTER TABLE messages MODIFY COLUMN message_type ENUM('text', 'image', 'video', 'file', 'system', 'poll', 'location', 'contact') DEFAULT 'text';
+
+-- 新增結構化內容欄位
+ALTER TABLE messages ADD COLUMN payload JSON NULL COMMENT '位置或名片等結構化內容' AFTER file_size;
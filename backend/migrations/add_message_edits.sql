@@ -0,0 +1,15 @@
+-- 訊息編輯 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 訊息可在發送後一段時間內編輯，並保存編輯歷史
+
+-- 新增最後編輯時間欄位（NULL 表示未編輯）
+ALTER TABLE messages ADD COLUMN edited_at DATETIME(3) NULL AFTER is_read;
+
+-- 建立編輯歷史表（保存每次編輯前的內容）
+CREATE TABLE IF NOT EXISTS message_edits (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    message_id BIGINT UNSIGNED NOT NULL COMMENT '訊息 ID',
+    content TEXT NOT NULL COMMENT '編輯前的內容',
+    created_at DATETIME(3) NULL COMMENT '被取代的時間',
+    INDEX idx_message_edits_message_id (message_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='訊息編輯歷史表';
@@ -0,0 +1,12 @@
+-- 訊息表情回應 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 使用者可對訊息加上表情回應
+
+CREATE TABLE IF NOT EXISTS message_reactions (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    message_id BIGINT UNSIGNED NOT NULL COMMENT '訊息 ID',
+    user_id BIGINT UNSIGNED NOT NULL COMMENT '回應的使用者 ID',
+    emoji VARCHAR(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL COMMENT '表情（二進位排序，避免不同表情被視為相同）',
+    created_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_message_user_emoji (message_id, user_id, emoji)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='訊息表情回應表';
@@ -0,0 +1,16 @@
+-- 訊息刪除與收回 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 使用者可刪除訊息（僅對自己隱藏），發送者可在時限內收回訊息（對所有人顯示為已收回）
+
+-- 新增收回時間欄位（NULL 表示未收回）
+ALTER TABLE messages ADD COLUMN recalled_at DATETIME(3) NULL AFTER edited_at;
+
+-- 建立個人刪除記錄表
+CREATE TABLE IF NOT EXISTS message_deletions (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    message_id BIGINT UNSIGNED NOT NULL COMMENT '訊息 ID',
+    user_id BIGINT UNSIGNED NOT NULL COMMENT '刪除訊息的使用者 ID',
+    created_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_message_user (message_id, user_id),
+    INDEX idx_message_deletions_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='訊息個人刪除記錄表';
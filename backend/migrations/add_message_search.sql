@@ -0,0 +1,6 @@
+-- 訊息搜尋 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 為訊息內容建立 FULLTEXT 索引，使用 ngram 解析器以支援中文搜尋
+
+-- 建立全文索引
+CREATE FULLTEXT INDEX idx_messages_content ON messages (content) WITH PARSER ngram;
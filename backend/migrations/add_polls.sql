@@ -0,0 +1,39 @@
+-- 投票訊息 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 新增 poll 訊息類型，支援單選或複選、匿名投票與截止時間，投票結果即時推送給對話參與者
+
+-- 訊息類型加入 poll
+ALTER TABLE messages MODIFY COLUMN message_type ENUM('text', 'image', 'video', 'file', 'system', 'poll') DEFAULT 'text';
+
+-- 建立投票表（與投票訊息一對一）
+CREATE TABLE IF NOT EXISTS polls (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    message_id BIGINT UNSIGNED NOT NULL COMMENT '投票訊息 ID',
+    question VARCHAR(500) NOT NULL COMMENT '題目',
+    multiple_choice BOOLEAN NOT NULL DEFAULT FALSE COMMENT '是否可複選',
+    anonymous BOOLEAN NOT NULL DEFAULT FALSE COMMENT '是否匿名',
+    closes_at DATETIME(3) NULL COMMENT '截止時間',
+    created_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_polls_message_id (message_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='投票表';
+
+-- 建立投票選項表
+CREATE TABLE IF NOT EXISTS poll_options (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    poll_id BIGINT UNSIGNED NOT NULL COMMENT '投票 ID',
+    position INT NOT NULL COMMENT '選項順序',
+    text VARCHAR(255) NOT NULL COMMENT '選項內容',
+    INDEX idx_poll_options_poll_id (poll_id),
+    CONSTRAINT fk_polls_options FOREIGN KEY (poll_id) REFERENCES polls(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='投票選項表';
+
+-- 建立投票紀錄表（複選時每個選項一筆）
+CREATE TABLE IF NOT EXISTS poll_votes (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    poll_id BIGINT UNSIGNED NOT NULL COMMENT '投票 ID',
+    option_id BIGINT UNSIGNED NOT NULL COMMENT '選項 ID',
+    user_id BIGINT UNSIGNED NOT NULL COMMENT '投票者 ID',
+    created_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_option_user (option_id, user_id),
+    INDEX idx_poll_user (poll_id, user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='投票紀錄表';
@@ -0,0 +1,23 @@
+-- 已讀回執 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 記錄每位使用者在各對話中已讀到的訊息，由伺服器推送已讀回執
+
+-- 建立已讀位置表
+CREATE TABLE IF NOT EXISTS read_watermarks (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL COMMENT '讀者 ID',
+    peer_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '私訊對象 ID，群組為 0',
+    room_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '聊天室 ID，私訊為 0',
+    last_read_message_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '已讀到的訊息 ID',
+    updated_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_read_conversation (user_id, peer_id, room_id),
+    INDEX idx_read_watermarks_room_id (room_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='對話已讀位置表';
+
+-- 以現有的 is_read 狀態初始化私訊的已讀位置
+INSERT INTO read_watermarks (user_id, peer_id, room_id, last_read_message_id, updated_at)
+SELECT receiver_id, sender_id, 0, MAX(id), NOW(3)
+FROM messages
+WHERE receiver_id IS NOT NULL AND is_read = TRUE AND deleted_at IS NULL
+GROUP BY receiver_id, sender_id
+ON DUPLICATE KEY UPDATE last_read_message_id = GREATEST(last_read_message_id, VALUES(last_read_message_id));
@@ -0,0 +1,9 @@
+-- 回覆訊息 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 訊息可回覆同一對話中的另一則訊息
+
+-- 新增被回覆訊息 ID 欄位
+ALTER TABLE messages ADD COLUMN reply_to_id BIGINT UNSIGNED NULL AFTER room_id;
+
+-- 建立索引
+CREATE INDEX idx_messages_reply_to_id ON messages (reply_to_id);
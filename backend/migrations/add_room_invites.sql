@@ -0,0 +1,31 @@
+-- 聊天室邀請連結 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 新增聊天室邀請連結（有效期限、使用次數上限、需審核）與透過連結加入的記錄
+
+CREATE TABLE IF NOT EXISTS room_invites (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    room_id BIGINT UNSIGNED NOT NULL COMMENT '聊天室 ID',
+    code VARCHAR(32) NOT NULL COMMENT '邀請碼',
+    created_by BIGINT UNSIGNED NOT NULL COMMENT '建立者 ID',
+    expires_at DATETIME(3) NULL COMMENT '到期時間，NULL 表示永不過期',
+    max_uses BIGINT NOT NULL DEFAULT 0 COMMENT '使用次數上限，0 表示不限',
+    use_count BIGINT NOT NULL DEFAULT 0 COMMENT '已使用次數',
+    require_approval BOOLEAN DEFAULT FALSE COMMENT '加入前需管理員審核',
+    revoked_at DATETIME(3) NULL COMMENT '撤銷時間',
+    created_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_room_invites_code (code),
+    INDEX idx_room_invites_room_id (room_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='聊天室邀請連結表';
+
+CREATE TABLE IF NOT EXISTS room_invite_joins (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    invite_id BIGINT UNSIGNED NOT NULL COMMENT '邀請連結 ID',
+    room_id BIGINT UNSIGNED NOT NULL COMMENT '聊天室 ID',
+    user_id BIGINT UNSIGNED NOT NULL COMMENT '加入的使用者 ID',
+    status ENUM('pending', 'approved', 'rejected') DEFAULT 'pending' COMMENT '申請狀態',
+    reviewed_by BIGINT UNSIGNED NULL COMMENT '審核者 ID',
+    reviewed_at DATETIME(3) NULL COMMENT '審核時間',
+    created_at DATETIME(3) NULL,
+    INDEX idx_room_invite_joins_invite_id (invite_id),
+    INDEX idx_room_join_status (room_id, status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='邀請連結加入記錄表';
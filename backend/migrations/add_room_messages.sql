@@ -0,0 +1,15 @@
+-- 群組聊天 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 訊息可發送到群組聊天室，receiver_id 與 room_id 擇一
+
+-- 私訊接收者改為可為 NULL（群組訊息沒有單一接收者）
+ALTER TABLE messages MODIFY COLUMN receiver_id BIGINT UNSIGNED NULL;
+
+-- 新增群組聊天室 ID 欄位
+ALTER TABLE messages ADD COLUMN room_id BIGINT UNSIGNED NULL AFTER receiver_id;
+
+-- 建立聊天室訊息時間索引（分頁查詢使用）
+CREATE INDEX idx_room_created ON messages (room_id, created_at);
+
+-- 查看變更結果
+DESCRIBE messages;
@@ -0,0 +1,20 @@
+-- 群組角色與權限 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 聊天室成員新增 owner / admin / member 角色與禁言時間，訊息新增系統訊息類型
+
+-- 新增成員角色欄位
+ALTER TABLE room_members ADD COLUMN role ENUM('owner', 'admin', 'member') NOT NULL DEFAULT 'member' AFTER user_id;
+
+-- 新增禁言到期時間欄位（NULL 表示未禁言）
+ALTER TABLE room_members ADD COLUMN muted_until DATETIME(3) NULL AFTER role;
+
+-- 既有聊天室的建立者設為擁有者
+UPDATE room_members rm
+JOIN chat_rooms cr ON cr.id = rm.room_id AND cr.created_by = rm.user_id
+SET rm.role = 'owner';
+
+-- 訊息類型新增系統訊息
+ALTER TABLE messages MODIFY COLUMN message_type ENUM('text', 'image', 'video', 'file', 'system') DEFAULT 'text';
+
+-- 查看變更結果
+DESCRIBE room_members;
@@ -0,0 +1,27 @@
+-- 排程訊息 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 使用者可將文字或附件訊息排程於未來時間發送，由背景排程器到期後透過一般發送流程送出
+
+-- 建立排程訊息表
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    sender_id BIGINT UNSIGNED NOT NULL COMMENT '發送者 ID',
+    receiver_id BIGINT UNSIGNED NULL COMMENT '私訊接收者 ID',
+    room_id BIGINT UNSIGNED NULL COMMENT '聊天室 ID',
+    reply_to_id BIGINT UNSIGNED NULL COMMENT '回覆的訊息 ID',
+    content TEXT NOT NULL COMMENT '訊息內容',
+    message_type ENUM('text','image','video','file') DEFAULT 'text' COMMENT '訊息類型',
+    file_url VARCHAR(500) NULL COMMENT '附件網址',
+    file_name VARCHAR(255) NULL COMMENT '附件檔名',
+    file_size BIGINT NULL COMMENT '附件大小',
+    scheduled_at DATETIME(3) NOT NULL COMMENT '預定發送時間',
+    status ENUM('pending','sending','sent','failed','canceled') DEFAULT 'pending' COMMENT '狀態',
+    claimed_at DATETIME(3) NULL COMMENT '排程器取得時間',
+    message_id BIGINT UNSIGNED NULL COMMENT '發送後的訊息 ID',
+    error VARCHAR(255) NULL COMMENT '發送失敗原因',
+    sent_at DATETIME(3) NULL COMMENT '發送時間',
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    INDEX idx_scheduled_messages_sender_id (sender_id),
+    INDEX idx_scheduled_status_at (status, scheduled_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='排程訊息表';
@@ -0,0 +1,21 @@
+-- 討論串 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 訊息可展開討論串，根訊息記錄回覆數與最後回覆時間，使用者可追蹤或取消追蹤討論串
+
+-- 新增討論串欄位
+ALTER TABLE messages ADD COLUMN thread_root_id BIGINT UNSIGNED NULL AFTER reply_to_id;
+ALTER TABLE messages ADD COLUMN thread_reply_count BIGINT NOT NULL DEFAULT 0 AFTER thread_root_id;
+ALTER TABLE messages ADD COLUMN thread_last_reply_at DATETIME(3) NULL AFTER thread_reply_count;
+
+-- 建立索引
+CREATE INDEX idx_messages_thread_root_id ON messages (thread_root_id);
+
+-- 建立討論串追蹤表
+CREATE TABLE IF NOT EXISTS thread_follows (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    root_message_id BIGINT UNSIGNED NOT NULL COMMENT '討論串根訊息 ID',
+    user_id BIGINT UNSIGNED NOT NULL COMMENT '使用者 ID',
+    following BOOLEAN NOT NULL COMMENT '是否追蹤',
+    updated_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_thread_user (root_message_id, user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='討論串追蹤表';
@@ -0,0 +1,21 @@
+-- WebSocket 斷線補發 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 新增使用者事件紀錄與事件序號表
+
+-- 使用者事件序號表（每位使用者單調遞增）
+CREATE TABLE IF NOT EXISTS user_event_cursors (
+    user_id BIGINT UNSIGNED PRIMARY KEY COMMENT '使用者 ID',
+    last_seq BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '最新事件序號'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='使用者事件序號表';
+
+-- 使用者事件紀錄表
+CREATE TABLE IF NOT EXISTS user_events (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL COMMENT '使用者 ID',
+    seq BIGINT UNSIGNED NOT NULL COMMENT '事件序號',
+    type VARCHAR(50) NOT NULL COMMENT '事件類型',
+    payload MEDIUMTEXT NOT NULL COMMENT '已編碼的 WebSocket 訊息',
+    created_at DATETIME(3) NULL COMMENT '建立時間',
+    UNIQUE KEY idx_user_seq (user_id, seq),
+    INDEX idx_user_events_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='使用者事件紀錄表';
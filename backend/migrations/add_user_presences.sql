@@ -0,0 +1,13 @@
+-- 自訂在線狀態 - 資料庫遷移腳本
+-- 執行日期: 2026-10-18
+-- 說明: 新增使用者自訂狀態（away / busy / invisible）、狀態文字與閒置偵測
+
+CREATE TABLE IF NOT EXISTS user_presences (
+    user_id BIGINT UNSIGNED PRIMARY KEY COMMENT '使用者 ID',
+    status ENUM('online', 'away', 'busy', 'invisible') NOT NULL DEFAULT 'online' COMMENT '自訂狀態',
+    status_text VARCHAR(140) DEFAULT NULL COMMENT '狀態文字',
+    status_expires_at DATETIME(3) NULL COMMENT '狀態到期時間',
+    idle BOOLEAN DEFAULT FALSE COMMENT '是否自動判定為閒置',
+    updated_at DATETIME(3) NULL COMMENT '更新時間',
+    INDEX idx_user_presences_status_expires_at (status_expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='使用者在線狀態表';
@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+// Conversation 使用者對單一對話（好友私訊或群組聊天室）的個人設定
+// 與 ReadWatermark 相同，私訊以 PeerID、群組以 RoomID 表示，未使用的欄位為 0
+type Conversation struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	UserID         uint       `gorm:"not null;uniqueIndex:idx_user_conversation;index:idx_user_last_message,priority:1" json:"user_id"`
+	PeerID         uint       `gorm:"not null;default:0;uniqueIndex:idx_user_conversation" json:"peer_id,omitempty"`
+	RoomID         uint       `gorm:"not null;default:0;uniqueIndex:idx_user_conversation" json:"room_id,omitempty"`
+	MutedUntil     *time.Time `json:"muted_until,omitempty"`         // 靜音到期時間，NULL 表示未靜音
+	PinnedAt       *time.Time `json:"pinned_at,omitempty"`           // 置頂時間，NULL 表示未置頂
+	ArchivedAt     *time.Time `json:"archived_at,omitempty"`         // 封存時間，NULL 表示未封存
+	MarkedUnread   bool       `gorm:"not null" json:"marked_unread"` // 手動標記為未讀，標記已讀時清除
+	Draft          string     `gorm:"type:text;not null" json:"draft"`
+	DraftUpdatedAt *time.Time `json:"draft_updated_at,omitempty"`
+	LastMessageID  uint       `gorm:"not null;default:0" json:"last_message_id"`                               // 主對話最後一則訊息，新訊息寫入時同步更新
+	LastMessageAt  *time.Time `gorm:"index:idx_user_last_message,priority:2" json:"last_message_at,omitempty"` // 最近聊天列表依此排序
+	UnreadCount    int        `gorm:"not null;default:0" json:"unread_count"`                                  // 新訊息寫入時累加，標記已讀時重新計算
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Conversation) TableName() string {
+	return "conversations"
+}
+
+// MutedForever 永久靜音使用的到期時間
+var MutedForever = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// IsMuted 是否在指定時間處於靜音
+func (c *Conversation) IsMuted(now time.Time) bool {
+	return c.MutedUntil != nil && c.MutedUntil.After(now)
+}
+
+// IsArchived 是否封存中；封存後有新訊息時自動回到列表（靜音中的對話除外）
+func (c *Conversation) IsArchived(now time.Time) bool {
+	if c.ArchivedAt == nil {
+		return false
+	}
+	return c.LastMessageAt == nil || !c.LastMessageAt.After(*c.ArchivedAt) || c.IsMuted(now)
+}
+
+// ConversationResponse 對話個人設定響應結構
+type ConversationResponse struct {
+	PeerID         uint       `json:"peer_id,omitempty"`
+	RoomID         uint       `json:"room_id,omitempty"`
+	Muted          bool       `json:"muted"`
+	MutedUntil     *time.Time `json:"muted_until,omitempty"`
+	Pinned         bool       `json:"pinned"`
+	PinnedAt       *time.Time `json:"pinned_at,omitempty"`
+	Archived       bool       `json:"archived"`
+	ArchivedAt     *time.Time `json:"archived_at,omitempty"`
+	MarkedUnread   bool       `json:"marked_unread"`
+	Draft          string     `json:"draft"`
+	DraftUpdatedAt *time.Time `json:"draft_updated_at,omitempty"`
+}
+
+// ToResponse 轉換為響應格式
+func (c *Conversation) ToResponse(now time.Time) ConversationResponse {
+	response := ConversationResponse{
+		PeerID:         c.PeerID,
+		RoomID:         c.RoomID,
+		Muted:          c.IsMuted(now),
+		Pinned:         c.PinnedAt != nil,
+		PinnedAt:       c.PinnedAt,
+		Archived:       c.IsArchived(now),
+		ArchivedAt:     c.ArchivedAt,
+		MarkedUnread:   c.MarkedUnread,
+		Draft:          c.Draft,
+		DraftUpdatedAt: c.DraftUpdatedAt,
+	}
+	if response.Muted {
+		response.MutedUntil = c.MutedUntil
+	}
+	return response
+}
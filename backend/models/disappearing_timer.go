@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// 訊息自動銷毀的計時方式
+const (
+	DisappearAfterRead = "after_read" // 對方讀取後開始計時
+	DisappearAfterSend = "after_send" // 發送後開始計時
+)
+
+// DisappearingTimer 對話的訊息自動銷毀設定，由私訊雙方或聊天室所有成員共用
+// 私訊只存一筆，UserID 為雙方中 ID 較小者、PeerID 為較大者；群組以 RoomID 表示，未使用的欄位為 0
+type DisappearingTimer struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;default:0;uniqueIndex:idx_disappearing_conversation" json:"-"`
+	PeerID    uint      `gorm:"not null;default:0;uniqueIndex:idx_disappearing_conversation" json:"-"`
+	RoomID    uint      `gorm:"not null;default:0;uniqueIndex:idx_disappearing_conversation" json:"room_id,omitempty"`
+	Seconds   int       `gorm:"not null;default:0" json:"seconds"` // 0 表示關閉
+	Mode      string    `gorm:"type:enum('after_read','after_send');default:'after_read';not null" json:"mode"`
+	UpdatedBy uint      `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (DisappearingTimer) TableName() string {
+	return "disappearing_timers"
+}
+
+// Enabled 是否開啟自動銷毀
+func (t *DisappearingTimer) Enabled() bool {
+	return t.Seconds > 0
+}
+
+// DisappearingTimerResponse 訊息自動銷毀設定響應結構
+type DisappearingTimerResponse struct {
+	PeerID    uint       `json:"peer_id,omitempty"` // 以查詢者角度表示的私訊對象
+	RoomID    uint       `json:"room_id,omitempty"`
+	Enabled   bool       `json:"enabled"`
+	Seconds   int        `json:"seconds"`
+	Mode      string     `json:"mode"`
+	UpdatedBy uint       `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// ToResponse 以查詢者角度轉換為響應格式
+func (t *DisappearingTimer) ToResponse(viewerID uint) DisappearingTimerResponse {
+	response := DisappearingTimerResponse{
+		RoomID:    t.RoomID,
+		Enabled:   t.Enabled(),
+		Seconds:   t.Seconds,
+		Mode:      t.Mode,
+		UpdatedBy: t.UpdatedBy,
+	}
+	if t.RoomID == 0 {
+		response.PeerID = t.PeerID
+		if viewerID == t.PeerID {
+			response.PeerID = t.UserID
+		}
+	}
+	if !t.UpdatedAt.IsZero() {
+		response.UpdatedAt = &t.UpdatedAt
+	}
+	return response
+}
@@ -8,21 +8,34 @@ import (
 
 // Message 訊息模型
 type Message struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	SenderID    uint           `gorm:"not null;index:idx_sender_receiver" json:"sender_id"`
-	ReceiverID  uint           `gorm:"not null;index:idx_sender_receiver" json:"receiver_id"`
-	Content     string         `gorm:"type:text;not null" json:"content"`
-	MessageType string         `gorm:"type:enum('text','image','video','file');default:'text'" json:"message_type"`
-	FileURL     string         `gorm:"type:varchar(500)" json:"file_url,omitempty"`
-	FileName    string         `gorm:"type:varchar(255)" json:"file_name,omitempty"`
-	FileSize    int64          `gorm:"type:bigint" json:"file_size,omitempty"`
-	IsRead      bool           `gorm:"default:false;index" json:"is_read"`
-	CreatedAt   time.Time      `gorm:"index" json:"created_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                uint           `gorm:"primaryKey" json:"id"`
+	SenderID          uint           `gorm:"not null;index:idx_sender_receiver;uniqueIndex:idx_sender_client_msg" json:"sender_id"`
+	ReceiverID        *uint          `gorm:"index:idx_sender_receiver" json:"receiver_id,omitempty"` // 私訊接收者（與 RoomID 擇一）
+	RoomID            *uint          `gorm:"index:idx_room_created" json:"room_id,omitempty"`        // 群組聊天室（與 ReceiverID 擇一）
+	ReplyToID         *uint          `gorm:"index" json:"reply_to_id,omitempty"`                     // 回覆的訊息（同一對話）
+	ThreadRootID      *uint          `gorm:"index" json:"thread_root_id,omitempty"`                  // 所屬討論串的根訊息，NULL 表示在主對話中
+	ThreadReplyCount  int            `gorm:"default:0;not null" json:"thread_reply_count"`           // 討論串回覆數（根訊息使用）
+	ThreadLastReplyAt *time.Time     `json:"thread_last_reply_at,omitempty"`                         // 討論串最後回覆時間（根訊息使用）
+	Content           string         `gorm:"type:text;not null;index:idx_messages_content,class:FULLTEXT,option:WITH PARSER ngram" json:"content"`
+	MessageType       string         `gorm:"type:enum('text','image','video','file','system','poll','location','contact');default:'text'" json:"message_type"`
+	FileURL           string         `gorm:"type:varchar(500)" json:"file_url,omitempty"`
+	FileName          string         `gorm:"type:varchar(255)" json:"file_name,omitempty"`
+	FileSize          int64          `gorm:"type:bigint" json:"file_size,omitempty"`
+	Payload           *string        `gorm:"type:json" json:"-"`                                                       // 結構化內容（位置、名片），以 MessagePayload 的 JSON 儲存
+	ClientMsgID       *string        `gorm:"size:64;uniqueIndex:idx_sender_client_msg" json:"client_msg_id,omitempty"` // 客戶端產生的冪等鍵（同一發送者內唯一）
+	IsRead            bool           `gorm:"default:false;index" json:"is_read"`
+	EditedAt          *time.Time     `json:"edited_at,omitempty"`                                   // 最後編輯時間，NULL 表示未編輯
+	RecalledAt        *time.Time     `json:"recalled_at,omitempty"`                                 // 收回時間，收回後內容與檔案皆已清除
+	DisappearSeconds  int            `gorm:"not null;default:0" json:"disappear_seconds,omitempty"` // 發送時對話的自動銷毀秒數，0 表示不會銷毀
+	ExpiresAt         *time.Time     `gorm:"index" json:"expires_at,omitempty"`                     // 到期後永久刪除；讀取後計時的訊息在對方讀取時才設定
+	CreatedAt         time.Time      `gorm:"index;index:idx_room_created" json:"created_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// 關聯
-	Sender   User `gorm:"foreignKey:SenderID" json:"sender,omitempty"`
-	Receiver User `gorm:"foreignKey:ReceiverID" json:"receiver,omitempty"`
+	Sender   User     `gorm:"foreignKey:SenderID" json:"sender,omitempty"`
+	Receiver User     `gorm:"foreignKey:ReceiverID" json:"receiver,omitempty"`
+	Room     ChatRoom `gorm:"foreignKey:RoomID" json:"-"`
+	ReplyTo  *Message `gorm:"foreignKey:ReplyToID;constraint:-" json:"-"` // 不建立外鍵：被回覆的訊息到期刪除後保留引用，預覽顯示為已刪除
 }
 
 // TableName 指定表名
@@ -30,34 +43,188 @@ func (Message) TableName() string {
 	return "messages"
 }
 
+// GetReceiverID 取得私訊接收者 ID，群組訊息回傳 0
+func (m *Message) GetReceiverID() uint {
+	if m.ReceiverID == nil {
+		return 0
+	}
+	return *m.ReceiverID
+}
+
+// GetRoomID 取得群組聊天室 ID，私訊回傳 0
+func (m *Message) GetRoomID() uint {
+	if m.RoomID == nil {
+		return 0
+	}
+	return *m.RoomID
+}
+
+// MessageTypeSystem 系統訊息類型（群組成員異動、設定變更等，由伺服器產生）
+const MessageTypeSystem = "system"
+
+// IsRoomMessage 是否為群組訊息
+func (m *Message) IsRoomMessage() bool {
+	return m.RoomID != nil
+}
+
 // MessageResponse 訊息響應結構
 type MessageResponse struct {
-	ID          uint         `json:"id"`
-	SenderID    uint         `json:"sender_id"`
-	ReceiverID  uint         `json:"receiver_id"`
-	Content     string       `json:"content"`
-	MessageType string       `json:"message_type"`
-	FileURL     string       `json:"file_url,omitempty"`
-	FileName    string       `json:"file_name,omitempty"`
-	FileSize    int64        `json:"file_size,omitempty"`
-	IsRead      bool         `json:"is_read"`
-	CreatedAt   time.Time    `json:"created_at"`
-	Sender      UserResponse `json:"sender,omitempty"`
+	ID                uint              `json:"id"`
+	SenderID          uint              `json:"sender_id"`
+	ReceiverID        uint              `json:"receiver_id,omitempty"`
+	RoomID            uint              `json:"room_id,omitempty"`
+	Content           string            `json:"content"`
+	MessageType       string            `json:"message_type"`
+	FileURL           string            `json:"file_url,omitempty"`
+	FileName          string            `json:"file_name,omitempty"`
+	FileSize          int64             `json:"file_size,omitempty"`
+	ClientMsgID       string            `json:"client_msg_id,omitempty"`
+	ReplyTo           *MessagePreview   `json:"reply_to,omitempty"`
+	ThreadRootID      uint              `json:"thread_root_id,omitempty"`
+	ThreadReplyCount  int               `json:"thread_reply_count,omitempty"`
+	ThreadLastReplyAt *time.Time        `json:"thread_last_reply_at,omitempty"`
+	Reactions         []ReactionSummary `json:"reactions,omitempty"` // 由查詢者角度統計，需另外載入
+	Poll              *PollResponse     `json:"poll,omitempty"`      // 投票訊息的題目與統計，需另外載入
+	Payload           *MessagePayload   `json:"payload,omitempty"`   // 位置與名片訊息的結構化內容
+	IsRead            bool              `json:"is_read"`
+	Edited            bool              `json:"edited"`
+	EditedAt          *time.Time        `json:"edited_at,omitempty"`
+	Recalled          bool              `json:"recalled"`
+	RecalledAt        *time.Time        `json:"recalled_at,omitempty"`
+	DisappearSeconds  int               `json:"disappear_seconds,omitempty"`
+	ExpiresAt         *time.Time        `json:"expires_at,omitempty"`
+	CreatedAt         time.Time         `json:"created_at"`
+	Sender            UserResponse      `json:"sender,omitempty"`
 }
 
 // ToResponse 轉換為響應格式
 func (m *Message) ToResponse() MessageResponse {
-	return MessageResponse{
-		ID:          m.ID,
-		SenderID:    m.SenderID,
-		ReceiverID:  m.ReceiverID,
-		Content:     m.Content,
-		MessageType: m.MessageType,
-		FileURL:     m.FileURL,
-		FileName:    m.FileName,
-		FileSize:    m.FileSize,
-		IsRead:      m.IsRead,
-		CreatedAt:   m.CreatedAt,
-		Sender:      m.Sender.ToResponse(),
+	var clientMsgID string
+	if m.ClientMsgID != nil {
+		clientMsgID = *m.ClientMsgID
+	}
+
+	response := MessageResponse{
+		ID:                m.ID,
+		SenderID:          m.SenderID,
+		ReceiverID:        m.GetReceiverID(),
+		RoomID:            m.GetRoomID(),
+		Content:           m.Content,
+		MessageType:       m.MessageType,
+		FileURL:           m.FileURL,
+		FileName:          m.FileName,
+		FileSize:          m.FileSize,
+		ClientMsgID:       clientMsgID,
+		ThreadReplyCount:  m.ThreadReplyCount,
+		ThreadLastReplyAt: m.ThreadLastReplyAt,
+		Payload:           m.DecodePayload(),
+		IsRead:            m.IsRead,
+		Edited:            m.EditedAt != nil,
+		EditedAt:          m.EditedAt,
+		DisappearSeconds:  m.DisappearSeconds,
+		ExpiresAt:         m.ExpiresAt,
+		CreatedAt:         m.CreatedAt,
+		Sender:            m.Sender.ToResponse(),
+	}
+
+	if m.ThreadRootID != nil {
+		response.ThreadRootID = *m.ThreadRootID
+	}
+
+	// 回覆的訊息需先 Preload ReplyTo.Sender；已刪除的訊息不會被載入
+	if m.ReplyToID != nil {
+		response.ReplyTo = m.replyPreview()
+	}
+
+	// 已收回的訊息只保留墓碑
+	if m.RecalledAt != nil {
+		response.Content = ""
+		response.FileURL = ""
+		response.FileName = ""
+		response.FileSize = 0
+		response.Payload = nil
+		response.Recalled = true
+		response.RecalledAt = m.RecalledAt
+	}
+	return response
+}
+
+// MessagePreviewLength 引用預覽保留的內容字數
+const MessagePreviewLength = 100
+
+// MessagePreview 被回覆訊息的精簡預覽
+type MessagePreview struct {
+	ID          uint         `json:"id"`
+	SenderID    uint         `json:"sender_id,omitempty"`
+	Sender      UserResponse `json:"sender,omitempty"`
+	MessageType string       `json:"message_type,omitempty"`
+	Content     string       `json:"content,omitempty"` // 截斷後的內容
+	FileName    string       `json:"file_name,omitempty"`
+	Deleted     bool         `json:"deleted"` // 原訊息已刪除或已收回
+}
+
+// replyPreview 組合被回覆訊息的預覽
+func (m *Message) replyPreview() *MessagePreview {
+	preview := &MessagePreview{ID: *m.ReplyToID}
+	quoted := m.ReplyTo
+	if quoted == nil || quoted.ID == 0 || quoted.RecalledAt != nil {
+		preview.Deleted = true
+		return preview
+	}
+
+	preview.SenderID = quoted.SenderID
+	preview.Sender = quoted.Sender.ToResponse()
+	preview.MessageType = quoted.MessageType
+	preview.FileName = quoted.FileName
+	preview.Content = truncateRunes(quoted.Content, MessagePreviewLength)
+	return preview
+}
+
+// truncateRunes 依字元數截斷字串，超過時加上省略號
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
 	}
+	return string(runes[:limit]) + "…"
+}
+
+// ThreadFollow 使用者對討論串的追蹤設定（參與討論時自動追蹤，可手動取消）
+type ThreadFollow struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	RootMessageID uint      `gorm:"not null;uniqueIndex:idx_thread_user" json:"root_message_id"`
+	UserID        uint      `gorm:"not null;uniqueIndex:idx_thread_user" json:"user_id"`
+	Following     bool      `gorm:"not null" json:"following"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ThreadFollow) TableName() string {
+	return "thread_follows"
+}
+
+// MessageDeletion 使用者自行刪除（僅對自己隱藏）的訊息
+type MessageDeletion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"not null;uniqueIndex:idx_message_user" json:"message_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_message_user;index" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (MessageDeletion) TableName() string {
+	return "message_deletions"
+}
+
+// MessageEdit 訊息編輯歷史（保存每次編輯前的內容）
+type MessageEdit struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"not null;index" json:"message_id"`
+	Content   string    `gorm:"type:text;not null" json:"content"` // 編輯前的內容
+	CreatedAt time.Time `json:"created_at"`                        // 被取代的時間
+}
+
+// TableName 指定表名
+func (MessageEdit) TableName() string {
+	return "message_edits"
 }
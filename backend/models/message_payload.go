@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 結構化訊息類型，內容存放於 Message.Payload
+const (
+	MessageTypeLocation = "location"
+	MessageTypeContact  = "contact"
+)
+
+// MessagePayload 結構化訊息內容，依訊息類型只會有其中一個欄位
+type MessagePayload struct {
+	Location *LocationPayload `json:"location,omitempty"`
+	Contact  *ContactPayload  `json:"contact,omitempty"`
+}
+
+// LocationPayload 位置訊息
+type LocationPayload struct {
+	Latitude  float64    `json:"latitude"`
+	Longitude float64    `json:"longitude"`
+	Label     string     `json:"label,omitempty"`
+	LiveUntil *time.Time `json:"live_until,omitempty"` // 即時分享結束時間，NULL 表示靜態位置
+	UpdatedAt *time.Time `json:"updated_at,omitempty"` // 即時位置最後更新時間
+}
+
+// IsLive 是否在指定時間仍在即時分享
+func (p *LocationPayload) IsLive(now time.Time) bool {
+	return p.LiveUntil != nil && p.LiveUntil.After(now)
+}
+
+// ContactPayload 名片訊息：分享的使用者資料（發送時的快照）
+type ContactPayload struct {
+	UserID      uint   `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+// Encode 轉換為儲存用的 JSON
+func (p *MessagePayload) Encode() (*string, error) {
+	if p == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	encoded := string(data)
+	return &encoded, nil
+}
+
+// DecodePayload 解析訊息的結構化內容，沒有內容或格式錯誤時回傳 nil
+func (m *Message) DecodePayload() *MessagePayload {
+	if m.Payload == nil || *m.Payload == "" {
+		return nil
+	}
+	var payload MessagePayload
+	if err := json.Unmarshal([]byte(*m.Payload), &payload); err != nil {
+		return nil
+	}
+	return &payload
+}
@@ -0,0 +1,116 @@
+package models
+
+import "time"
+
+// MessageTypePoll 投票訊息類型，訊息內容為投票題目
+const MessageTypePoll = "poll"
+
+// Poll 投票，與投票訊息一對一
+type Poll struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	MessageID      uint       `gorm:"not null;uniqueIndex" json:"message_id"`
+	Question       string     `gorm:"type:varchar(500);not null" json:"question"`
+	MultipleChoice bool       `gorm:"not null" json:"multiple_choice"` // 是否可複選
+	Anonymous      bool       `gorm:"not null" json:"anonymous"`       // 匿名投票不公開投票者
+	ClosesAt       *time.Time `json:"closes_at,omitempty"`             // 截止時間，NULL 表示不截止
+	CreatedAt      time.Time  `json:"created_at"`
+
+	// 關聯
+	Options []PollOption `gorm:"foreignKey:PollID" json:"options,omitempty"`
+}
+
+// TableName 指定表名
+func (Poll) TableName() string {
+	return "polls"
+}
+
+// IsClosed 是否在指定時間已截止
+func (p *Poll) IsClosed(now time.Time) bool {
+	return p.ClosesAt != nil && !p.ClosesAt.After(now)
+}
+
+// PollOption 投票選項
+type PollOption struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	PollID   uint   `gorm:"not null;index" json:"poll_id"`
+	Position int    `gorm:"not null" json:"position"`
+	Text     string `gorm:"type:varchar(255);not null" json:"text"`
+}
+
+// TableName 指定表名
+func (PollOption) TableName() string {
+	return "poll_options"
+}
+
+// PollVote 投票紀錄（複選時每個選項一筆）
+type PollVote struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	PollID    uint      `gorm:"not null;index:idx_poll_user" json:"poll_id"`
+	OptionID  uint      `gorm:"not null;uniqueIndex:idx_option_user" json:"option_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_option_user;index:idx_poll_user" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (PollVote) TableName() string {
+	return "poll_votes"
+}
+
+// PollResponse 投票響應結構（統計以查詢者角度計算）
+type PollResponse struct {
+	ID             uint                 `json:"id"`
+	Question       string               `json:"question"`
+	MultipleChoice bool                 `json:"multiple_choice"`
+	Anonymous      bool                 `json:"anonymous"`
+	ClosesAt       *time.Time           `json:"closes_at,omitempty"`
+	Closed         bool                 `json:"closed"`
+	TotalVoters    int                  `json:"total_voters"`
+	Options        []PollOptionResponse `json:"options"`
+}
+
+// PollOptionResponse 投票選項與得票數
+type PollOptionResponse struct {
+	ID        uint   `json:"id"`
+	Text      string `json:"text"`
+	Votes     int    `json:"votes"`
+	VotedByMe bool   `json:"voted_by_me"`
+	Voters    []uint `json:"voters,omitempty"` // 記名投票才會列出投票者
+}
+
+// ToResponse 以查詢者角度統計投票結果（需先 Preload Options，votes 為此投票的所有紀錄）
+func (p *Poll) ToResponse(votes []PollVote, viewerID uint, now time.Time) PollResponse {
+	response := PollResponse{
+		ID:             p.ID,
+		Question:       p.Question,
+		MultipleChoice: p.MultipleChoice,
+		Anonymous:      p.Anonymous,
+		ClosesAt:       p.ClosesAt,
+		Closed:         p.IsClosed(now),
+		Options:        make([]PollOptionResponse, 0, len(p.Options)),
+	}
+
+	index := make(map[uint]int, len(p.Options))
+	for i, option := range p.Options {
+		index[option.ID] = i
+		response.Options = append(response.Options, PollOptionResponse{ID: option.ID, Text: option.Text})
+	}
+
+	voters := make(map[uint]struct{})
+	for _, vote := range votes {
+		i, ok := index[vote.OptionID]
+		if !ok {
+			continue
+		}
+		option := &response.Options[i]
+		option.Votes++
+		if vote.UserID == viewerID {
+			option.VotedByMe = true
+		}
+		if !p.Anonymous {
+			option.Voters = append(option.Voters, vote.UserID)
+		}
+		voters[vote.UserID] = struct{}{}
+	}
+	response.TotalVoters = len(voters)
+	return response
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// UserPresence 使用者自訂在線狀態
+type UserPresence struct {
+	UserID          uint       `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	Status          string     `gorm:"type:enum('online','away','busy','invisible');default:'online';not null" json:"status"`
+	StatusText      string     `gorm:"size:140" json:"status_text"`
+	StatusExpiresAt *time.Time `gorm:"index" json:"status_expires_at"` // 到期後狀態恢復為 online 並清除狀態文字
+	Idle            bool       `gorm:"default:false" json:"idle"`      // 客戶端閒置自動判定
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (UserPresence) TableName() string {
+	return "user_presences"
+}
+
+// 在線狀態常數
+const (
+	PresenceOnline    = "online"
+	PresenceAway      = "away"
+	PresenceBusy      = "busy"
+	PresenceInvisible = "invisible"
+	PresenceOffline   = "offline" // 僅用於顯示，未連線或隱身時
+)
+
+// PresenceResponse 他人看到的在線狀態（隱身時顯示為 offline）
+type PresenceResponse struct {
+	UserID          uint       `json:"user_id"`
+	Status          string     `json:"status"` // online, away, busy, offline
+	StatusText      string     `json:"status_text,omitempty"`
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty"`
+	IsOnline        bool       `json:"is_online"`
+	LastSeenAt      *time.Time `json:"last_seen_at,omitempty"`
+}
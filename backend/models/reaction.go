@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// MessageReaction 訊息的表情回應（每位使用者對同一則訊息的同一個表情只能回應一次）
+type MessageReaction struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"not null;uniqueIndex:idx_message_user_emoji" json:"message_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_message_user_emoji" json:"user_id"`
+	Emoji     string    `gorm:"type:varchar(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;not null;uniqueIndex:idx_message_user_emoji" json:"emoji"` // 二進位排序，避免不同表情被視為相同
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (MessageReaction) TableName() string {
+	return "message_reactions"
+}
+
+// ReactionSummary 訊息某個表情的回應統計
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int64  `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// ReadWatermark 使用者在對話中的已讀位置（已讀到哪一則訊息，只會前進）
+// 私訊以 PeerID 表示對話另一方，群組以 RoomID 表示聊天室，未使用的欄位為 0 以便建立唯一索引
+type ReadWatermark struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	UserID            uint      `gorm:"not null;uniqueIndex:idx_read_conversation" json:"user_id"`
+	PeerID            uint      `gorm:"not null;default:0;uniqueIndex:idx_read_conversation" json:"peer_id,omitempty"`
+	RoomID            uint      `gorm:"not null;default:0;uniqueIndex:idx_read_conversation;index" json:"room_id,omitempty"`
+	LastReadMessageID uint      `gorm:"not null;default:0" json:"last_read_message_id"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ReadWatermark) TableName() string {
+	return "read_watermarks"
+}
+
+// MessageReadStatus 訊息在對話成員間的已讀狀態
+type MessageReadStatus struct {
+	MessageID uint           `json:"message_id"`
+	ReadBy    []UserResponse `json:"read_by"`
+	UnreadBy  []UserResponse `json:"unread_by"`
+}
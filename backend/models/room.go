@@ -27,10 +27,12 @@ func (ChatRoom) TableName() string {
 
 // RoomMember 聊天室成員模型
 type RoomMember struct {
-	ID       uint      `gorm:"primaryKey" json:"id"`
-	RoomID   uint      `gorm:"not null;uniqueIndex:idx_room_user" json:"room_id"`
-	UserID   uint      `gorm:"not null;uniqueIndex:idx_room_user" json:"user_id"`
-	JoinedAt time.Time `json:"joined_at"`
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	RoomID     uint       `gorm:"not null;uniqueIndex:idx_room_user" json:"room_id"`
+	UserID     uint       `gorm:"not null;uniqueIndex:idx_room_user" json:"user_id"`
+	Role       string     `gorm:"type:enum('owner','admin','member');default:'member';not null" json:"role"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"` // 禁言到期時間，NULL 表示未禁言
+	JoinedAt   time.Time  `json:"joined_at"`
 
 	// 關聯
 	Room ChatRoom `gorm:"foreignKey:RoomID" json:"room,omitempty"`
@@ -41,3 +43,63 @@ type RoomMember struct {
 func (RoomMember) TableName() string {
 	return "room_members"
 }
+
+// 聊天室成員角色常數
+const (
+	RoomRoleOwner  = "owner"
+	RoomRoleAdmin  = "admin"
+	RoomRoleMember = "member"
+)
+
+// IsMuted 檢查成員目前是否被禁言
+func (m *RoomMember) IsMuted(now time.Time) bool {
+	return m.MutedUntil != nil && m.MutedUntil.After(now)
+}
+
+// RoomMemberResponse 聊天室成員響應結構
+type RoomMemberResponse struct {
+	UserResponse
+	Role       string     `json:"role"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
+	JoinedAt   time.Time  `json:"joined_at"`
+}
+
+// ToResponse 轉換為響應格式（需先 Preload User）
+func (m *RoomMember) ToResponse() RoomMemberResponse {
+	response := RoomMemberResponse{
+		UserResponse: m.User.ToResponse(),
+		Role:         m.Role,
+		JoinedAt:     m.JoinedAt,
+	}
+	if m.IsMuted(time.Now()) {
+		response.MutedUntil = m.MutedUntil
+	}
+	return response
+}
+
+// ChatRoomResponse 聊天室響應結構
+type ChatRoomResponse struct {
+	ID          uint                 `json:"id"`
+	Name        string               `json:"name"`
+	CreatedBy   uint                 `json:"created_by"`
+	MemberCount int                  `json:"member_count"`
+	Members     []RoomMemberResponse `json:"members,omitempty"`
+	CreatedAt   time.Time            `json:"created_at"`
+}
+
+// ToResponse 轉換為響應格式（需先 Preload Members.User 才會包含成員資料）
+func (r *ChatRoom) ToResponse() ChatRoomResponse {
+	response := ChatRoomResponse{
+		ID:          r.ID,
+		Name:        r.Name,
+		CreatedBy:   r.CreatedBy,
+		MemberCount: len(r.Members),
+		CreatedAt:   r.CreatedAt,
+	}
+	for _, member := range r.Members {
+		if member.User.ID != 0 {
+			response.Members = append(response.Members, member.ToResponse())
+		}
+	}
+	return response
+}
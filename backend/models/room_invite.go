@@ -0,0 +1,140 @@
+package models
+
+import "time"
+
+// RoomInvite 聊天室邀請連結
+type RoomInvite struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	RoomID          uint       `gorm:"not null;index" json:"room_id"`
+	Code            string     `gorm:"size:32;not null;uniqueIndex" json:"code"`
+	CreatedBy       uint       `gorm:"not null" json:"created_by"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`               // NULL 表示永不過期
+	MaxUses         int        `gorm:"default:0;not null" json:"max_uses"` // 0 表示不限次數
+	UseCount        int        `gorm:"default:0;not null" json:"use_count"`
+	RequireApproval bool       `gorm:"default:false" json:"require_approval"` // 加入前需管理員審核
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+
+	// 關聯
+	Room    ChatRoom         `gorm:"foreignKey:RoomID" json:"-"`
+	Creator User             `gorm:"foreignKey:CreatedBy" json:"-"`
+	Joins   []RoomInviteJoin `gorm:"foreignKey:InviteID" json:"-"`
+}
+
+// TableName 指定表名
+func (RoomInvite) TableName() string {
+	return "room_invites"
+}
+
+// IsUsable 檢查邀請連結目前是否可使用
+func (i *RoomInvite) IsUsable(now time.Time) bool {
+	if i.RevokedAt != nil {
+		return false
+	}
+	if i.ExpiresAt != nil && !i.ExpiresAt.After(now) {
+		return false
+	}
+	return i.MaxUses == 0 || i.UseCount < i.MaxUses
+}
+
+// RoomInviteJoin 透過邀請連結加入（或申請加入）聊天室的記錄
+type RoomInviteJoin struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	InviteID   uint       `gorm:"not null;index" json:"invite_id"`
+	RoomID     uint       `gorm:"not null;index:idx_room_join_status" json:"room_id"`
+	UserID     uint       `gorm:"not null" json:"user_id"`
+	Status     string     `gorm:"type:enum('pending','approved','rejected');default:'pending';index:idx_room_join_status" json:"status"`
+	ReviewedBy *uint      `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// 關聯
+	Invite RoomInvite `gorm:"foreignKey:InviteID" json:"-"`
+	User   User       `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// TableName 指定表名
+func (RoomInviteJoin) TableName() string {
+	return "room_invite_joins"
+}
+
+// 加入申請狀態常數
+const (
+	InviteJoinPending  = "pending"
+	InviteJoinApproved = "approved"
+	InviteJoinRejected = "rejected"
+)
+
+// RoomInviteResponse 邀請連結響應結構（管理員檢視）
+type RoomInviteResponse struct {
+	ID              uint                     `json:"id"`
+	RoomID          uint                     `json:"room_id"`
+	Code            string                   `json:"code"`
+	CreatedBy       uint                     `json:"created_by"`
+	ExpiresAt       *time.Time               `json:"expires_at,omitempty"`
+	MaxUses         int                      `json:"max_uses"`
+	UseCount        int                      `json:"use_count"`
+	RequireApproval bool                     `json:"require_approval"`
+	Revoked         bool                     `json:"revoked"`
+	Usable          bool                     `json:"usable"`
+	CreatedAt       time.Time                `json:"created_at"`
+	Joins           []RoomInviteJoinResponse `json:"joins,omitempty"`
+}
+
+// ToResponse 轉換為響應格式（Preload Joins.User 時包含加入記錄）
+func (i *RoomInvite) ToResponse() RoomInviteResponse {
+	response := RoomInviteResponse{
+		ID:              i.ID,
+		RoomID:          i.RoomID,
+		Code:            i.Code,
+		CreatedBy:       i.CreatedBy,
+		ExpiresAt:       i.ExpiresAt,
+		MaxUses:         i.MaxUses,
+		UseCount:        i.UseCount,
+		RequireApproval: i.RequireApproval,
+		Revoked:         i.RevokedAt != nil,
+		Usable:          i.IsUsable(time.Now()),
+		CreatedAt:       i.CreatedAt,
+	}
+	for _, join := range i.Joins {
+		response.Joins = append(response.Joins, join.ToResponse())
+	}
+	return response
+}
+
+// RoomInviteJoinResponse 加入記錄響應結構
+type RoomInviteJoinResponse struct {
+	ID         uint         `json:"id"`
+	InviteID   uint         `json:"invite_id"`
+	RoomID     uint         `json:"room_id"`
+	User       UserResponse `json:"user"`
+	Status     string       `json:"status"`
+	ReviewedBy *uint        `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time   `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// ToResponse 轉換為響應格式（需先 Preload User）
+func (j *RoomInviteJoin) ToResponse() RoomInviteJoinResponse {
+	return RoomInviteJoinResponse{
+		ID:         j.ID,
+		InviteID:   j.InviteID,
+		RoomID:     j.RoomID,
+		User:       j.User.ToResponse(),
+		Status:     j.Status,
+		ReviewedBy: j.ReviewedBy,
+		ReviewedAt: j.ReviewedAt,
+		CreatedAt:  j.CreatedAt,
+	}
+}
+
+// RoomInvitePreview 以邀請碼預覽聊天室（尚未加入的使用者檢視）
+type RoomInvitePreview struct {
+	RoomID          uint       `json:"room_id"`
+	RoomName        string     `json:"room_name"`
+	MemberCount     int64      `json:"member_count"`
+	RequireApproval bool       `json:"require_approval"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	IsMember        bool       `json:"is_member"`
+	Pending         bool       `json:"pending"` // 已送出加入申請，等待審核
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// 排程訊息狀態
+const (
+	ScheduledPending  = "pending"  // 等待發送
+	ScheduledSending  = "sending"  // 排程器已取得，發送中
+	ScheduledSent     = "sent"     // 已發送
+	ScheduledFailed   = "failed"   // 發送失敗（例如已不是好友或已退出聊天室）
+	ScheduledCanceled = "canceled" // 使用者已取消
+)
+
+// ScheduledMessage 排程訊息，到期時由排程器透過一般發送流程送出
+type ScheduledMessage struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	SenderID    uint       `gorm:"not null;index" json:"sender_id"`
+	ReceiverID  *uint      `json:"receiver_id,omitempty"` // 私訊接收者（與 RoomID 擇一）
+	RoomID      *uint      `json:"room_id,omitempty"`     // 群組聊天室
+	ReplyToID   *uint      `json:"reply_to_id,omitempty"`
+	Content     string     `gorm:"type:text;not null" json:"content"`
+	MessageType string     `gorm:"type:enum('text','image','video','file');default:'text'" json:"message_type"`
+	FileURL     string     `gorm:"type:varchar(500)" json:"file_url,omitempty"`
+	FileName    string     `gorm:"type:varchar(255)" json:"file_name,omitempty"`
+	FileSize    int64      `gorm:"type:bigint" json:"file_size,omitempty"`
+	ScheduledAt time.Time  `gorm:"not null;index:idx_scheduled_status_at,priority:2" json:"scheduled_at"`
+	Status      string     `gorm:"type:enum('pending','sending','sent','failed','canceled');default:'pending';index:idx_scheduled_status_at,priority:1" json:"status"`
+	ClaimedAt   *time.Time `json:"-"`                    // 排程器取得的時間，用於回收中斷的發送
+	MessageID   *uint      `json:"message_id,omitempty"` // 發送後的訊息
+	Error       string     `gorm:"type:varchar(255)" json:"error,omitempty"`
+	SentAt      *time.Time `json:"sent_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ScheduledMessage) TableName() string {
+	return "scheduled_messages"
+}
+
+// ScheduledClientMsgPrefix 排程訊息冪等鍵的保留前綴，客戶端不能使用
+const ScheduledClientMsgPrefix = "scheduled-"
+
+// ClientMsgID 排程訊息發送時使用的冪等鍵，重試時不會重複建立訊息
+func (s *ScheduledMessage) ClientMsgID() string {
+	return fmt.Sprintf("%s%d", ScheduledClientMsgPrefix, s.ID)
+}
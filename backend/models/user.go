@@ -14,6 +14,7 @@ type User struct {
 	Password    string         `gorm:"not null;size:255" json:"-"` // 不回傳到前端
 	DisplayName string         `gorm:"size:50" json:"display_name,omitempty"`
 	AvatarURL   string         `gorm:"size:255" json:"avatar_url,omitempty"`
+	LastSeenAt  *time.Time     `json:"-"` // 最後一次斷線時間，僅提供給好友
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
@@ -45,3 +46,13 @@ func (u *User) ToResponse() UserResponse {
 		CreatedAt:   u.CreatedAt,
 	}
 }
+
+// FriendPresenceResponse 好友響應結構（含在線狀態）
+type FriendPresenceResponse struct {
+	UserResponse
+	Status          string     `json:"status"` // online, away, busy, offline
+	StatusText      string     `json:"status_text,omitempty"`
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty"`
+	IsOnline        bool       `json:"is_online"`
+	LastSeenAt      *time.Time `json:"last_seen_at,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// UserEvent 使用者事件紀錄（WebSocket 斷線重連時用於補發遺漏的事件）
+type UserEvent struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_user_seq" json:"user_id"`
+	Seq       uint64    `gorm:"not null;uniqueIndex:idx_user_seq" json:"seq"`
+	Type      string    `gorm:"size:50;not null" json:"type"`
+	Payload   string    `gorm:"type:mediumtext;not null" json:"payload"` // 已編碼的 WebSocket 訊息
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (UserEvent) TableName() string {
+	return "user_events"
+}
+
+// UserEventCursor 使用者目前的事件序號（單調遞增）
+type UserEventCursor struct {
+	UserID  uint   `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	LastSeq uint64 `gorm:"not null;default:0" json:"last_seq"`
+}
+
+// TableName 指定表名
+func (UserEventCursor) TableName() string {
+	return "user_event_cursors"
+}
@@ -39,7 +39,7 @@ func SetupRoutes(r *gin.Engine, hub *services.Hub) {
 			auth.PUT("/password", controllers.UpdatePassword)
 
 			// 好友相關
-			auth.GET("/friends", controllers.GetFriends)
+			auth.GET("/friends", controllers.GetFriends(hub))
 			auth.GET("/friends/requests", controllers.GetFriendRequests)
 			auth.GET("/friends/sent", controllers.GetSentFriendRequests)
 			auth.POST("/friends/request", controllers.SendFriendRequest(hub))
@@ -50,14 +50,74 @@ func SetupRoutes(r *gin.Engine, hub *services.Hub) {
 			// 聊天訊息
 			auth.GET("/chat/:friendId/messages", controllers.GetMessages)
 			auth.GET("/chat/recent", controllers.GetRecentChats)
-			auth.POST("/chat/send", controllers.SendMessage)
+			auth.POST("/chat/send", controllers.SendMessage(hub))
 			auth.POST("/chat/upload", controllers.UploadFile)
-			auth.PUT("/messages/:id/read", controllers.MarkAsRead)
+			auth.PUT("/chat/:friendId/read", controllers.MarkChatRead(hub))
+			auth.GET("/chat/:friendId/conversation", controllers.GetChatConversation)
+			auth.PUT("/chat/:friendId/conversation", controllers.UpdateChatConversation(hub))
+			auth.GET("/chat/:friendId/disappearing", controllers.GetChatDisappearingTimer)
+			auth.PUT("/chat/:friendId/disappearing", controllers.UpdateChatDisappearingTimer(hub))
+			auth.PUT("/messages/:id/read", controllers.MarkAsRead(hub))
+			auth.GET("/messages/:id/reads", controllers.GetMessageReads)
+			auth.POST("/messages/:id/votes", controllers.VotePoll(hub))
+			auth.DELETE("/messages/:id/votes", controllers.RetractPollVote(hub))
+			auth.POST("/messages/:id/location/stop", controllers.StopLiveLocation(hub))
+			auth.POST("/messages/:id/contact/friend-request", controllers.RequestContactFriend(hub))
+			auth.PUT("/messages/:id", controllers.EditMessage(hub))
+			auth.GET("/messages/:id/edits", controllers.GetMessageEdits)
+			auth.DELETE("/messages/:id", controllers.DeleteMessageForMe)
+			auth.POST("/messages/:id/recall", controllers.RecallMessage(hub))
+			auth.POST("/messages/:id/reactions", controllers.AddReaction(hub))
+			auth.DELETE("/messages/:id/reactions/:emoji", controllers.RemoveReaction(hub))
+			auth.GET("/messages/:id/thread", controllers.GetThread)
+			auth.POST("/messages/:id/thread", controllers.SendThreadReply(hub))
+			auth.PUT("/messages/:id/thread/follow", controllers.FollowThread)
+			auth.DELETE("/messages/:id/thread/follow", controllers.UnfollowThread)
 			auth.GET("/messages/unread", controllers.GetUnreadCount)
 
+			// 訊息搜尋
+			auth.GET("/search/messages", controllers.SearchMessages)
+
+			// 排程訊息
+			auth.POST("/scheduled-messages", controllers.CreateScheduledMessage)
+			auth.GET("/scheduled-messages", controllers.GetScheduledMessages)
+			auth.PUT("/scheduled-messages/:id", controllers.UpdateScheduledMessage)
+			auth.DELETE("/scheduled-messages/:id", controllers.CancelScheduledMessage)
+
+			// 群組聊天室
+			auth.POST("/rooms", controllers.CreateRoom(hub))
+			auth.GET("/rooms", controllers.GetRooms)
+			auth.GET("/rooms/:id", controllers.GetRoom)
+			auth.PUT("/rooms/:id", controllers.UpdateRoom(hub))
+			auth.POST("/rooms/:id/transfer", controllers.TransferRoom(hub))
+			auth.POST("/rooms/:id/members", controllers.AddRoomMembers(hub))
+			auth.DELETE("/rooms/:id/members/:userId", controllers.RemoveRoomMember(hub))
+			auth.PUT("/rooms/:id/members/:userId/role", controllers.SetRoomMemberRole(hub))
+			auth.PUT("/rooms/:id/members/:userId/mute", controllers.MuteRoomMember(hub))
+			auth.GET("/rooms/:id/messages", controllers.GetRoomMessages)
+			auth.PUT("/rooms/:id/read", controllers.MarkRoomRead(hub))
+			auth.GET("/rooms/:id/conversation", controllers.GetRoomConversation)
+			auth.PUT("/rooms/:id/conversation", controllers.UpdateRoomConversation(hub))
+			auth.GET("/rooms/:id/disappearing", controllers.GetRoomDisappearingTimer)
+			auth.PUT("/rooms/:id/disappearing", controllers.UpdateRoomDisappearingTimer(hub))
+			auth.POST("/rooms/:id/messages", controllers.SendRoomMessage(hub))
+			auth.DELETE("/rooms/:id/messages/:messageId", controllers.DeleteRoomMessage(hub))
+
+			// 聊天室邀請連結
+			auth.POST("/rooms/:id/invites", controllers.CreateRoomInvite)
+			auth.GET("/rooms/:id/invites", controllers.GetRoomInvites)
+			auth.DELETE("/rooms/:id/invites/:inviteId", controllers.RevokeRoomInvite)
+			auth.GET("/rooms/:id/join-requests", controllers.GetRoomJoinRequests)
+			auth.POST("/rooms/:id/join-requests/:requestId/approve", controllers.ApproveRoomJoinRequest(hub))
+			auth.POST("/rooms/:id/join-requests/:requestId/reject", controllers.RejectRoomJoinRequest(hub))
+			auth.GET("/invites/:code", controllers.PreviewRoomInvite)
+			auth.POST("/invites/:code/join", controllers.JoinRoomByInvite(hub))
+
 			// 在線狀態查詢
 			auth.GET("/online/users", controllers.GetOnlineUsers(hub))
 			auth.GET("/online/check/:userId", controllers.CheckUserOnline(hub))
+			auth.GET("/presence", controllers.GetMyPresence)
+			auth.PUT("/presence", controllers.UpdatePresence(hub))
 		}
 	}
 
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// Broker 跨實例訊息代理，讓多個後端實例共享 WebSocket 推送
+type Broker interface {
+	// Publish 發布訊息到指定頻道
+	Publish(channel string, payload []byte) error
+
+	// Subscribe 訂閱指定頻道，收到訊息時呼叫 handler
+	Subscribe(channel string, handler func(payload []byte)) error
+
+	// Close 關閉代理連線
+	Close() error
+}
+
+// hubChannel Hub 之間交換推送訊息的頻道
+const hubChannel = "easychat:hub"
+
+// brokerEnvelope 透過 Broker 傳遞的推送訊息
+type brokerEnvelope struct {
+	Origin  string          `json:"origin"`   // 發布訊息的實例 ID
+	UserIDs []uint          `json:"user_ids"` // 目標使用者
+	Payload json.RawMessage `json:"payload"`  // 已編碼的 WebSocket 訊息
+}
+
+// publish 將已在本實例推送的訊息發布給其他實例
+func (h *Hub) publish(envelope brokerEnvelope) {
+	if h.Broker == nil {
+		return
+	}
+
+	envelope.Origin = h.InstanceID
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		log.Printf("❌ 推送訊息編碼失敗: %v", err)
+		return
+	}
+
+	if err := h.Broker.Publish(hubChannel, data); err != nil {
+		log.Printf("❌ 發布跨實例推送訊息失敗: %v", err)
+	}
+}
+
+// handleBrokerMessage 處理其他實例發布的推送訊息，只推送給本實例的連線
+func (h *Hub) handleBrokerMessage(payload []byte) {
+	var envelope brokerEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		log.Printf("❌ 跨實例推送訊息解碼失敗: %v", err)
+		return
+	}
+
+	// 自己發布的訊息已在本地推送過
+	if envelope.Origin == h.InstanceID {
+		return
+	}
+
+	for _, userID := range envelope.UserIDs {
+		h.deliverToUser(userID, envelope.Payload)
+	}
+}
+
+// MemoryBroker 單一行程內的訊息代理（單機部署與測試用）
+// 多個 Hub 共用同一個 MemoryBroker 即可模擬多實例部署
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	handlers map[string][]func(payload []byte)
+}
+
+// NewMemoryBroker 建立記憶體訊息代理
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		handlers: make(map[string][]func(payload []byte)),
+	}
+}
+
+// Publish 同步呼叫該頻道所有訂閱者
+func (b *MemoryBroker) Publish(channel string, payload []byte) error {
+	b.mu.RLock()
+	handlers := append([]func(payload []byte){}, b.handlers[channel]...)
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+	return nil
+}
+
+// Subscribe 訂閱頻道
+func (b *MemoryBroker) Subscribe(channel string, handler func(payload []byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[channel] = append(b.handlers[channel], handler)
+	return nil
+}
+
+// Close 清除所有訂閱
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = make(map[string][]func(payload []byte))
+	return nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryBrokerPublishSubscribe(t *testing.T) {
+	broker := NewMemoryBroker()
+
+	first, second, other := newReceiver(), newReceiver(), newReceiver()
+	broker.Subscribe("chat", first.handle)
+	broker.Subscribe("chat", second.handle)
+	broker.Subscribe("other", other.handle)
+
+	if err := broker.Publish("chat", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	first.expect(t, "hello")
+	second.expect(t, "hello")
+	other.expectNone(t)
+}
+
+func TestMemoryBrokerClose(t *testing.T) {
+	broker := NewMemoryBroker()
+	received := newReceiver()
+	broker.Subscribe("chat", received.handle)
+
+	broker.Close()
+	broker.Publish("chat", []byte("ignored"))
+	received.expectNone(t)
+}
+
+// newTestHub 建立訂閱共用代理的 Hub，多個 Hub 共用同一個 MemoryBroker 即為多實例部署
+func newTestHub(t *testing.T, broker Broker) *Hub {
+	t.Helper()
+	hub := NewHub()
+	hub.Broker = broker
+	if err := broker.Subscribe(hubChannel, hub.handleBrokerMessage); err != nil {
+		t.Fatal(err)
+	}
+	return hub
+}
+
+// attachTestClient 直接在 Hub 上登記一個連線（不經過 WebSocket）
+func attachTestClient(hub *Hub, userID uint, sessionID string) *Client {
+	client := &Client{Hub: hub, UserID: userID, SessionID: sessionID, Send: make(chan []byte, 16)}
+	hub.mu.Lock()
+	if hub.Clients[userID] == nil {
+		hub.Clients[userID] = make(map[string]*Client)
+	}
+	hub.Clients[userID][sessionID] = client
+	hub.mu.Unlock()
+	return client
+}
+
+func expectFrames(t *testing.T, client *Client, want int) {
+	t.Helper()
+	for i := 0; i < want; i++ {
+		select {
+		case <-client.Send:
+		case <-time.After(time.Second):
+			t.Fatalf("連線 %s 只收到 %d 則訊息，預期 %d 則", client.SessionID, i, want)
+		}
+	}
+	select {
+	case frame := <-client.Send:
+		t.Fatalf("連線 %s 收到多餘的訊息 %s", client.SessionID, frame)
+	default:
+	}
+}
+
+func TestHubDeliversAcrossInstances(t *testing.T) {
+	broker := NewMemoryBroker()
+	a := newTestHub(t, broker)
+	b := newTestHub(t, broker)
+
+	onA := attachTestClient(a, 7, "phone")
+	onB := attachTestClient(b, 7, "laptop")
+	stranger := attachTestClient(b, 8, "laptop")
+
+	a.sendEphemeral([]uint{7}, &Message{Type: "typing", SenderID: 1, ReceiverID: 7})
+
+	// 本實例直接推送，其他實例透過代理推送，發布的實例不會重複推送
+	expectFrames(t, onA, 1)
+	expectFrames(t, onB, 1)
+	expectFrames(t, stranger, 0)
+}
+
+func TestHubIgnoresMalformedBrokerMessage(t *testing.T) {
+	broker := NewMemoryBroker()
+	hub := newTestHub(t, broker)
+	client := attachTestClient(hub, 7, "phone")
+
+	broker.Publish(hubChannel, []byte("not json"))
+	expectFrames(t, client, 0)
+}
@@ -1,3 +1,510 @@
 package services
 
-// Chat service - 將在第二階段實作
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Chat service - 訊息發送的共用業務邏輯（REST API 與 WebSocket 共用）
+
+// 訊息發送錯誤
+var (
+	ErrInvalidMessageType  = errors.New("無效的訊息類型")
+	ErrEmptyContent        = errors.New("訊息內容不能為空")
+	ErrReceiverNotFound    = errors.New("接收者不存在")
+	ErrSendToSelf          = errors.New("不能發訊息給自己")
+	ErrNotFriend           = errors.New("只能發訊息給好友")
+	ErrInvalidClientMsgID  = errors.New("client_msg_id 長度不能超過 64 個字元")
+	ErrReservedClientMsgID = errors.New("client_msg_id 不能以 " + models.ScheduledClientMsgPrefix + " 開頭")
+	ErrMissingTarget       = errors.New("必須指定 receiver_id 或 room_id（擇一）")
+	ErrInvalidReplyTo      = errors.New("回覆的訊息不存在或不屬於此對話")
+	ErrInvalidFileURL      = errors.New("附件必須是自己上傳的檔案")
+)
+
+// SendMessageParams 發送訊息參數
+type SendMessageParams struct {
+	SenderID     uint
+	ReceiverID   uint // 私訊接收者
+	RoomID       uint // 群組聊天室（與 ReceiverID 擇一）
+	Content      string
+	MessageType  string
+	FileURL      string
+	FileName     string
+	FileSize     int64
+	ClientMsgID  string                  // 客戶端冪等鍵，重送時用於去重
+	ReplyToID    uint                    // 回覆的訊息（需屬於同一對話）
+	ThreadRootID uint                    // 討論串根訊息（需屬於同一對話），0 表示發送到主對話
+	Poll         *PollParams             // 投票內容（message_type 為 poll 時必填）
+	Location     *models.LocationPayload // 位置（message_type 為 location 時必填）
+	Contact      *models.ContactPayload  // 名片，只需填 UserID（message_type 為 contact 時必填）
+
+	scheduled bool // 由排程器發送，可使用排程訊息保留的冪等鍵前綴
+}
+
+// IsValidMessageType 檢查訊息類型是否有效
+func IsValidMessageType(messageType string) bool {
+	switch messageType {
+	case "text", "image", "video", "file", models.MessageTypePoll, models.MessageTypeLocation, models.MessageTypeContact:
+		return true
+	}
+	return false
+}
+
+// AreFriends 檢查兩位使用者是否為已接受的好友
+func AreFriends(userID, otherID uint) bool {
+	var count int64
+	config.DB.Model(&models.Friendship{}).Where(
+		"((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)) AND status = ?",
+		userID, otherID, otherID, userID, models.FriendshipStatusAccepted,
+	).Count(&count)
+	return count > 0
+}
+
+// FriendIDs 取得使用者所有已接受好友的 ID
+func FriendIDs(userID uint) []uint {
+	var friendships []models.Friendship
+	config.DB.Where("(user_id = ? OR friend_id = ?) AND status = ?",
+		userID, userID, models.FriendshipStatusAccepted).
+		Find(&friendships)
+
+	ids := make([]uint, 0, len(friendships))
+	for _, friendship := range friendships {
+		if friendship.UserID == userID {
+			ids = append(ids, friendship.FriendID)
+		} else {
+			ids = append(ids, friendship.UserID)
+		}
+	}
+	return ids
+}
+
+// WithMessageRelations 查詢條件：載入訊息的發送者與被回覆訊息的預覽資料
+func WithMessageRelations(db *gorm.DB) *gorm.DB {
+	return db.Preload("Sender").Preload("ReplyTo.Sender")
+}
+
+// findByClientMsgID 依發送者與客戶端冪等鍵查找已儲存的訊息
+func findByClientMsgID(senderID uint, clientMsgID string) (*models.Message, bool) {
+	var message models.Message
+	if err := config.DB.Scopes(WithMessageRelations).
+		Where("sender_id = ? AND client_msg_id = ?", senderID, clientMsgID).
+		First(&message).Error; err != nil {
+		return nil, false
+	}
+	return &message, true
+}
+
+// SaveMessageToDB 驗證並將訊息儲存到資料庫，回傳已載入發送者資訊的訊息
+// 若 ClientMsgID 已存在則直接回傳先前儲存的訊息，duplicate 為 true
+func SaveMessageToDB(params SendMessageParams) (message *models.Message, duplicate bool, err error) {
+	if len(params.ClientMsgID) > 64 {
+		return nil, false, ErrInvalidClientMsgID
+	}
+	if !params.scheduled && strings.HasPrefix(params.ClientMsgID, models.ScheduledClientMsgPrefix) {
+		return nil, false, ErrReservedClientMsgID
+	}
+
+	// 重送的訊息直接回傳已儲存的版本
+	if params.ClientMsgID != "" {
+		if existing, ok := findByClientMsgID(params.SenderID, params.ClientMsgID); ok {
+			return existing, true, nil
+		}
+	}
+
+	if err := validateSendParams(&params); err != nil {
+		return nil, false, err
+	}
+
+	// 建立訊息
+	created := models.Message{
+		SenderID:    params.SenderID,
+		Content:     params.Content,
+		MessageType: params.MessageType,
+		FileURL:     params.FileURL,
+		FileName:    params.FileName,
+		FileSize:    params.FileSize,
+		IsRead:      false,
+	}
+	if params.RoomID != 0 {
+		created.RoomID = &params.RoomID
+	} else {
+		created.ReceiverID = &params.ReceiverID
+	}
+	if params.ReplyToID != 0 {
+		created.ReplyToID = &params.ReplyToID
+	}
+	if params.ThreadRootID != 0 {
+		created.ThreadRootID = &params.ThreadRootID
+	}
+	if params.ClientMsgID != "" {
+		created.ClientMsgID = &params.ClientMsgID
+	}
+	if created.Payload, err = encodePayload(params); err != nil {
+		return nil, false, err
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyDisappearingTimer(tx, &created); err != nil {
+			return err
+		}
+		if err := tx.Create(&created).Error; err != nil {
+			return err
+		}
+		if params.Poll != nil {
+			if err := createPoll(tx, created.ID, params.Poll); err != nil {
+				return err
+			}
+		}
+		if params.ThreadRootID != 0 {
+			return recordThreadReply(tx, &created)
+		}
+		return recordConversationMessage(tx, &created)
+	})
+	if err != nil {
+		// 並發重送時由唯一索引擋下，改回傳先寫入的那一筆
+		if params.ClientMsgID != "" {
+			if existing, ok := findByClientMsgID(params.SenderID, params.ClientMsgID); ok {
+				return existing, true, nil
+			}
+		}
+		return nil, false, err
+	}
+
+	// 載入發送者與被回覆訊息資訊
+	config.DB.Scopes(WithMessageRelations).First(&created, created.ID)
+	IndexMessage(&created)
+
+	// 更新聊天室最近活動時間，讓聊天室列表依活動排序
+	if params.RoomID != 0 {
+		config.DB.Model(&models.ChatRoom{}).Where("id = ?", params.RoomID).Update("updated_at", created.CreatedAt)
+	}
+
+	return &created, false, nil
+}
+
+// validateSendParams 驗證訊息內容與發送對象（未指定類型時設為 text）
+func validateSendParams(params *SendMessageParams) error {
+	// 設定預設訊息類型
+	if params.MessageType == "" {
+		params.MessageType = "text"
+	}
+
+	// 驗證訊息類型
+	if !IsValidMessageType(params.MessageType) {
+		return ErrInvalidMessageType
+	}
+
+	if err := checkPoll(params); err != nil {
+		return err
+	}
+	if err := checkPayload(params); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(params.Content) == "" {
+		return ErrEmptyContent
+	}
+
+	// 附件只能引用自己透過上傳 API 上傳的檔案
+	if params.FileURL != "" && !IsOwnUploadedFile(params.FileURL, params.SenderID) {
+		return ErrInvalidFileURL
+	}
+
+	// 私訊與群組訊息擇一
+	if (params.ReceiverID == 0) == (params.RoomID == 0) {
+		return ErrMissingTarget
+	}
+
+	if params.RoomID != 0 {
+		if err := checkRoomTarget(*params); err != nil {
+			return err
+		}
+	} else if err := checkDirectTarget(*params); err != nil {
+		return err
+	}
+
+	if params.ReplyToID != 0 {
+		if err := checkReplyTarget(*params); err != nil {
+			return err
+		}
+	}
+
+	if params.ThreadRootID != 0 {
+		if err := checkThreadRoot(*params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDirectTarget 驗證私訊接收者
+func checkDirectTarget(params SendMessageParams) error {
+	// 驗證接收者存在
+	var receiver models.User
+	if err := config.DB.First(&receiver, params.ReceiverID).Error; err != nil {
+		return ErrReceiverNotFound
+	}
+
+	// 不能發訊息給自己
+	if receiver.ID == params.SenderID {
+		return ErrSendToSelf
+	}
+
+	// 檢查是否為好友
+	if !AreFriends(params.SenderID, receiver.ID) {
+		return ErrNotFriend
+	}
+	return nil
+}
+
+// checkReplyTarget 驗證被回覆的訊息屬於同一對話且未被收回
+func checkReplyTarget(params SendMessageParams) error {
+	var quoted models.Message
+	if err := config.DB.First(&quoted, params.ReplyToID).Error; err != nil {
+		return ErrInvalidReplyTo
+	}
+	if quoted.RecalledAt != nil || !sameConversation(&quoted, params) {
+		return ErrInvalidReplyTo
+	}
+	return nil
+}
+
+// checkRoomTarget 驗證群組聊天室與發送者成員身分
+func checkRoomTarget(params SendMessageParams) error {
+	var room models.ChatRoom
+	if err := config.DB.First(&room, params.RoomID).Error; err != nil {
+		return ErrRoomNotFound
+	}
+	member, err := GetRoomMember(room.ID, params.SenderID)
+	if err != nil {
+		return err
+	}
+	if member.IsMuted(time.Now()) {
+		return ErrMemberMuted
+	}
+	return nil
+}
+
+// DispatchChatMessage 推送已儲存的訊息，並回報 ack（已儲存）與 delivered（已送達）事件給發送者
+// 重送的訊息只回報 ack，不會再次推送給接收者
+func (h *Hub) DispatchChatMessage(message *models.Message, duplicate bool) {
+	h.sendAck(message, duplicate)
+	if duplicate {
+		return
+	}
+
+	// 接收者在本實例有連線，或在其他實例在線（已透過 Broker 推送）皆視為已送達
+	// 群組訊息只要有任一其他成員在線即視為已送達
+	delivered := h.PushChatMessage(message) > 0
+	if !delivered {
+		for _, userID := range h.deliveryRecipients(message) {
+			if h.IsUserOnline(userID) {
+				delivered = true
+				break
+			}
+		}
+	}
+	if delivered {
+		h.sendDelivered(message)
+	}
+}
+
+// recipientIDs 取得訊息的接收者（不含發送者）：私訊為接收者，群組訊息為其他成員
+func (h *Hub) recipientIDs(message *models.Message) []uint {
+	if !message.IsRoomMessage() {
+		return []uint{message.GetReceiverID()}
+	}
+
+	memberIDs := RoomMemberIDs(message.GetRoomID())
+	recipients := make([]uint, 0, len(memberIDs))
+	for _, memberID := range memberIDs {
+		if memberID != message.SenderID {
+			recipients = append(recipients, memberID)
+		}
+	}
+	return recipients
+}
+
+// sendAck 通知發送者訊息已儲存
+func (h *Hub) sendAck(message *models.Message, duplicate bool) {
+	response := message.ToResponse()
+	h.SendToUser(message.SenderID, &Message{
+		Type:       "ack",
+		SenderID:   message.SenderID,
+		ReceiverID: message.GetReceiverID(),
+		RoomID:     message.GetRoomID(),
+		MessageID:  message.ID,
+		Timestamp:  message.CreatedAt.Format(time.RFC3339),
+		Data: map[string]interface{}{
+			"client_msg_id": response.ClientMsgID,
+			"message_id":    message.ID,
+			"created_at":    message.CreatedAt,
+			"duplicate":     duplicate,
+		},
+	})
+}
+
+// sendDelivered 通知發送者訊息已推送到接收者至少一個連線
+func (h *Hub) sendDelivered(message *models.Message) {
+	response := message.ToResponse()
+	h.SendToUser(message.SenderID, &Message{
+		Type:       "delivered",
+		SenderID:   message.GetReceiverID(),
+		ReceiverID: message.SenderID,
+		RoomID:     message.GetRoomID(),
+		MessageID:  message.ID,
+		Timestamp:  time.Now().Format(time.RFC3339),
+		Data: map[string]interface{}{
+			"client_msg_id": response.ClientMsgID,
+			"message_id":    message.ID,
+			"receiver_id":   response.ReceiverID,
+			"room_id":       response.RoomID,
+		},
+	})
+}
+
+// PushChatMessage 將已儲存的訊息推送給接收者與發送者的所有連線，回傳接收者送達的連線數
+// 群組訊息推送給聊天室所有成員；討論串回覆以 thread_message 事件只推送給追蹤者
+func (h *Hub) PushChatMessage(message *models.Message) int {
+	response := MessageResponseFor(message, 0)
+	eventType := "message"
+	if message.ThreadRootID != nil {
+		eventType = "thread_message"
+	}
+	event := &Message{
+		Type:        eventType,
+		SenderID:    message.SenderID,
+		ReceiverID:  message.GetReceiverID(),
+		RoomID:      message.GetRoomID(),
+		Content:     message.Content,
+		MessageID:   message.ID,
+		MessageType: message.MessageType,
+		ClientMsgID: response.ClientMsgID,
+		Timestamp:   message.CreatedAt.Format(time.RFC3339),
+		Data:        response,
+	}
+
+	delivered := 0
+	for _, userID := range h.deliveryRecipients(message) {
+		delivered += h.SendToUser(userID, event)
+	}
+	h.SendToUser(message.SenderID, event)
+	return delivered
+}
+
+// 訊息分頁錯誤
+var (
+	ErrInvalidMessageCursor = errors.New("before、after、around 只能擇一")
+	ErrCursorNotInChat      = errors.New("訊息不在此對話中")
+)
+
+// MessageCursor 以訊息 ID 為游標的分頁條件（Before、After、Around 擇一，皆為 0 時取最新訊息）
+type MessageCursor struct {
+	Before uint // 取得此訊息之前（較舊）的訊息
+	After  uint // 取得此訊息之後（較新）的訊息
+	Around uint // 取得以此訊息為中心的訊息（跳轉到指定訊息）
+	Limit  int
+}
+
+// MessagePage 訊息分頁結果（由舊到新）
+type MessagePage struct {
+	Messages      []models.Message
+	HasMoreBefore bool // 是否還有更舊的訊息
+	HasMoreAfter  bool // 是否還有更新的訊息
+}
+
+// PageMessages 依游標分頁查詢對話訊息，conversation 為限定對話範圍的查詢條件
+// 以訊息 ID 排序，新訊息寫入時不會讓分頁重複或遺漏
+func PageMessages(conversation func(db *gorm.DB) *gorm.DB, cursor MessageCursor) (*MessagePage, error) {
+	set := 0
+	for _, id := range []uint{cursor.Before, cursor.After, cursor.Around} {
+		if id != 0 {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, ErrInvalidMessageCursor
+	}
+
+	query := func() *gorm.DB {
+		return config.DB.Model(&models.Message{}).Scopes(conversation)
+	}
+	// fetch 從 anchor 往指定方向取最多 limit 筆，回傳是否還有更多
+	fetch := func(condition string, anchor uint, order string, limit int) ([]models.Message, bool, error) {
+		var messages []models.Message
+		db := query()
+		if anchor != 0 {
+			db = db.Where("messages.id "+condition+" ?", anchor)
+		}
+		if err := db.Scopes(WithMessageRelations).
+			Order("messages.id " + order).
+			Limit(limit + 1).
+			Find(&messages).Error; err != nil {
+			return nil, false, err
+		}
+		if len(messages) > limit {
+			return messages[:limit], true, nil
+		}
+		return messages, false, nil
+	}
+
+	page := &MessagePage{}
+	var err error
+	switch {
+	case cursor.After != 0:
+		page.Messages, page.HasMoreAfter, err = fetch(">", cursor.After, "ASC", cursor.Limit)
+		if err != nil {
+			return nil, err
+		}
+		page.HasMoreBefore = hasMessages(query(), "<=", cursor.After)
+
+	case cursor.Around != 0:
+		var center models.Message
+		if err := query().Where("messages.id = ?", cursor.Around).
+			Scopes(WithMessageRelations).First(&center).Error; err != nil {
+			return nil, ErrCursorNotInChat
+		}
+		before, hasBefore, err := fetch("<", cursor.Around, "DESC", cursor.Limit/2)
+		if err != nil {
+			return nil, err
+		}
+		after, hasAfter, err := fetch(">", cursor.Around, "ASC", cursor.Limit-cursor.Limit/2-1)
+		if err != nil {
+			return nil, err
+		}
+		reverseMessages(before)
+		page.Messages = append(append(before, center), after...)
+		page.HasMoreBefore, page.HasMoreAfter = hasBefore, hasAfter
+
+	default:
+		// 預設取最新訊息；Before 為 0 時不限制
+		page.Messages, page.HasMoreBefore, err = fetch("<", cursor.Before, "DESC", cursor.Limit)
+		if err != nil {
+			return nil, err
+		}
+		reverseMessages(page.Messages)
+		if cursor.Before != 0 {
+			page.HasMoreAfter = hasMessages(query(), ">=", cursor.Before)
+		}
+	}
+	return page, nil
+}
+
+// hasMessages 檢查對話中是否有 ID 符合條件的訊息
+func hasMessages(db *gorm.DB, condition string, anchor uint) bool {
+	var ids []uint
+	db.Where("messages.id "+condition+" ?", anchor).Limit(1).Pluck("messages.id", &ids)
+	return len(ids) > 0
+}
+
+// reverseMessages 反轉訊息順序
+func reverseMessages(messages []models.Message) {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gin-project/config"
+	"gin-project/models"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// loadWithRelations 重新載入訊息與被回覆訊息的預覽資料
+func loadWithRelations(t *testing.T, messageID uint) *models.Message {
+	t.Helper()
+	var message models.Message
+	if err := config.DB.Scopes(WithMessageRelations).First(&message, messageID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &message
+}
+
+func TestSendReply(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 3)
+	makeTestFriends(t, users[0], users[1])
+	makeTestFriends(t, users[0], users[2])
+
+	long := strings.Repeat("長 ", models.MessagePreviewLength)
+	quoted := sendTestMessage(t, users[1], users[0], long)
+	reply, _, err := SaveMessageToDB(SendMessageParams{SenderID: users[0], ReceiverID: users[1], Content: "收到", ReplyToID: quoted.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 預覽截斷內容並附上被回覆者資料
+	preview := reply.ToResponse().ReplyTo
+	if preview == nil || preview.ID != quoted.ID || preview.Deleted || preview.SenderID != users[1] || preview.Sender.Username != "user2" {
+		t.Fatalf("引用預覽不正確: %+v", preview)
+	}
+	if want := string([]rune(long)[:models.MessagePreviewLength]) + "…"; preview.Content != want {
+		t.Fatalf("預覽內容應截斷為 %d 個字，得到 %d 個字", models.MessagePreviewLength, len([]rune(preview.Content)))
+	}
+
+	// 被回覆的訊息收回後預覽顯示為已刪除
+	if _, err := RecallMessage(quoted.ID, users[1]); err != nil {
+		t.Fatal(err)
+	}
+	preview = loadWithRelations(t, reply.ID).ToResponse().ReplyTo
+	if preview == nil || !preview.Deleted || preview.Content != "" {
+		t.Fatalf("收回後的引用預覽應顯示為已刪除: %+v", preview)
+	}
+}
+
+func TestSendReplyRejectsOtherConversations(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 3)
+	makeTestFriends(t, users[0], users[1])
+	makeTestFriends(t, users[0], users[2])
+	room := createTestRoom(t, users[0], users[1])
+
+	other := sendTestMessage(t, users[0], users[2], "另一個對話")
+	recalled := sendTestMessage(t, users[0], users[1], "收回的訊息")
+	if _, err := RecallMessage(recalled.ID, users[0]); err != nil {
+		t.Fatal(err)
+	}
+	roomMessage, _, err := SaveMessageToDB(SendMessageParams{SenderID: users[1], RoomID: room.ID, Content: "群組訊息"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		params SendMessageParams
+	}{
+		{"不存在的訊息", SendMessageParams{ReceiverID: users[1], ReplyToID: roomMessage.ID + 100}},
+		{"其他私訊對話", SendMessageParams{ReceiverID: users[1], ReplyToID: other.ID}},
+		{"已收回的訊息", SendMessageParams{ReceiverID: users[1], ReplyToID: recalled.ID}},
+		{"私訊回覆群組訊息", SendMessageParams{ReceiverID: users[1], ReplyToID: roomMessage.ID}},
+		{"群組回覆私訊", SendMessageParams{RoomID: room.ID, ReplyToID: other.ID}},
+	}
+	for _, tt := range tests {
+		tt.params.SenderID = users[0]
+		tt.params.Content = "回覆"
+		if _, _, err := SaveMessageToDB(tt.params); !errors.Is(err, ErrInvalidReplyTo) {
+			t.Errorf("%s: 應回傳 ErrInvalidReplyTo，得到 %v", tt.name, err)
+		}
+	}
+
+	if _, _, err := SaveMessageToDB(SendMessageParams{SenderID: users[0], RoomID: room.ID, Content: "回覆", ReplyToID: roomMessage.ID}); err != nil {
+		t.Fatalf("回覆同一聊天室的訊息應成功: %v", err)
+	}
+}
+
+func TestPageMessages(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 3)
+	makeTestFriends(t, users[0], users[1])
+	makeTestFriends(t, users[0], users[2])
+
+	// 兩個對話的訊息交錯寫入，分頁只取指定對話
+	var ids []uint
+	var otherID uint
+	for i := 0; i < 10; i++ {
+		ids = append(ids, sendTestMessage(t, users[i%2], users[1-i%2], fmt.Sprintf("訊息 %d", i)).ID)
+		otherID = sendTestMessage(t, users[0], users[2], "其他對話").ID
+	}
+	conversation := func(db *gorm.DB) *gorm.DB {
+		return db.Where("((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))",
+			users[0], users[1], users[1], users[0])
+	}
+
+	tests := []struct {
+		name          string
+		cursor        MessageCursor
+		want          []uint
+		before, after bool
+	}{
+		{"最新訊息", MessageCursor{Limit: 4}, ids[6:10], true, false},
+		{"全部訊息", MessageCursor{Limit: 20}, ids, false, false},
+		{"往前翻頁", MessageCursor{Before: ids[6], Limit: 4}, ids[2:6], true, true},
+		{"翻到最舊", MessageCursor{Before: ids[2], Limit: 4}, ids[0:2], false, true},
+		{"往後翻頁", MessageCursor{After: ids[1], Limit: 4}, ids[2:6], true, true},
+		{"翻到最新", MessageCursor{After: ids[5], Limit: 4}, ids[6:10], true, false},
+		{"跳轉到中間", MessageCursor{Around: ids[5], Limit: 5}, ids[3:8], true, true},
+		{"跳轉到最舊", MessageCursor{Around: ids[0], Limit: 4}, ids[0:2], false, true},
+		{"跳轉到最新", MessageCursor{Around: ids[9], Limit: 4}, ids[7:10], true, false},
+	}
+	for _, tt := range tests {
+		page, err := PageMessages(conversation, tt.cursor)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got := make([]uint, 0, len(page.Messages))
+		for _, message := range page.Messages {
+			got = append(got, message.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) || page.HasMoreBefore != tt.before || page.HasMoreAfter != tt.after {
+			t.Errorf("%s: 得到 %v (before=%v, after=%v)，預期 %v (before=%v, after=%v)",
+				tt.name, got, page.HasMoreBefore, page.HasMoreAfter, tt.want, tt.before, tt.after)
+		}
+	}
+
+	if _, err := PageMessages(conversation, MessageCursor{Around: otherID, Limit: 4}); !errors.Is(err, ErrCursorNotInChat) {
+		t.Fatalf("跳轉到其他對話的訊息應回傳 ErrCursorNotInChat，得到 %v", err)
+	}
+	if _, err := PageMessages(conversation, MessageCursor{Before: ids[5], After: ids[1], Limit: 4}); !errors.Is(err, ErrInvalidMessageCursor) {
+		t.Fatalf("同時指定 before 與 after 應回傳 ErrInvalidMessageCursor，得到 %v", err)
+	}
+}
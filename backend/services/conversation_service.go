@@ -0,0 +1,538 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gin-project/config"
+	"gin-project/models"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Conversation service - 使用者對各對話的個人設定（靜音、置頂、封存、標記未讀、草稿）
+
+// 對話設定錯誤
+var (
+	ErrConversationTarget = errors.New("需指定好友或聊天室其中之一")
+	ErrInvalidMuteSetting = errors.New("無效的靜音時間")
+	ErrDraftTooLong       = errors.New("草稿最多 5000 個字")
+)
+
+// MaxDraftLength 草稿最多字數
+const MaxDraftLength = 5000
+
+// UpdateConversationParams 更新對話設定參數，nil 欄位表示不變更
+type UpdateConversationParams struct {
+	UserID       uint
+	PeerID       uint // 好友（與 RoomID 擇一）
+	RoomID       uint // 群組聊天室
+	MuteSeconds  *int64
+	Pinned       *bool
+	Archived     *bool
+	MarkedUnread *bool
+	Draft        *string
+}
+
+// checkConversationTarget 確認使用者可以設定此對話：私訊需為好友，群組需為成員
+func checkConversationTarget(userID, peerID, roomID uint) error {
+	if (peerID == 0) == (roomID == 0) {
+		return ErrConversationTarget
+	}
+	if roomID != 0 {
+		if !IsRoomMember(roomID, userID) {
+			return ErrNotRoomMember
+		}
+		return nil
+	}
+	if !AreFriends(userID, peerID) {
+		return ErrNotFriend
+	}
+	return nil
+}
+
+// GetConversation 取得使用者對某個對話的設定，尚未設定時回傳預設值
+func GetConversation(userID, peerID, roomID uint) (*models.Conversation, error) {
+	if err := checkConversationTarget(userID, peerID, roomID); err != nil {
+		return nil, err
+	}
+
+	conversation := models.Conversation{UserID: userID, PeerID: peerID, RoomID: roomID}
+	err := config.DB.Where("user_id = ? AND peer_id = ? AND room_id = ?", userID, peerID, roomID).
+		First(&conversation).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// UpdateConversation 更新對話設定
+func UpdateConversation(params UpdateConversationParams) (*models.Conversation, error) {
+	if err := checkConversationTarget(params.UserID, params.PeerID, params.RoomID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{}
+	if params.MuteSeconds != nil {
+		// 0 取消靜音，-1 永久靜音
+		switch seconds := *params.MuteSeconds; {
+		case seconds == 0:
+			updates["muted_until"] = nil
+		case seconds == -1:
+			updates["muted_until"] = models.MutedForever
+		case seconds > 0:
+			updates["muted_until"] = now.Add(time.Duration(seconds) * time.Second)
+		default:
+			return nil, ErrInvalidMuteSetting
+		}
+	}
+	if params.Pinned != nil {
+		updates["pinned_at"] = nullableTime(*params.Pinned, now)
+	}
+	if params.Archived != nil {
+		updates["archived_at"] = nullableTime(*params.Archived, now)
+	}
+	if params.MarkedUnread != nil {
+		updates["marked_unread"] = *params.MarkedUnread
+	}
+	if params.Draft != nil {
+		if utf8.RuneCountInString(*params.Draft) > MaxDraftLength {
+			return nil, ErrDraftTooLong
+		}
+		updates["draft"] = *params.Draft
+		updates["draft_updated_at"] = now
+	}
+
+	conversation := models.Conversation{UserID: params.UserID, PeerID: params.PeerID, RoomID: params.RoomID}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&conversation).Error; err != nil {
+			return err
+		}
+		scope := tx.Model(&models.Conversation{}).
+			Where("user_id = ? AND peer_id = ? AND room_id = ?", params.UserID, params.PeerID, params.RoomID)
+		if len(updates) > 0 {
+			if err := scope.Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("user_id = ? AND peer_id = ? AND room_id = ?", params.UserID, params.PeerID, params.RoomID).
+			First(&conversation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// nullableTime 依開關回傳時間或 NULL
+func nullableTime(enabled bool, now time.Time) interface{} {
+	if enabled {
+		return now
+	}
+	return nil
+}
+
+// clearMarkedUnread 標記已讀時清除手動標記的未讀
+func clearMarkedUnread(tx *gorm.DB, userID, peerID, roomID uint) error {
+	return tx.Model(&models.Conversation{}).
+		Where("user_id = ? AND peer_id = ? AND room_id = ? AND marked_unread = ?", userID, peerID, roomID, true).
+		Update("marked_unread", false).Error
+}
+
+// PushConversationUpdated 將對話設定同步到使用者的其他裝置
+func (h *Hub) PushConversationUpdated(userID uint, response models.ConversationResponse) {
+	h.SendToUser(userID, &Message{
+		Type:       "conversation_updated",
+		SenderID:   userID,
+		ReceiverID: userID,
+		RoomID:     response.RoomID,
+		Timestamp:  time.Now().Format(time.RFC3339),
+		Data:       response,
+	})
+}
+
+// recordConversationMessage 新訊息寫入主對話時，更新每位參與者的最後訊息指標並累加其他人的未讀數
+// 以 ON DUPLICATE KEY UPDATE 一次寫入所有參與者（私訊為雙方，群組為所有成員），尚未建立設定的參與者會自動建立
+func recordConversationMessage(tx *gorm.DB, message *models.Message) error {
+	if message.ThreadRootID != nil {
+		return nil
+	}
+
+	// 每位參與者的對話對象：私訊為對方，群組為 0
+	peers := map[uint]uint{message.SenderID: message.GetReceiverID(), message.GetReceiverID(): message.SenderID}
+	if message.IsRoomMessage() {
+		var memberIDs []uint
+		if err := tx.Model(&models.RoomMember{}).Where("room_id = ?", message.GetRoomID()).
+			Pluck("user_id", &memberIDs).Error; err != nil {
+			return err
+		}
+		peers = make(map[uint]uint, len(memberIDs))
+		for _, memberID := range memberIDs {
+			peers[memberID] = 0
+		}
+	}
+	if len(peers) == 0 {
+		return nil
+	}
+
+	rows := make([]string, 0, len(peers))
+	args := make([]interface{}, 0, len(peers)*7)
+	for userID, peerID := range peers {
+		unread := 1
+		if userID == message.SenderID {
+			unread = 0
+		}
+		rows = append(rows, "(?, ?, ?, ?, ?, ?, FALSE, '', ?)")
+		args = append(args, userID, peerID, message.GetRoomID(), message.ID, message.CreatedAt, unread, message.CreatedAt)
+	}
+
+	// MySQL 依序套用賦值，last_message_at 需在 last_message_id 之前比較
+	return tx.Exec(`
+		INSERT INTO conversations (user_id, peer_id, room_id, last_message_id, last_message_at, unread_count, marked_unread, draft, updated_at)
+		VALUES `+strings.Join(rows, ", ")+`
+		ON DUPLICATE KEY UPDATE
+			last_message_at = IF(VALUES(last_message_id) > last_message_id, VALUES(last_message_at), last_message_at),
+			unread_count = unread_count + VALUES(unread_count),
+			last_message_id = GREATEST(last_message_id, VALUES(last_message_id))`, args...).Error
+}
+
+// forgetConversationMessage 主對話訊息被刪除後，修正指向它的最後訊息指標與尚未讀到它的參與者的未讀數
+func forgetConversationMessage(tx *gorm.DB, message *models.Message) error {
+	if message.ThreadRootID != nil {
+		return nil
+	}
+
+	participants, args := "c.room_id = ?", []interface{}{message.GetRoomID()}
+	conversation := tx.Where("room_id = ?", message.GetRoomID())
+	if !message.IsRoomMessage() {
+		participants = "c.room_id = 0 AND c.user_id = ? AND c.peer_id = ?"
+		args = []interface{}{message.GetReceiverID(), message.SenderID}
+		conversation = tx.Where("((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))",
+			message.SenderID, message.GetReceiverID(), message.GetReceiverID(), message.SenderID)
+	}
+
+	if err := tx.Exec(`
+		UPDATE conversations c
+		LEFT JOIN read_watermarks w ON w.user_id = c.user_id AND w.peer_id = c.peer_id AND w.room_id = c.room_id
+		SET c.unread_count = c.unread_count - 1
+		WHERE `+participants+` AND c.user_id <> ? AND c.unread_count > 0
+		AND COALESCE(w.last_read_message_id, 0) < ?`,
+		append(args, message.SenderID, message.ID)...).Error; err != nil {
+		return err
+	}
+
+	// 對話中已沒有其他訊息時清除最後訊息指標
+	updates := map[string]interface{}{"last_message_id": 0, "last_message_at": nil}
+	var last models.Message
+	err := conversation.Where("thread_root_id IS NULL").Order("id DESC").First(&last).Error
+	if err == nil {
+		updates = map[string]interface{}{"last_message_id": last.ID, "last_message_at": last.CreatedAt}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return tx.Model(&models.Conversation{}).
+		Where("last_message_id = ?", message.ID).
+		Updates(updates).Error
+}
+
+// refreshUnreadCount 依已讀位置重新計算使用者在對話中的未讀數
+func refreshUnreadCount(tx *gorm.DB, userID, peerID, roomID, lastReadID uint) error {
+	var unread int64
+	query := tx.Model(&models.Message{}).Where("thread_root_id IS NULL AND id > ?", lastReadID)
+	if roomID != 0 {
+		query = query.Where("room_id = ? AND sender_id <> ?", roomID, userID)
+	} else {
+		query = query.Where("sender_id = ? AND receiver_id = ?", peerID, userID)
+	}
+	if err := query.Count(&unread).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Conversation{}).
+		Where("user_id = ? AND peer_id = ? AND room_id = ?", userID, peerID, roomID).
+		Update("unread_count", unread).Error
+}
+
+// 最近聊天列表分頁
+const (
+	DefaultRecentChatLimit = 20
+	MaxRecentChatLimit     = 100
+	maxPinnedConversations = 100
+)
+
+// ErrInvalidChatCursor 無效的最近聊天分頁游標
+var ErrInvalidChatCursor = errors.New("無效的分頁游標")
+
+// RecentConversation 最近聊天列表中的一個對話
+type RecentConversation struct {
+	Type            string               `json:"type"` // friend 或 room
+	Friend          *models.UserResponse `json:"friend,omitempty"`
+	Room            *RecentRoom          `json:"room,omitempty"`
+	LastMessageID   uint                 `json:"last_message_id"`
+	LastMessage     string               `json:"last_message"`
+	LastMessageType string               `json:"last_message_type"`
+	LastMessageAt   time.Time            `json:"last_message_at"`
+	UnreadCount     int                  `json:"unread_count"` // 手動標記未讀時至少為 1
+	models.ConversationResponse
+}
+
+// RecentRoom 最近聊天列表中的聊天室摘要
+type RecentRoom struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	MemberCount int64  `json:"member_count"`
+}
+
+// RecentConversationPage 最近聊天列表分頁
+type RecentConversationPage struct {
+	Pinned        []RecentConversation `json:"pinned"` // 置頂的對話，只在第一頁回傳
+	Conversations []RecentConversation `json:"conversations"`
+	NextCursor    string               `json:"next_cursor,omitempty"`
+	HasMore       bool                 `json:"has_more"`
+}
+
+// RecentConversationParams 最近聊天列表查詢參數
+type RecentConversationParams struct {
+	UserID   uint
+	Archived bool   // false 排除封存的對話，true 只列出封存的對話
+	Cursor   string // 上一頁的 next_cursor
+	Limit    int
+}
+
+// encodeChatCursor 以最後訊息時間與對話 ID 組成分頁游標
+func encodeChatCursor(conversation *models.Conversation) string {
+	return fmt.Sprintf("%d_%d", conversation.LastMessageAt.UnixMilli(), conversation.ID)
+}
+
+// decodeChatCursor 解析分頁游標
+func decodeChatCursor(cursor string) (time.Time, uint, error) {
+	millis, id, ok := strings.Cut(cursor, "_")
+	if !ok {
+		return time.Time{}, 0, ErrInvalidChatCursor
+	}
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidChatCursor
+	}
+	conversationID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidChatCursor
+	}
+	return time.UnixMilli(ms), uint(conversationID), nil
+}
+
+// ListRecentConversations 取得最近聊天列表（好友私訊與群組聊天室），以 keyset 分頁
+// 查詢次數固定：置頂對話、分頁對話、最後訊息、好友資料、聊天室與成員數各一次
+func ListRecentConversations(params RecentConversationParams) (*RecentConversationPage, error) {
+	if params.Limit < 1 || params.Limit > MaxRecentChatLimit {
+		params.Limit = DefaultRecentChatLimit
+	}
+
+	now := time.Now()
+	archived := "(archived_at IS NOT NULL AND (last_message_at <= archived_at OR (muted_until IS NOT NULL AND muted_until > ?)))"
+	base := func() *gorm.DB {
+		db := config.DB.Model(&models.Conversation{}).
+			Where("user_id = ? AND last_message_at IS NOT NULL", params.UserID)
+		if params.Archived {
+			return db.Where(archived, now)
+		}
+		return db.Where("NOT "+archived, now)
+	}
+
+	page := &RecentConversationPage{}
+
+	// 置頂的對話只在第一頁回傳，不參與分頁
+	var pinned []models.Conversation
+	if params.Cursor == "" {
+		if err := base().Where("pinned_at IS NOT NULL").
+			Order("pinned_at DESC").Limit(maxPinnedConversations).
+			Find(&pinned).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	query := base().Where("pinned_at IS NULL")
+	if params.Cursor != "" {
+		at, id, err := decodeChatCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(last_message_at < ? OR (last_message_at = ? AND id < ?))", at, at, id)
+	}
+	var conversations []models.Conversation
+	if err := query.Order("last_message_at DESC, id DESC").Limit(params.Limit + 1).
+		Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+	if len(conversations) > params.Limit {
+		conversations = conversations[:params.Limit]
+		page.HasMore = true
+		page.NextCursor = encodeChatCursor(&conversations[len(conversations)-1])
+	}
+
+	summaries, err := summarizeConversations(append(pinned, conversations...), now)
+	if err != nil {
+		return nil, err
+	}
+	page.Pinned = summaries[:len(pinned)]
+	page.Conversations = summaries[len(pinned):]
+	return page, nil
+}
+
+// summarizeConversations 批次載入最後訊息、好友與聊天室資料，組合最近聊天列表
+func summarizeConversations(conversations []models.Conversation, now time.Time) ([]RecentConversation, error) {
+	var messageIDs, peerIDs, roomIDs []uint
+	for _, conversation := range conversations {
+		messageIDs = append(messageIDs, conversation.LastMessageID)
+		if conversation.RoomID != 0 {
+			roomIDs = append(roomIDs, conversation.RoomID)
+		} else {
+			peerIDs = append(peerIDs, conversation.PeerID)
+		}
+	}
+
+	messages := make(map[uint]models.Message)
+	if len(messageIDs) > 0 {
+		var rows []models.Message
+		if err := config.DB.Where("id IN ?", messageIDs).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, message := range rows {
+			messages[message.ID] = message
+		}
+	}
+
+	users := make(map[uint]models.User)
+	if len(peerIDs) > 0 {
+		var rows []models.User
+		if err := config.DB.Where("id IN ?", peerIDs).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range rows {
+			users[user.ID] = user
+		}
+	}
+
+	rooms := make(map[uint]*RecentRoom)
+	if len(roomIDs) > 0 {
+		var rows []RecentRoom
+		if err := config.DB.Table("chat_rooms").
+			Select("chat_rooms.id, chat_rooms.name, COUNT(room_members.id) AS member_count").
+			Joins("LEFT JOIN room_members ON room_members.room_id = chat_rooms.id").
+			Where("chat_rooms.id IN ? AND chat_rooms.deleted_at IS NULL", roomIDs).
+			Group("chat_rooms.id, chat_rooms.name").
+			Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			rooms[rows[i].ID] = &rows[i]
+		}
+	}
+
+	summaries := make([]RecentConversation, 0, len(conversations))
+	for _, conversation := range conversations {
+		summary := RecentConversation{
+			LastMessageID:        conversation.LastMessageID,
+			LastMessageAt:        *conversation.LastMessageAt,
+			UnreadCount:          conversation.UnreadCount,
+			ConversationResponse: conversation.ToResponse(now),
+		}
+		if conversation.RoomID != 0 {
+			summary.Type = "room"
+			summary.Room = rooms[conversation.RoomID]
+		} else {
+			summary.Type = "friend"
+			if user, ok := users[conversation.PeerID]; ok {
+				friend := user.ToResponse()
+				summary.Friend = &friend
+			}
+		}
+		if message, ok := messages[conversation.LastMessageID]; ok {
+			response := message.ToResponse()
+			summary.LastMessage = response.Content
+			summary.LastMessageType = response.MessageType
+		}
+		if conversation.MarkedUnread && summary.UnreadCount == 0 {
+			summary.UnreadCount = 1
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// UnreadDetail 單一對話的未讀數，私訊帶 Sender、群組帶 Room
+type UnreadDetail struct {
+	Sender *models.UserResponse `json:"sender,omitempty"`
+	Room   *UnreadRoom          `json:"room,omitempty"`
+	Count  int                  `json:"count"`
+}
+
+// UnreadRoom 未讀數統計中的聊天室摘要
+type UnreadRoom struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// UnreadSummary 使用者所有對話的未讀數統計
+type UnreadSummary struct {
+	Total   int            `json:"total"`
+	Details []UnreadDetail `json:"details"`
+}
+
+// GetUnreadSummary 由 conversations.unread_count 統計未讀數（與已讀位置一致，含群組）
+// 查詢次數固定：未讀對話（含聊天室名稱）與好友資料各一次
+func GetUnreadSummary(userID uint) (*UnreadSummary, error) {
+	var rows []struct {
+		PeerID      uint
+		RoomID      uint
+		RoomName    string
+		UnreadCount int
+	}
+	if err := config.DB.Table("conversations").
+		Select("conversations.peer_id, conversations.room_id, chat_rooms.name AS room_name, conversations.unread_count").
+		Joins("LEFT JOIN chat_rooms ON chat_rooms.id = conversations.room_id AND chat_rooms.deleted_at IS NULL").
+		Where("conversations.user_id = ? AND conversations.unread_count > 0", userID).
+		Order("conversations.last_message_at DESC, conversations.id DESC").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var peerIDs []uint
+	for _, row := range rows {
+		if row.RoomID == 0 {
+			peerIDs = append(peerIDs, row.PeerID)
+		}
+	}
+	users := make(map[uint]models.User)
+	if len(peerIDs) > 0 {
+		var found []models.User
+		if err := config.DB.Where("id IN ?", peerIDs).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range found {
+			users[user.ID] = user
+		}
+	}
+
+	summary := &UnreadSummary{Details: make([]UnreadDetail, 0, len(rows))}
+	for _, row := range rows {
+		detail := UnreadDetail{Count: row.UnreadCount}
+		if row.RoomID != 0 {
+			detail.Room = &UnreadRoom{ID: row.RoomID, Name: row.RoomName}
+		} else {
+			user, ok := users[row.PeerID]
+			if !ok {
+				continue
+			}
+			sender := user.ToResponse()
+			detail.Sender = &sender
+		}
+		summary.Total += detail.Count
+		summary.Details = append(summary.Details, detail)
+	}
+	return summary, nil
+}
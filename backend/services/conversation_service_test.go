@@ -0,0 +1,235 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestUpdateConversation(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 3)
+	makeTestFriends(t, users[0], users[1])
+	room := createTestRoom(t, users[1])
+
+	// 私訊需為好友，群組需為成員，兩者擇一
+	tests := []struct {
+		peerID, roomID uint
+		want           error
+	}{
+		{0, 0, ErrConversationTarget},
+		{users[1], room.ID, ErrConversationTarget},
+		{users[2], 0, ErrNotFriend},
+		{0, room.ID, ErrNotRoomMember},
+	}
+	for _, tt := range tests {
+		if _, err := GetConversation(users[0], tt.peerID, tt.roomID); !errors.Is(err, tt.want) {
+			t.Errorf("GetConversation(peer=%d, room=%d) 應回傳 %v，得到 %v", tt.peerID, tt.roomID, tt.want, err)
+		}
+	}
+
+	conversation, err := GetConversation(users[0], users[1], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conversation.MutedUntil != nil || conversation.PinnedAt != nil || conversation.ArchivedAt != nil || conversation.Draft != "" {
+		t.Fatalf("尚未設定的對話應為預設值: %+v", conversation)
+	}
+
+	update := func(params UpdateConversationParams) *models.Conversation {
+		t.Helper()
+		params.UserID, params.PeerID = users[0], users[1]
+		conversation, err := UpdateConversation(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conversation
+	}
+	seconds := func(n int64) *int64 { return &n }
+	enabled, disabled := true, false
+
+	// 靜音：正數為秒數，-1 永久靜音，0 取消
+	now := time.Now()
+	conversation = update(UpdateConversationParams{MuteSeconds: seconds(3600)})
+	if !conversation.IsMuted(now.Add(59*time.Minute)) || conversation.IsMuted(now.Add(61*time.Minute)) {
+		t.Fatalf("應靜音一小時，得到 %v", conversation.MutedUntil)
+	}
+	conversation = update(UpdateConversationParams{MuteSeconds: seconds(-1)})
+	if conversation.MutedUntil == nil || !conversation.MutedUntil.Equal(models.MutedForever) {
+		t.Fatalf("應永久靜音，得到 %v", conversation.MutedUntil)
+	}
+	if _, err := UpdateConversation(UpdateConversationParams{UserID: users[0], PeerID: users[1], MuteSeconds: seconds(-2)}); !errors.Is(err, ErrInvalidMuteSetting) {
+		t.Fatalf("無效的靜音時間應回傳 ErrInvalidMuteSetting，得到 %v", err)
+	}
+	conversation = update(UpdateConversationParams{MuteSeconds: seconds(0)})
+	if conversation.MutedUntil != nil {
+		t.Fatalf("應取消靜音，得到 %v", conversation.MutedUntil)
+	}
+
+	// 置頂、封存與草稿只變更指定的欄位
+	conversation = update(UpdateConversationParams{Pinned: &enabled, Archived: &enabled})
+	if conversation.PinnedAt == nil || conversation.ArchivedAt == nil {
+		t.Fatalf("應置頂並封存: %+v", conversation)
+	}
+	draft := "還沒寫完的訊息"
+	conversation = update(UpdateConversationParams{Draft: &draft, Archived: &disabled})
+	if conversation.Draft != draft || conversation.DraftUpdatedAt == nil || conversation.ArchivedAt != nil || conversation.PinnedAt == nil {
+		t.Fatalf("應保存草稿並取消封存、維持置頂: %+v", conversation)
+	}
+	tooLong := strings.Repeat("字", MaxDraftLength+1)
+	if _, err := UpdateConversation(UpdateConversationParams{UserID: users[0], PeerID: users[1], Draft: &tooLong}); !errors.Is(err, ErrDraftTooLong) {
+		t.Fatalf("過長的草稿應回傳 ErrDraftTooLong，得到 %v", err)
+	}
+
+	// 設定只屬於自己，不影響對方
+	if other, err := GetConversation(users[1], users[0], 0); err != nil || other.PinnedAt != nil || other.Draft != "" {
+		t.Fatalf("對方的設定不應受影響: %+v, %v", other, err)
+	}
+}
+
+func TestMarkedUnreadClearedOnRead(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+	sendTestMessage(t, users[1], users[0], "hello")
+
+	marked := true
+	conversation, err := UpdateConversation(UpdateConversationParams{UserID: users[0], PeerID: users[1], MarkedUnread: &marked})
+	if err != nil || !conversation.MarkedUnread {
+		t.Fatalf("應標記為未讀: %+v, %v", conversation, err)
+	}
+	if _, err := MarkConversationRead(MarkReadParams{UserID: users[0], PeerID: users[1]}); err != nil {
+		t.Fatal(err)
+	}
+	if conversation, err := GetConversation(users[0], users[1], 0); err != nil || conversation.MarkedUnread {
+		t.Fatalf("標記已讀後應清除未讀標記: %+v, %v", conversation, err)
+	}
+}
+
+func TestChatCursorRoundTrip(t *testing.T) {
+	at := time.UnixMilli(1792300000123)
+	cursor := encodeChatCursor(&models.Conversation{ID: 42, LastMessageAt: &at})
+	if cursor != "1792300000123_42" {
+		t.Fatalf("游標為 %q", cursor)
+	}
+	gotAt, gotID, err := decodeChatCursor(cursor)
+	if err != nil || !gotAt.Equal(at) || gotID != 42 {
+		t.Fatalf("解析游標得到 %v, %d, %v", gotAt, gotID, err)
+	}
+}
+
+func TestDecodeChatCursorRejectsInvalid(t *testing.T) {
+	for _, cursor := range []string{"", "abc", "123", "123_", "_42", "abc_42", "123_abc", "123_-1"} {
+		if _, _, err := decodeChatCursor(cursor); !errors.Is(err, ErrInvalidChatCursor) {
+			t.Errorf("decodeChatCursor(%q) 應回傳 ErrInvalidChatCursor，得到 %v", cursor, err)
+		}
+	}
+}
+
+func loadConversation(t *testing.T, userID, peerID uint) models.Conversation {
+	t.Helper()
+	var conversation models.Conversation
+	if err := config.DB.Where("user_id = ? AND peer_id = ? AND room_id = 0", userID, peerID).First(&conversation).Error; err != nil {
+		t.Fatal(err)
+	}
+	return conversation
+}
+
+// forgetTestMessage 模擬刪除主對話訊息：刪除訊息後修正對話摘要
+func forgetTestMessage(t *testing.T, message *models.Message) {
+	t.Helper()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(&models.Message{}, message.ID).Error; err != nil {
+			return err
+		}
+		return forgetConversationMessage(tx, message)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForgetConversationMessage(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+
+	send := func(content string) *models.Message {
+		t.Helper()
+		message, _, err := SaveMessageToDB(SendMessageParams{SenderID: users[0], ReceiverID: users[1], Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+	first := send("第一則")
+	second := send("第二則")
+
+	if got := loadConversation(t, users[1], users[0]); got.LastMessageID != second.ID || got.UnreadCount != 2 {
+		t.Fatalf("接收者的對話摘要不正確: %+v", got)
+	}
+
+	// 刪除最後一則時指回前一則訊息，尚未讀到的接收者未讀數減一
+	forgetTestMessage(t, second)
+	for _, userID := range []uint{users[0], users[1]} {
+		got := loadConversation(t, userID, users[0]+users[1]-userID)
+		if got.LastMessageID != first.ID || got.LastMessageAt == nil || !got.LastMessageAt.Equal(first.CreatedAt) {
+			t.Fatalf("使用者 %d 的最後訊息應指回 %d: %+v", userID, first.ID, got)
+		}
+	}
+	if got := loadConversation(t, users[1], users[0]); got.UnreadCount != 1 {
+		t.Fatalf("接收者未讀數為 %d，預期 1", got.UnreadCount)
+	}
+
+	// 刪除對話中僅剩的訊息時清除最後訊息指標，不再出現在最近聊天列表
+	forgetTestMessage(t, first)
+	for _, userID := range []uint{users[0], users[1]} {
+		got := loadConversation(t, userID, users[0]+users[1]-userID)
+		if got.LastMessageID != 0 || got.LastMessageAt != nil {
+			t.Fatalf("使用者 %d 的最後訊息指標應清除: %+v", userID, got)
+		}
+	}
+	if got := loadConversation(t, users[1], users[0]); got.UnreadCount != 0 {
+		t.Fatalf("接收者未讀數為 %d，預期 0", got.UnreadCount)
+	}
+	page, err := ListRecentConversations(RecentConversationParams{UserID: users[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Pinned)+len(page.Conversations) != 0 {
+		t.Fatalf("沒有訊息的對話不應出現在最近聊天列表: %+v", page)
+	}
+}
+
+func TestRecordConversationMessageForRoom(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 3)
+	makeTestFriends(t, users[0], users[1])
+	makeTestFriends(t, users[0], users[2])
+	room := createTestRoom(t, users[0], users[1], users[2])
+
+	var last *models.Message
+	for _, senderID := range []uint{users[0], users[1]} {
+		message, _, err := SaveMessageToDB(SendMessageParams{SenderID: senderID, RoomID: room.ID, Content: "hi"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = message
+	}
+
+	// 每位成員都有對話摘要，未讀數只計算別人發送的訊息
+	for i, unread := range []int{1, 1, 2} {
+		var conversation models.Conversation
+		if err := config.DB.Where("user_id = ? AND peer_id = 0 AND room_id = ?", users[i], room.ID).First(&conversation).Error; err != nil {
+			t.Fatal(err)
+		}
+		if conversation.LastMessageID != last.ID || conversation.UnreadCount != unread {
+			t.Fatalf("使用者 %d 的對話摘要不正確: %+v", users[i], conversation)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gin-project/config"
+	"gin-project/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Disappearing service - 對話的訊息自動銷毀設定與到期訊息清除
+
+// 自動銷毀設定錯誤
+var (
+	ErrInvalidDisappearTimer = errors.New("自動銷毀時間需為 0（關閉）或 5 秒到 7 天之間")
+	ErrInvalidDisappearMode  = errors.New("無效的自動銷毀計時方式")
+)
+
+// 自動銷毀時間範圍（秒）
+const (
+	MinDisappearSeconds = 5
+	MaxDisappearSeconds = 7 * 24 * 60 * 60
+)
+
+// SetDisappearingTimerParams 設定自動銷毀參數
+type SetDisappearingTimerParams struct {
+	UserID  uint
+	PeerID  uint // 好友（與 RoomID 擇一）
+	RoomID  uint // 群組聊天室
+	Seconds int  // 0 表示關閉
+	Mode    string
+}
+
+// disappearingKey 對話設定的唯一鍵：私訊以 ID 較小的使用者在前，群組只使用 RoomID
+func disappearingKey(userID, peerID, roomID uint) (uint, uint, uint) {
+	if roomID != 0 {
+		return 0, 0, roomID
+	}
+	if userID > peerID {
+		return peerID, userID, 0
+	}
+	return userID, peerID, 0
+}
+
+// findDisappearingTimer 取得對話的自動銷毀設定，尚未設定時回傳關閉的預設值
+func findDisappearingTimer(db *gorm.DB, userID, peerID, roomID uint) (*models.DisappearingTimer, error) {
+	low, high, room := disappearingKey(userID, peerID, roomID)
+	timer := models.DisappearingTimer{UserID: low, PeerID: high, RoomID: room, Mode: models.DisappearAfterRead}
+	err := db.Where("user_id = ? AND peer_id = ? AND room_id = ?", low, high, room).First(&timer).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return &timer, nil
+}
+
+// GetDisappearingTimer 取得對話的自動銷毀設定
+func GetDisappearingTimer(userID, peerID, roomID uint) (*models.DisappearingTimer, error) {
+	if err := checkConversationTarget(userID, peerID, roomID); err != nil {
+		return nil, err
+	}
+	return findDisappearingTimer(config.DB, userID, peerID, roomID)
+}
+
+// SetDisappearingTimer 設定對話的自動銷毀時間，只影響之後發送的訊息
+// 私訊雙方皆可設定，群組需管理員以上；changed 表示設定有變動
+func SetDisappearingTimer(params SetDisappearingTimerParams) (timer *models.DisappearingTimer, changed bool, err error) {
+	if params.Seconds != 0 && (params.Seconds < MinDisappearSeconds || params.Seconds > MaxDisappearSeconds) {
+		return nil, false, ErrInvalidDisappearTimer
+	}
+	if params.Mode == "" {
+		params.Mode = models.DisappearAfterRead
+	}
+	if params.Mode != models.DisappearAfterRead && params.Mode != models.DisappearAfterSend {
+		return nil, false, ErrInvalidDisappearMode
+	}
+	if err := checkConversationTarget(params.UserID, params.PeerID, params.RoomID); err != nil {
+		return nil, false, err
+	}
+	if params.RoomID != 0 {
+		if _, err := AuthorizeRoomAction(params.RoomID, params.UserID, RoomActionSetDisappearing); err != nil {
+			return nil, false, err
+		}
+	}
+
+	timer, err = findDisappearingTimer(config.DB, params.UserID, params.PeerID, params.RoomID)
+	if err != nil {
+		return nil, false, err
+	}
+	if timer.Seconds == params.Seconds && (params.Seconds == 0 || timer.Mode == params.Mode) {
+		return timer, false, nil
+	}
+
+	timer.Seconds = params.Seconds
+	timer.Mode = params.Mode
+	timer.UpdatedBy = params.UserID
+	timer.UpdatedAt = time.Now()
+	if err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "peer_id"}, {Name: "room_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"seconds", "mode", "updated_by", "updated_at"}),
+	}).Create(timer).Error; err != nil {
+		return nil, false, err
+	}
+	return timer, true, nil
+}
+
+// applyDisappearingTimer 依對話目前的設定標記新訊息的自動銷毀時間
+// 發送後計時的訊息立即設定到期時間，讀取後計時的訊息等對方讀取時才設定
+func applyDisappearingTimer(tx *gorm.DB, message *models.Message) error {
+	timer, err := findDisappearingTimer(tx, message.SenderID, message.GetReceiverID(), message.GetRoomID())
+	if err != nil || !timer.Enabled() {
+		return err
+	}
+	message.DisappearSeconds = timer.Seconds
+	if timer.Mode == models.DisappearAfterSend {
+		expiresAt := time.Now().Add(time.Duration(timer.Seconds) * time.Second)
+		message.ExpiresAt = &expiresAt
+	}
+	return nil
+}
+
+// startDisappearingOnRead 讀者新讀到的訊息中，讀取後計時的訊息開始倒數
+// 群組訊息以第一位讀取的成員起算
+func startDisappearingOnRead(tx *gorm.DB, params MarkReadParams, fromID, toID uint, now time.Time) error {
+	return tx.Model(&models.Message{}).Scopes(params.conversationScope).
+		Where("sender_id <> ? AND id > ? AND id <= ? AND disappear_seconds > 0 AND expires_at IS NULL",
+			params.UserID, fromID, toID).
+		Update("expires_at", gorm.Expr("DATE_ADD(?, INTERVAL disappear_seconds SECOND)", now)).Error
+}
+
+// FormatDisappearDuration 系統訊息中顯示的自動銷毀時間
+func FormatDisappearDuration(seconds int) string {
+	switch {
+	case seconds%86400 == 0:
+		return fmt.Sprintf("%d 天", seconds/86400)
+	case seconds%3600 == 0:
+		return fmt.Sprintf("%d 小時", seconds/3600)
+	case seconds%60 == 0:
+		return fmt.Sprintf("%d 分鐘", seconds/60)
+	}
+	return fmt.Sprintf("%d 秒", seconds)
+}
+
+// PushDisappearingTimer 通知對話所有參與者自動銷毀設定已變更
+func (h *Hub) PushDisappearingTimer(operatorID uint, timer *models.DisappearingTimer) {
+	userIDs := []uint{timer.UserID, timer.PeerID}
+	if timer.RoomID != 0 {
+		userIDs = RoomMemberIDs(timer.RoomID)
+	}
+	for _, userID := range userIDs {
+		response := timer.ToResponse(userID)
+		h.SendToUser(userID, &Message{
+			Type:       "disappearing_timer_updated",
+			SenderID:   operatorID,
+			ReceiverID: response.PeerID,
+			RoomID:     timer.RoomID,
+			Timestamp:  time.Now().Format(time.RFC3339),
+			Data:       response,
+		})
+	}
+}
+
+// MessageSweeper 背景清除程序：永久刪除已到期的自動銷毀訊息與其上傳檔案，並通知對話參與者
+type MessageSweeper struct {
+	Hub       *Hub
+	Clock     Clock
+	BatchSize int
+}
+
+// NewMessageSweeper 建立使用系統時間的清除程序
+func NewMessageSweeper(hub *Hub) *MessageSweeper {
+	return &MessageSweeper{
+		Hub:       hub,
+		Clock:     SystemClock{},
+		BatchSize: 500,
+	}
+}
+
+// Run 每隔 interval 清除到期的訊息
+func (s *MessageSweeper) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if removed := s.SweepExpired(); removed > 0 {
+			log.Printf("✓ 已清除 %d 則到期訊息", removed)
+		}
+		<-ticker.C
+	}
+}
+
+// SweepExpired 永久刪除目前時間已到期的訊息，回傳刪除的筆數
+func (s *MessageSweeper) SweepExpired() int {
+	now := s.Clock.Now()
+
+	var expired []models.Message
+	if err := config.DB.Unscoped().
+		Where("expires_at <= ?", now).
+		Order("expires_at ASC, id ASC").
+		Limit(s.BatchSize).
+		Find(&expired).Error; err != nil {
+		log.Printf("❌ 查詢到期訊息失敗: %v", err)
+		return 0
+	}
+
+	removed := 0
+	for i := range expired {
+		if s.expire(&expired[i]) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// expire 永久刪除單則訊息及其編輯歷史、表情回應等資料，成功時通知參與者
+// 討論串的根訊息到期時，整個討論串（所有回覆與追蹤設定）一併刪除
+func (s *MessageSweeper) expire(message *models.Message) bool {
+	var removed []models.Message
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// 多個實例同時清除時只有一個會刪除成功
+		result := tx.Unscoped().Where("id = ?", message.ID).Delete(&models.Message{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if err := deleteMessageData(tx, message.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("root_message_id = ?", message.ID).Delete(&models.ThreadFollow{}).Error; err != nil {
+			return err
+		}
+
+		var replies []models.Message
+		if message.ThreadRootID == nil {
+			if err := tx.Unscoped().Where("thread_root_id = ?", message.ID).Find(&replies).Error; err != nil {
+				return err
+			}
+		}
+		for i := range replies {
+			if err := tx.Unscoped().Where("id = ?", replies[i].ID).Delete(&models.Message{}).Error; err != nil {
+				return err
+			}
+			if err := deleteMessageData(tx, replies[i].ID); err != nil {
+				return err
+			}
+		}
+		removed = append([]models.Message{*message}, replies...)
+
+		// 回覆此訊息的訊息保留 reply_to_id，引用預覽顯示為已刪除
+		if message.ThreadRootID != nil {
+			if err := refreshThreadStats(tx, *message.ThreadRootID); err != nil {
+				return err
+			}
+		}
+
+		// 已被刪除的聊天室訊息在刪除時已修正過對話摘要
+		if message.DeletedAt.Valid {
+			return nil
+		}
+		return forgetConversationMessage(tx, message)
+	})
+	if err != nil {
+		log.Printf("❌ 清除到期訊息 %d 失敗: %v", message.ID, err)
+		return false
+	}
+	if len(removed) == 0 {
+		return false
+	}
+
+	for i := range removed {
+		s.notifyExpired(&removed[i])
+	}
+	return true
+}
+
+// deleteMessageData 刪除訊息的編輯歷史、個人刪除紀錄、表情回應與投票
+func deleteMessageData(tx *gorm.DB, messageID uint) error {
+	for _, related := range []interface{}{&models.MessageEdit{}, &models.MessageDeletion{}, &models.MessageReaction{}} {
+		if err := tx.Where("message_id = ?", messageID).Delete(related).Error; err != nil {
+			return err
+		}
+	}
+	return deletePoll(tx, messageID)
+}
+
+// notifyExpired 移除已刪除訊息的附件與搜尋索引，並通知參與者
+func (s *MessageSweeper) notifyExpired(message *models.Message) {
+	if message.FileURL != "" {
+		RemoveUploadedFile(message.FileURL, message.SenderID)
+	}
+	RemoveMessageFromIndex(message.ID)
+
+	s.Hub.PushMessageEvent("message_expired", message.SenderID, message, map[string]interface{}{
+		"message_id":     message.ID,
+		"receiver_id":    message.GetReceiverID(),
+		"room_id":        message.GetRoomID(),
+		"thread_root_id": message.ThreadRootID,
+		"expires_at":     message.ExpiresAt,
+	})
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"fmt"
+	"gin-project/config"
+	"gin-project/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMessageSweeperExpiresThreadWithRoot(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+
+	send := func(params SendMessageParams) *models.Message {
+		t.Helper()
+		params.SenderID = users[0]
+		params.ReceiverID = users[1]
+		message, _, err := SaveMessageToDB(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+	root := send(SendMessageParams{Content: "會到期的訊息"})
+	reply := send(SendMessageParams{Content: "討論串回覆", ThreadRootID: root.ID})
+	quote := send(SendMessageParams{Content: "引用到期的訊息", ReplyToID: root.ID})
+
+	clock := &fakeClock{now: time.Now().Truncate(time.Second)}
+	config.DB.Model(&models.Message{}).Where("id = ?", root.ID).Update("expires_at", clock.now)
+
+	sweeper := &MessageSweeper{Hub: NewHub(), Clock: clock, BatchSize: 10}
+	if removed := sweeper.SweepExpired(); removed != 1 {
+		t.Fatalf("應清除 1 則到期訊息，清除了 %d 則", removed)
+	}
+
+	// 根訊息與討論串一併刪除
+	var count int64
+	config.DB.Unscoped().Model(&models.Message{}).Where("id IN ?", []uint{root.ID, reply.ID}).Count(&count)
+	if count != 0 {
+		t.Fatalf("根訊息與討論串回覆應一併刪除，仍有 %d 則", count)
+	}
+	config.DB.Model(&models.ThreadFollow{}).Where("root_message_id = ?", root.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("討論串追蹤設定應一併刪除，仍有 %d 筆", count)
+	}
+
+	// 引用到期訊息的回覆保留 reply_to_id，預覽顯示為已刪除
+	var quoting models.Message
+	if err := config.DB.Scopes(WithMessageRelations).First(&quoting, quote.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if quoting.ReplyToID == nil || *quoting.ReplyToID != root.ID {
+		t.Fatalf("reply_to_id 應保留為 %d，得到 %v", root.ID, quoting.ReplyToID)
+	}
+	response := quoting.ToResponse()
+	if response.ReplyTo == nil || !response.ReplyTo.Deleted || response.ReplyTo.Content != "" {
+		t.Fatalf("引用預覽應顯示為已刪除，得到 %+v", response.ReplyTo)
+	}
+}
+
+func TestMessageSweeperRemovesOnlyOwnUploads(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	t.Chdir(t.TempDir())
+
+	upload := func(name string) string {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join("uploads", "images"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join("uploads", "images", name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return "/uploads/images/" + name
+	}
+	own := upload(fmt.Sprintf("%d_own.png", users[0]))
+	foreign := upload(fmt.Sprintf("%d_avatar.png", users[1]))
+
+	// 直接寫入資料庫，模擬繞過發送驗證、指向他人檔案的舊訊息
+	clock := &fakeClock{now: time.Now().Truncate(time.Second)}
+	for _, fileURL := range []string{own, foreign} {
+		message := models.Message{
+			SenderID:    users[0],
+			ReceiverID:  &users[1],
+			MessageType: "image",
+			FileURL:     fileURL,
+			ExpiresAt:   &clock.now,
+		}
+		if err := config.DB.Create(&message).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sweeper := &MessageSweeper{Hub: NewHub(), Clock: clock, BatchSize: 10}
+	if removed := sweeper.SweepExpired(); removed != 2 {
+		t.Fatalf("應清除 2 則到期訊息，清除了 %d 則", removed)
+	}
+	if _, err := os.Stat(filepath.FromSlash(own[1:])); !os.IsNotExist(err) {
+		t.Fatalf("發送者自己上傳的檔案應被刪除，得到 %v", err)
+	}
+	if _, err := os.Stat(filepath.FromSlash(foreign[1:])); err != nil {
+		t.Fatalf("他人上傳的檔案不應被刪除: %v", err)
+	}
+}
+
+func TestDisappearingStartsOnRead(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+	if _, _, err := SetDisappearingTimer(SetDisappearingTimerParams{UserID: users[0], PeerID: users[1], Seconds: 60}); err != nil {
+		t.Fatal(err)
+	}
+	first := sendTestMessage(t, users[0], users[1], "第一則")
+	second := sendTestMessage(t, users[0], users[1], "第二則")
+
+	expiresAt := func(messageID uint) *time.Time {
+		t.Helper()
+		var message models.Message
+		if err := config.DB.First(&message, messageID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return message.ExpiresAt
+	}
+	if expiresAt(first.ID) != nil || expiresAt(second.ID) != nil {
+		t.Fatal("讀取後計時的訊息在讀取前不應開始倒數")
+	}
+
+	// 發送者自己讀取不會開始倒數
+	if _, err := MarkConversationRead(MarkReadParams{UserID: users[0], PeerID: users[1]}); err != nil {
+		t.Fatal(err)
+	}
+	if expiresAt(first.ID) != nil {
+		t.Fatal("發送者讀取不應開始倒數")
+	}
+
+	// 接收者每次讀取，只有新讀到的訊息開始倒數
+	before := time.Now().Add(-time.Second)
+	if _, err := MarkConversationRead(MarkReadParams{UserID: users[1], PeerID: users[0], MessageID: first.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if at := expiresAt(first.ID); at == nil || at.Before(before.Add(time.Minute)) || at.After(time.Now().Add(time.Minute+time.Second)) {
+		t.Fatalf("第一則應在讀取後 60 秒到期，得到 %v", at)
+	}
+	if expiresAt(second.ID) != nil {
+		t.Fatal("尚未讀到的訊息不應開始倒數")
+	}
+	if _, err := MarkConversationRead(MarkReadParams{UserID: users[1], PeerID: users[0]}); err != nil {
+		t.Fatal(err)
+	}
+	if expiresAt(second.ID) == nil {
+		t.Fatal("第二則讀取後應開始倒數")
+	}
+}
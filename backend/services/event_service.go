@@ -0,0 +1,94 @@
+package services
+
+import (
+	"gin-project/config"
+	"gin-project/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Event service - 使用者事件序號與斷線補發
+
+// MaxReplayEvents 單次重連最多補發的事件數，超過時要求客戶端重新同步
+const MaxReplayEvents = 500
+
+// recordUserEvent 為使用者配置下一個事件序號並儲存事件，回傳已帶序號的編碼結果
+// 同一使用者的序號配置透過 cursor 資料列鎖序列化，確保提交順序與序號一致
+func (h *Hub) recordUserEvent(userID uint, message *Message) []byte {
+	event := *message
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		cursor := models.UserEventCursor{UserID: userID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&cursor).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&cursor, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		cursor.LastSeq++
+		if err := tx.Model(&cursor).Update("last_seq", cursor.LastSeq).Error; err != nil {
+			return err
+		}
+
+		event.Seq = cursor.LastSeq
+		return tx.Create(&models.UserEvent{
+			UserID:  userID,
+			Seq:     event.Seq,
+			Type:    event.Type,
+			Payload: string(h.encodeMessage(&event)),
+		}).Error
+	})
+	if err != nil {
+		// 儲存失敗時仍即時推送，只是無法於重連時補發
+		log.Printf("❌ 儲存使用者 %d 的事件失敗: %v", userID, err)
+		event.Seq = 0
+	}
+
+	return h.encodeMessage(&event)
+}
+
+// CurrentEventSeq 取得使用者目前最新的事件序號
+func CurrentEventSeq(userID uint) uint64 {
+	var cursor models.UserEventCursor
+	if err := config.DB.First(&cursor, "user_id = ?", userID).Error; err != nil {
+		return 0
+	}
+	return cursor.LastSeq
+}
+
+// LoadEventsAfter 依序號取得使用者在 afterSeq 之後的事件，最多 limit 筆
+func LoadEventsAfter(userID uint, afterSeq uint64, limit int) ([]models.UserEvent, error) {
+	var events []models.UserEvent
+	err := config.DB.
+		Where("user_id = ? AND seq > ?", userID, afterSeq).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// PruneUserEvents 刪除早於指定時間的事件紀錄
+func PruneUserEvents(before time.Time) (int64, error) {
+	result := config.DB.Where("created_at < ?", before).Delete(&models.UserEvent{})
+	return result.RowsAffected, result.Error
+}
+
+// StartEventPruner 定期清除超過保留期限的事件紀錄
+func StartEventPruner(retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if removed, err := PruneUserEvents(time.Now().Add(-retention)); err != nil {
+			log.Printf("❌ 清除過期事件失敗: %v", err)
+		} else if removed > 0 {
+			log.Printf("✓ 已清除 %d 筆過期事件", removed)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gin-project/config"
+	"gin-project/models"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Message service - 已發送訊息的後續操作（編輯、刪除、收回等）
+
+// 訊息操作錯誤
+var (
+	ErrMessageNotFound     = errors.New("訊息不存在")
+	ErrNotMessageSender    = errors.New("只能編輯自己發送的訊息")
+	ErrMessageNotEditable  = errors.New("只能編輯文字訊息")
+	ErrEditWindowExpired   = errors.New("已超過可編輯的時間")
+	ErrContentUnchanged    = errors.New("訊息內容沒有變更")
+	ErrMessageRecalled     = errors.New("訊息已收回")
+	ErrNotRecallable       = errors.New("只能收回自己發送的訊息")
+	ErrRecallWindowExpired = errors.New("已超過可收回的時間")
+)
+
+// MessageEditWindow 訊息發送後可編輯的時間，0 表示不限制
+func MessageEditWindow() time.Duration {
+	if config.AppConfig == nil {
+		return 0
+	}
+	return time.Duration(config.AppConfig.MessageEditWindowMinutes) * time.Minute
+}
+
+// MessageRecallWindow 訊息發送後可收回的時間，0 表示不限制
+func MessageRecallWindow() time.Duration {
+	if config.AppConfig == nil {
+		return 0
+	}
+	return time.Duration(config.AppConfig.MessageRecallWindowMinutes) * time.Minute
+}
+
+// CanAccessMessage 檢查使用者是否為訊息所在對話的參與者
+func CanAccessMessage(message *models.Message, userID uint) bool {
+	if message.IsRoomMessage() {
+		return IsRoomMember(message.GetRoomID(), userID)
+	}
+	return message.SenderID == userID || message.GetReceiverID() == userID
+}
+
+// GetAccessibleMessage 取得使用者可存取的訊息（含發送者資訊）
+func GetAccessibleMessage(messageID, userID uint) (*models.Message, error) {
+	var message models.Message
+	if err := config.DB.Scopes(WithMessageRelations).First(&message, messageID).Error; err != nil {
+		return nil, ErrMessageNotFound
+	}
+	if !CanAccessMessage(&message, userID) {
+		return nil, ErrMessageNotFound
+	}
+	return &message, nil
+}
+
+// EditMessage 編輯自己發送的文字訊息，編輯前的內容保存到編輯歷史
+func EditMessage(messageID, userID uint, content string) (*models.Message, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, ErrEmptyContent
+	}
+
+	message, err := GetAccessibleMessage(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if message.SenderID != userID {
+		return nil, ErrNotMessageSender
+	}
+	if message.RecalledAt != nil {
+		return nil, ErrMessageRecalled
+	}
+	if message.MessageType != "text" {
+		return nil, ErrMessageNotEditable
+	}
+	if window := MessageEditWindow(); window > 0 && time.Since(message.CreatedAt) > window {
+		return nil, ErrEditWindowExpired
+	}
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// 鎖定訊息後再讀取編輯前的內容，同時編輯時每個版本都會保存到編輯歷史
+		var current models.Message
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, message.ID).Error; err != nil {
+			return ErrMessageNotFound
+		}
+		if current.RecalledAt != nil {
+			return ErrMessageRecalled
+		}
+		if current.Content == content {
+			return ErrContentUnchanged
+		}
+
+		if err := tx.Create(&models.MessageEdit{
+			MessageID: message.ID,
+			Content:   current.Content,
+			CreatedAt: now,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Message{}).Where("id = ?", message.ID).
+			Updates(map[string]interface{}{"content": content, "edited_at": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	message.Content = content
+	message.EditedAt = &now
+	IndexMessage(message)
+	return message, nil
+}
+
+// GetMessageEdits 取得訊息的編輯歷史（由舊到新）
+func GetMessageEdits(messageID, userID uint) ([]models.MessageEdit, error) {
+	if _, err := GetAccessibleMessage(messageID, userID); err != nil {
+		return nil, err
+	}
+
+	var edits []models.MessageEdit
+	err := config.DB.Where("message_id = ?", messageID).Order("created_at ASC, id ASC").Find(&edits).Error
+	return edits, err
+}
+
+// DeleteMessageForUser 將訊息從使用者自己的檢視中刪除，不影響對話其他參與者
+func DeleteMessageForUser(messageID, userID uint) error {
+	if _, err := GetAccessibleMessage(messageID, userID); err != nil {
+		return err
+	}
+	return config.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.MessageDeletion{MessageID: messageID, UserID: userID}).Error
+}
+
+// NotDeletedForUser 查詢條件：排除使用者自行刪除的訊息（查詢需以 messages 為主表）
+func NotDeletedForUser(userID uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("NOT EXISTS (SELECT 1 FROM message_deletions md WHERE md.message_id = messages.id AND md.user_id = ?)", userID)
+	}
+}
+
+// RecallMessage 收回自己發送的訊息：清除內容、編輯歷史與上傳的檔案，對所有參與者顯示為已收回
+func RecallMessage(messageID, userID uint) (*models.Message, error) {
+	message, err := GetAccessibleMessage(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if message.SenderID != userID || message.MessageType == models.MessageTypeSystem {
+		return nil, ErrNotRecallable
+	}
+	if message.RecalledAt != nil {
+		return nil, ErrMessageRecalled
+	}
+	if window := MessageRecallWindow(); window > 0 && time.Since(message.CreatedAt) > window {
+		return nil, ErrRecallWindowExpired
+	}
+
+	fileURL := message.FileURL
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Message{}).
+			Where("id = ? AND recalled_at IS NULL", message.ID).
+			Updates(map[string]interface{}{
+				"content":     "",
+				"file_url":    "",
+				"file_name":   "",
+				"file_size":   0,
+				"payload":     nil,
+				"recalled_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMessageRecalled
+		}
+		if err := tx.Where("message_id = ?", message.ID).Delete(&models.MessageEdit{}).Error; err != nil {
+			return err
+		}
+		if message.ThreadRootID != nil {
+			return refreshThreadStats(tx, *message.ThreadRootID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if fileURL != "" {
+		RemoveUploadedFile(fileURL, message.SenderID)
+	}
+	RemoveMessageFromIndex(message.ID)
+
+	message.Content = ""
+	message.FileURL = ""
+	message.FileName = ""
+	message.FileSize = 0
+	message.Payload = nil
+	message.RecalledAt = &now
+	return message, nil
+}
+
+// messageUploadDirs 訊息附件的上傳目錄（與上傳 API 的檔案類型對應）
+var messageUploadDirs = []string{"images", "videos", "files"}
+
+// IsOwnUploadedFile 檢查檔案是否為使用者透過上傳 API 上傳的訊息附件
+// 上傳 API 以 /uploads/{images,videos,files}/<使用者 ID>_<時間>.<副檔名> 命名
+func IsOwnUploadedFile(fileURL string, userID uint) bool {
+	if path.Clean(fileURL) != fileURL {
+		return false
+	}
+	for _, dir := range messageUploadDirs {
+		name, ok := strings.CutPrefix(fileURL, "/uploads/"+dir+"/")
+		if ok {
+			return !strings.Contains(name, "/") && strings.HasPrefix(name, fmt.Sprintf("%d_", userID))
+		}
+	}
+	return false
+}
+
+// RemoveUploadedFile 刪除訊息發送者上傳的附件
+// 只刪除發送者自己上傳的訊息附件，仍被訊息（含已刪除的聊天室訊息）、等待發送的排程訊息或頭像引用時保留
+func RemoveUploadedFile(fileURL string, ownerID uint) {
+	if !IsOwnUploadedFile(fileURL, ownerID) {
+		return
+	}
+
+	var references int64
+	config.DB.Unscoped().Model(&models.Message{}).Where("file_url = ?", fileURL).Count(&references)
+	if references > 0 {
+		return
+	}
+	config.DB.Model(&models.ScheduledMessage{}).
+		Where("file_url = ? AND status IN ?", fileURL, []string{models.ScheduledPending, models.ScheduledSending}).
+		Count(&references)
+	if references > 0 {
+		return
+	}
+	config.DB.Unscoped().Model(&models.User{}).Where("avatar_url = ?", fileURL).Count(&references)
+	if references > 0 {
+		return
+	}
+
+	filePath := filepath.FromSlash(strings.TrimPrefix(fileURL, "/"))
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("❌ 刪除上傳檔案 %s 失敗: %v", filePath, err)
+	}
+}
+
+// PushMessageEvent 推送訊息相關事件給對話的所有參與者（包含發送者的其他裝置）
+func (h *Hub) PushMessageEvent(eventType string, operatorID uint, message *models.Message, data interface{}) {
+	event := &Message{
+		Type:       eventType,
+		SenderID:   operatorID,
+		ReceiverID: message.GetReceiverID(),
+		RoomID:     message.GetRoomID(),
+		MessageID:  message.ID,
+		Timestamp:  time.Now().Format(time.RFC3339),
+		Data:       data,
+	}
+
+	for _, userID := range h.recipientIDs(message) {
+		h.SendToUser(userID, event)
+	}
+	h.SendToUser(message.SenderID, event)
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gin-project/config"
+	"gin-project/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setEditWindow 設定測試期間的訊息可編輯時間
+func setEditWindow(t *testing.T, minutes int) {
+	t.Helper()
+	previous := config.AppConfig
+	config.AppConfig = &config.Config{MessageEditWindowMinutes: minutes}
+	t.Cleanup(func() { config.AppConfig = previous })
+}
+
+// setRecallWindow 設定測試期間的訊息可收回時間
+func setRecallWindow(t *testing.T, minutes int) {
+	t.Helper()
+	previous := config.AppConfig
+	config.AppConfig = &config.Config{MessageRecallWindowMinutes: minutes}
+	t.Cleanup(func() { config.AppConfig = previous })
+}
+
+// sendTestMessage 發送私訊
+func sendTestMessage(t *testing.T, senderID, receiverID uint, content string) *models.Message {
+	t.Helper()
+	message, _, err := SaveMessageToDB(SendMessageParams{SenderID: senderID, ReceiverID: receiverID, Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+// backdateMessage 將訊息的發送時間往前調整
+func backdateMessage(t *testing.T, messageID uint, age time.Duration) {
+	t.Helper()
+	if err := config.DB.Model(&models.Message{}).Where("id = ?", messageID).
+		Update("created_at", time.Now().Add(-age)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEditMessage(t *testing.T) {
+	openTestDB(t)
+	setEditWindow(t, 15)
+	users := createTestUsers(t, 3)
+	makeTestFriends(t, users[0], users[1])
+	message := sendTestMessage(t, users[0], users[1], "第一版")
+
+	if _, err := EditMessage(message.ID, users[1], "改掉"); !errors.Is(err, ErrNotMessageSender) {
+		t.Fatalf("接收者編輯應回傳 ErrNotMessageSender，得到 %v", err)
+	}
+	if _, err := EditMessage(message.ID, users[2], "改掉"); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("非參與者編輯應回傳 ErrMessageNotFound，得到 %v", err)
+	}
+	if _, err := EditMessage(message.ID, users[0], "  "); !errors.Is(err, ErrEmptyContent) {
+		t.Fatalf("空白內容應回傳 ErrEmptyContent，得到 %v", err)
+	}
+	if _, err := EditMessage(message.ID, users[0], "第一版"); !errors.Is(err, ErrContentUnchanged) {
+		t.Fatalf("內容未變更應回傳 ErrContentUnchanged，得到 %v", err)
+	}
+
+	for _, content := range []string{"第二版", "第三版"} {
+		edited, err := EditMessage(message.ID, users[0], content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if edited.Content != content || edited.EditedAt == nil {
+			t.Fatalf("編輯後的訊息不正確: %+v", edited)
+		}
+	}
+
+	// 編輯歷史依序保存每次編輯前的內容，對話參與者都可查看
+	edits, err := GetMessageEdits(message.ID, users[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits) != 2 || edits[0].Content != "第一版" || edits[1].Content != "第二版" {
+		t.Fatalf("編輯歷史不正確: %+v", edits)
+	}
+	if _, err := GetMessageEdits(message.ID, users[2]); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("非參與者查看編輯歷史應回傳 ErrMessageNotFound，得到 %v", err)
+	}
+	var stored models.Message
+	config.DB.First(&stored, message.ID)
+	if stored.Content != "第三版" || stored.EditedAt == nil {
+		t.Fatalf("資料庫中的訊息不正確: %+v", stored)
+	}
+}
+
+func TestEditMessageRejectsNonText(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	receiverID := users[1]
+	message := models.Message{SenderID: users[0], ReceiverID: &receiverID, MessageType: "image", FileURL: "/uploads/images/photo.png"}
+	if err := config.DB.Create(&message).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EditMessage(message.ID, users[0], "說明"); !errors.Is(err, ErrMessageNotEditable) {
+		t.Fatalf("編輯圖片訊息應回傳 ErrMessageNotEditable，得到 %v", err)
+	}
+}
+
+func TestEditMessageWindow(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+	message := sendTestMessage(t, users[0], users[1], "hello")
+	backdateMessage(t, message.ID, 16*time.Minute)
+
+	setEditWindow(t, 15)
+	if _, err := EditMessage(message.ID, users[0], "hi"); !errors.Is(err, ErrEditWindowExpired) {
+		t.Fatalf("超過可編輯時間應回傳 ErrEditWindowExpired，得到 %v", err)
+	}
+	if edits, _ := GetMessageEdits(message.ID, users[0]); len(edits) != 0 {
+		t.Fatalf("編輯失敗時不應保存編輯歷史: %+v", edits)
+	}
+
+	setEditWindow(t, 20)
+	if _, err := EditMessage(message.ID, users[0], "hi"); err != nil {
+		t.Fatalf("可編輯時間內應可編輯: %v", err)
+	}
+
+	// 0 表示不限制
+	backdateMessage(t, message.ID, 24*time.Hour)
+	setEditWindow(t, 0)
+	if _, err := EditMessage(message.ID, users[0], "hey"); err != nil {
+		t.Fatalf("不限制可編輯時間時應可編輯: %v", err)
+	}
+}
+
+func TestIsOwnUploadedFile(t *testing.T) {
+	tests := []struct {
+		fileURL string
+		want    bool
+	}{
+		{"/uploads/images/7_1700000000.png", true},
+		{"/uploads/videos/7_1700000000.mp4", true},
+		{"/uploads/files/7_1700000000.pdf", true},
+		{"/uploads/images/8_1700000000.png", false},
+		{"/uploads/images/77_1700000000.png", false},
+		{"/uploads/avatars/7_1700000000.png", false},
+		{"/uploads/images/sub/7_1700000000.png", false},
+		{"/uploads/images/../files/7_1700000000.pdf", false},
+		{"/uploads/images/../../main.go", false},
+		{"/uploads/images//7_1700000000.png", false},
+		{"uploads/images/7_1700000000.png", false},
+		{"https://example.com/uploads/images/7_1.png", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsOwnUploadedFile(tt.fileURL, 7); got != tt.want {
+			t.Errorf("IsOwnUploadedFile(%q, 7) = %v，預期 %v", tt.fileURL, got, tt.want)
+		}
+	}
+}
+
+// createTestUpload 在目前目錄的 uploads/images 下建立檔案並回傳網址
+func createTestUpload(t *testing.T, name string) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join("uploads", "images"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("uploads", "images", name), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return "/uploads/images/" + name
+}
+
+func uploadExists(fileURL string) bool {
+	_, err := os.Stat(filepath.FromSlash(fileURL[1:]))
+	return err == nil
+}
+
+func TestSendRejectsForeignFileURL(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+
+	for _, fileURL := range []string{
+		fmt.Sprintf("/uploads/images/%d_photo.png", users[1]),
+		fmt.Sprintf("/uploads/images/../images/%d_photo.png", users[0]),
+		"/uploads/avatars/avatar.png",
+	} {
+		_, _, err := SaveMessageToDB(SendMessageParams{
+			SenderID:    users[0],
+			ReceiverID:  users[1],
+			Content:     "photo.png",
+			MessageType: "image",
+			FileURL:     fileURL,
+		})
+		if !errors.Is(err, ErrInvalidFileURL) {
+			t.Fatalf("附件 %s 應回傳 ErrInvalidFileURL，得到 %v", fileURL, err)
+		}
+	}
+}
+
+func TestRecallMessage(t *testing.T) {
+	openTestDB(t)
+	setRecallWindow(t, 2)
+	t.Chdir(t.TempDir())
+	users := createTestUsers(t, 3)
+	makeTestFriends(t, users[0], users[1])
+
+	fileURL := createTestUpload(t, fmt.Sprintf("%d_photo.png", users[0]))
+	image, _, err := SaveMessageToDB(SendMessageParams{
+		SenderID:    users[0],
+		ReceiverID:  users[1],
+		Content:     "photo.png",
+		MessageType: "image",
+		FileURL:     fileURL,
+		FileName:    "photo.png",
+		FileSize:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RecallMessage(image.ID, users[1]); !errors.Is(err, ErrNotRecallable) {
+		t.Fatalf("接收者收回應回傳 ErrNotRecallable，得到 %v", err)
+	}
+	if _, err := RecallMessage(image.ID, users[2]); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("非參與者收回應回傳 ErrMessageNotFound，得到 %v", err)
+	}
+
+	recalled, err := RecallMessage(image.ID, users[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recalled.RecalledAt == nil || recalled.FileURL != "" || recalled.Content != "" {
+		t.Fatalf("收回後的訊息不正確: %+v", recalled)
+	}
+	var stored models.Message
+	config.DB.First(&stored, image.ID)
+	if stored.RecalledAt == nil || stored.FileURL != "" || stored.FileName != "" || stored.FileSize != 0 || stored.Content != "" {
+		t.Fatalf("資料庫中的訊息應清除內容與檔案: %+v", stored)
+	}
+	if uploadExists(fileURL) {
+		t.Fatal("收回後應刪除發送者上傳的檔案")
+	}
+	if _, err := RecallMessage(image.ID, users[0]); !errors.Is(err, ErrMessageRecalled) {
+		t.Fatalf("重複收回應回傳 ErrMessageRecalled，得到 %v", err)
+	}
+
+	// 超過可收回時間
+	text := sendTestMessage(t, users[0], users[1], "hello")
+	if _, err := EditMessage(text.ID, users[0], "hello!"); err != nil {
+		t.Fatal(err)
+	}
+	backdateMessage(t, text.ID, 3*time.Minute)
+	if _, err := RecallMessage(text.ID, users[0]); !errors.Is(err, ErrRecallWindowExpired) {
+		t.Fatalf("超過可收回時間應回傳 ErrRecallWindowExpired，得到 %v", err)
+	}
+	setRecallWindow(t, 0)
+	if _, err := RecallMessage(text.ID, users[0]); err != nil {
+		t.Fatalf("不限制可收回時間時應可收回: %v", err)
+	}
+	if edits, err := GetMessageEdits(text.ID, users[1]); err != nil || len(edits) != 0 {
+		t.Fatalf("收回後應清除編輯歷史，得到 %+v, %v", edits, err)
+	}
+}
+
+func TestRecallMessageKeepsOtherFiles(t *testing.T) {
+	openTestDB(t)
+	t.Chdir(t.TempDir())
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+
+	// 直接寫入資料庫，模擬繞過發送驗證、指向他人檔案的舊訊息
+	foreign := createTestUpload(t, fmt.Sprintf("%d_avatar.png", users[1]))
+	message := models.Message{SenderID: users[0], ReceiverID: &users[1], Content: "x", MessageType: "image", FileURL: foreign}
+	if err := config.DB.Create(&message).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RecallMessage(message.ID, users[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !uploadExists(foreign) {
+		t.Fatal("收回訊息不應刪除他人上傳的檔案")
+	}
+
+	// 仍被其他訊息引用的檔案保留
+	shared := createTestUpload(t, fmt.Sprintf("%d_shared.png", users[0]))
+	var sent []*models.Message
+	for i := 0; i < 2; i++ {
+		message, _, err := SaveMessageToDB(SendMessageParams{
+			SenderID:    users[0],
+			ReceiverID:  users[1],
+			Content:     "shared.png",
+			MessageType: "image",
+			FileURL:     shared,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, message)
+	}
+	if _, err := RecallMessage(sent[0].ID, users[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !uploadExists(shared) {
+		t.Fatal("仍被其他訊息引用的檔案不應刪除")
+	}
+	if _, err := RecallMessage(sent[1].ID, users[0]); err != nil {
+		t.Fatal(err)
+	}
+	if uploadExists(shared) {
+		t.Fatal("不再被引用的檔案應刪除")
+	}
+}
+
+func TestDeleteMessageForUser(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 3)
+	makeTestFriends(t, users[0], users[1])
+	message := sendTestMessage(t, users[0], users[1], "hello")
+
+	if err := DeleteMessageForUser(message.ID, users[2]); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("非參與者刪除應回傳 ErrMessageNotFound，得到 %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := DeleteMessageForUser(message.ID, users[1]); err != nil {
+			t.Fatalf("第 %d 次刪除失敗: %v", i+1, err)
+		}
+	}
+
+	// 只從刪除者自己的檢視中移除
+	visible := func(userID uint) bool {
+		var count int64
+		config.DB.Model(&models.Message{}).Where("messages.id = ?", message.ID).Scopes(NotDeletedForUser(userID)).Count(&count)
+		return count > 0
+	}
+	if visible(users[1]) {
+		t.Fatal("刪除者不應再看到訊息")
+	}
+	if !visible(users[0]) {
+		t.Fatal("其他參與者仍應看到訊息")
+	}
+}
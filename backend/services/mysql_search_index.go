@@ -0,0 +1,90 @@
+package services
+
+import (
+	"gin-project/config"
+	"gin-project/models"
+	"strings"
+)
+
+// MySQLMessageIndex 以 messages.content 的 FULLTEXT 索引（ngram 解析器）搜尋訊息
+// 索引由 MySQL 自行維護，Index 與 Remove 不需額外處理
+type MySQLMessageIndex struct{}
+
+// NewMySQLMessageIndex 建立 MySQL 全文索引
+func NewMySQLMessageIndex() *MySQLMessageIndex {
+	return &MySQLMessageIndex{}
+}
+
+// Index MySQL 在寫入時自動更新全文索引
+func (MySQLMessageIndex) Index(message *models.Message) error {
+	return nil
+}
+
+// Remove MySQL 在刪除或清空內容時自動更新全文索引
+func (MySQLMessageIndex) Remove(messageID uint) error {
+	return nil
+}
+
+// booleanModeSpecials MySQL 布林模式中具特殊意義的字元
+const booleanModeSpecials = `+-<>()~*"@`
+
+// Search 以布林模式查詢，每個關鍵字都需以片語形式出現
+func (MySQLMessageIndex) Search(query MessageSearchQuery) ([]uint, error) {
+	phrases := make([]string, 0, len(query.Terms))
+	for _, term := range query.Terms {
+		term = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(booleanModeSpecials, r) {
+				return ' '
+			}
+			return r
+		}, term)
+		if term = strings.TrimSpace(term); term != "" {
+			phrases = append(phrases, `+"`+term+`"`)
+		}
+	}
+	if len(phrases) == 0 {
+		return []uint{}, nil
+	}
+
+	db := config.DB.Model(&models.Message{}).
+		Where("MATCH(content) AGAINST(? IN BOOLEAN MODE)", strings.Join(phrases, " ")).
+		Where("message_type <> ? AND recalled_at IS NULL", models.MessageTypeSystem).
+		Scopes(NotDeletedForUser(query.ViewerID))
+
+	// 只搜尋查詢者參與的對話
+	switch {
+	case query.RoomID != 0:
+		db = db.Where("room_id = ?", query.RoomID)
+	case query.PeerID != 0:
+		db = db.Where("((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))",
+			query.ViewerID, query.PeerID, query.PeerID, query.ViewerID)
+	case len(query.RoomIDs) > 0:
+		db = db.Where("(receiver_id IS NOT NULL AND (sender_id = ? OR receiver_id = ?)) OR room_id IN ?",
+			query.ViewerID, query.ViewerID, query.RoomIDs)
+	default:
+		db = db.Where("receiver_id IS NOT NULL AND (sender_id = ? OR receiver_id = ?)", query.ViewerID, query.ViewerID)
+	}
+
+	if query.SenderID != 0 {
+		db = db.Where("sender_id = ?", query.SenderID)
+	}
+	if query.MessageType != "" {
+		db = db.Where("message_type = ?", query.MessageType)
+	}
+	if !query.From.IsZero() {
+		db = db.Where("created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		db = db.Where("created_at < ?", query.To)
+	}
+	if query.BeforeID != 0 {
+		db = db.Where("id < ?", query.BeforeID)
+	}
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+
+	var ids []uint
+	err := db.Order("id DESC").Pluck("id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Payload service - 位置與名片等結構化訊息
+
+// 結構化訊息錯誤
+var (
+	ErrInvalidLocation     = errors.New("無效的位置：緯度需在 -90 到 90、經度需在 -180 到 180 之間，地點名稱最多 100 個字")
+	ErrInvalidLiveLocation = errors.New("即時位置分享的結束時間需在未來 8 小時內")
+	ErrLiveLocationEnded   = errors.New("即時位置分享已結束")
+	ErrNotLiveLocation     = errors.New("訊息不是自己發送的即時位置")
+	ErrInvalidContact      = errors.New("只能分享自己或好友的名片")
+	ErrNotContact          = errors.New("訊息不是名片")
+	ErrContactNotFound     = errors.New("分享的使用者不存在")
+)
+
+// 結構化訊息限制
+const (
+	MaxLocationLabelLength  = 100
+	MaxLiveLocationSharing  = 8 * time.Hour
+	MinLiveLocationInterval = 5 * time.Second // 同一連線回報同一則即時位置的最短間隔
+)
+
+// validCoordinates 檢查經緯度是否有效
+func validCoordinates(latitude, longitude float64) bool {
+	if math.IsNaN(latitude) || math.IsNaN(longitude) {
+		return false
+	}
+	return latitude >= -90 && latitude <= 90 && longitude >= -180 && longitude <= 180
+}
+
+// checkPayload 驗證位置與名片訊息，並以地點名稱或名片名稱作為文字內容（通知、搜尋與舊版客戶端使用）
+func checkPayload(params *SendMessageParams) error {
+	switch params.MessageType {
+	case models.MessageTypeLocation:
+		if params.Contact != nil || params.Location == nil {
+			return ErrInvalidLocation
+		}
+		return checkLocation(params)
+	case models.MessageTypeContact:
+		if params.Location != nil || params.Contact == nil {
+			return ErrInvalidContact
+		}
+		return checkContact(params)
+	}
+	if params.Location != nil || params.Contact != nil {
+		return ErrInvalidMessageType
+	}
+	return nil
+}
+
+// checkLocation 驗證位置訊息
+func checkLocation(params *SendMessageParams) error {
+	location := params.Location
+	location.Label = strings.TrimSpace(location.Label)
+	if !validCoordinates(location.Latitude, location.Longitude) ||
+		utf8.RuneCountInString(location.Label) > MaxLocationLabelLength {
+		return ErrInvalidLocation
+	}
+
+	now := time.Now()
+	if location.LiveUntil != nil {
+		if !location.LiveUntil.After(now) || location.LiveUntil.Sub(now) > MaxLiveLocationSharing {
+			return ErrInvalidLiveLocation
+		}
+		location.UpdatedAt = &now
+	} else {
+		location.UpdatedAt = nil
+	}
+
+	params.Content = location.Label
+	if params.Content == "" {
+		params.Content = "分享了位置"
+	}
+	return nil
+}
+
+// checkContact 驗證名片訊息，並以分享對象目前的資料建立名片快照
+func checkContact(params *SendMessageParams) error {
+	contactID := params.Contact.UserID
+	var user models.User
+	if err := config.DB.First(&user, contactID).Error; err != nil {
+		return ErrContactNotFound
+	}
+	if contactID != params.SenderID && !AreFriends(params.SenderID, contactID) {
+		return ErrInvalidContact
+	}
+
+	*params.Contact = models.ContactPayload{
+		UserID:      user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+	}
+
+	params.Content = user.DisplayName
+	if params.Content == "" {
+		params.Content = user.Username
+	}
+	return nil
+}
+
+// encodePayload 將位置或名片轉換為儲存用的 JSON
+func encodePayload(params SendMessageParams) (*string, error) {
+	if params.Location == nil && params.Contact == nil {
+		return nil, nil
+	}
+	payload := &models.MessagePayload{Location: params.Location, Contact: params.Contact}
+	return payload.Encode()
+}
+
+// liveLocationMessage 取得自己發送且仍在分享中的即時位置訊息
+func liveLocationMessage(messageID, userID uint, now time.Time) (*models.Message, *models.MessagePayload, error) {
+	message, err := GetAccessibleMessage(messageID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if message.SenderID != userID || message.MessageType != models.MessageTypeLocation || message.RecalledAt != nil {
+		return nil, nil, ErrNotLiveLocation
+	}
+	payload := message.DecodePayload()
+	if payload == nil || payload.Location == nil || payload.Location.LiveUntil == nil {
+		return nil, nil, ErrNotLiveLocation
+	}
+	if !payload.Location.IsLive(now) {
+		return nil, nil, ErrLiveLocationEnded
+	}
+	return message, payload, nil
+}
+
+// saveLocation 儲存更新後的位置內容
+func saveLocation(message *models.Message, payload *models.MessagePayload) error {
+	encoded, err := payload.Encode()
+	if err != nil {
+		return err
+	}
+	if err := config.DB.Model(&models.Message{}).Where("id = ?", message.ID).Update("payload", encoded).Error; err != nil {
+		return err
+	}
+	message.Payload = encoded
+	return nil
+}
+
+// UpdateLiveLocation 更新即時位置（發送者在分享期間定期回報）
+func UpdateLiveLocation(messageID, userID uint, latitude, longitude float64, now time.Time) (*models.Message, *models.LocationPayload, error) {
+	if !validCoordinates(latitude, longitude) {
+		return nil, nil, ErrInvalidLocation
+	}
+	message, payload, err := liveLocationMessage(messageID, userID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload.Location.Latitude = latitude
+	payload.Location.Longitude = longitude
+	payload.Location.UpdatedAt = &now
+	if err := saveLocation(message, payload); err != nil {
+		return nil, nil, err
+	}
+	return message, payload.Location, nil
+}
+
+// StopLiveLocation 提前結束即時位置分享
+func StopLiveLocation(messageID, userID uint, now time.Time) (*models.Message, *models.LocationPayload, error) {
+	message, payload, err := liveLocationMessage(messageID, userID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload.Location.LiveUntil = &now
+	if err := saveLocation(message, payload); err != nil {
+		return nil, nil, err
+	}
+	return message, payload.Location, nil
+}
+
+// GetSharedContact 取得名片訊息中分享的使用者（需為對話參與者）
+func GetSharedContact(messageID, userID uint) (*models.User, error) {
+	message, err := GetAccessibleMessage(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	payload := message.DecodePayload()
+	if message.MessageType != models.MessageTypeContact || message.RecalledAt != nil ||
+		payload == nil || payload.Contact == nil {
+		return nil, ErrNotContact
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, payload.Contact.UserID).Error; err != nil {
+		return nil, ErrContactNotFound
+	}
+	return &user, nil
+}
+
+// PushLocationUpdated 推送即時位置更新給對話所有參與者
+func (h *Hub) PushLocationUpdated(message *models.Message, location *models.LocationPayload) {
+	h.PushMessageEvent("location_updated", message.SenderID, message, location)
+}
+
+// allowLocationUpdate 限制連線回報即時位置的頻率，距離上次寫入不足 MinLiveLocationInterval 時回傳 false
+func (c *Client) allowLocationUpdate(messageID uint, now time.Time) bool {
+	if c.locationUpdatedAt == nil {
+		c.locationUpdatedAt = make(map[uint]time.Time)
+	}
+	if last, ok := c.locationUpdatedAt[messageID]; ok && now.Sub(last) < MinLiveLocationInterval {
+		return false
+	}
+	c.locationUpdatedAt[messageID] = now
+	return true
+}
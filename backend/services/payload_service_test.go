@@ -0,0 +1,255 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"gin-project/models"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidCoordinates(t *testing.T) {
+	tests := []struct {
+		latitude, longitude float64
+		want                bool
+	}{
+		{25.0330, 121.5654, true},
+		{-90, -180, true},
+		{90, 180, true},
+		{90.1, 0, false},
+		{-90.1, 0, false},
+		{0, 180.1, false},
+		{0, -180.1, false},
+		{math.NaN(), 0, false},
+		{0, math.NaN(), false},
+	}
+	for _, tt := range tests {
+		if got := validCoordinates(tt.latitude, tt.longitude); got != tt.want {
+			t.Errorf("validCoordinates(%v, %v) = %v，預期 %v", tt.latitude, tt.longitude, got, tt.want)
+		}
+	}
+}
+
+func TestAllowLocationUpdate(t *testing.T) {
+	client := &Client{}
+	now := time.Now()
+	tests := []struct {
+		name      string
+		messageID uint
+		at        time.Time
+		want      bool
+	}{
+		{"第一次回報", 1, now, true},
+		{"間隔太短", 1, now.Add(MinLiveLocationInterval - time.Millisecond), false},
+		{"其他位置訊息不受影響", 2, now.Add(time.Second), true},
+		{"間隔足夠", 1, now.Add(MinLiveLocationInterval), true},
+		{"從上次寫入重新計算", 1, now.Add(MinLiveLocationInterval + time.Second), false},
+	}
+	for _, tt := range tests {
+		if got := client.allowLocationUpdate(tt.messageID, tt.at); got != tt.want {
+			t.Errorf("%s: allowLocationUpdate = %v，預期 %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSocketMessagePayloadFields(t *testing.T) {
+	frame := `{"type":"message","receiver_id":2,"message_type":"location",
+		"location":{"latitude":25.03,"longitude":121.56,"label":"台北車站"},
+		"contact":{"user_id":3},
+		"poll":{"question":"午餐？","options":["拉麵","咖哩"]}}`
+	var message Message
+	if err := json.Unmarshal([]byte(frame), &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Location == nil || message.Location.Latitude != 25.03 || message.Location.Label != "台北車站" {
+		t.Fatalf("位置欄位解析錯誤: %+v", message.Location)
+	}
+	if message.Contact == nil || message.Contact.UserID != 3 {
+		t.Fatalf("名片欄位解析錯誤: %+v", message.Contact)
+	}
+	if message.Poll == nil || message.Poll.Question != "午餐？" || len(message.Poll.Options) != 2 {
+		t.Fatalf("投票欄位解析錯誤: %+v", message.Poll)
+	}
+
+	var update Message
+	if err := json.Unmarshal([]byte(`{"type":"location","message_id":1,"data":{"latitude":25.03,"longitude":121.56}}`), &update); err != nil {
+		t.Fatal(err)
+	}
+	if latitude, longitude, ok := locationCoordinates(update.Data); !ok || latitude != 25.03 || longitude != 121.56 {
+		t.Fatalf("即時位置解析錯誤: %v, %v, %v", latitude, longitude, ok)
+	}
+	if _, _, ok := locationCoordinates(map[string]interface{}{"latitude": "25"}); ok {
+		t.Fatal("缺少或格式錯誤的經緯度應解析失敗")
+	}
+}
+
+func TestSendLocation(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+
+	send := func(location *models.LocationPayload) (*models.Message, error) {
+		message, _, err := SaveMessageToDB(SendMessageParams{
+			SenderID:    users[0],
+			ReceiverID:  users[1],
+			MessageType: models.MessageTypeLocation,
+			Location:    location,
+		})
+		return message, err
+	}
+
+	// 地點名稱作為文字內容
+	message, err := send(&models.LocationPayload{Latitude: 25.0478, Longitude: 121.5170, Label: "  台北車站  "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := message.DecodePayload()
+	if message.Content != "台北車站" || payload == nil || payload.Location == nil ||
+		payload.Location.Label != "台北車站" || payload.Location.LiveUntil != nil || payload.Contact != nil {
+		t.Fatalf("位置訊息內容不正確: %q %+v", message.Content, payload)
+	}
+	if message, err := send(&models.LocationPayload{Latitude: 1, Longitude: 1}); err != nil || message.Content != "分享了位置" {
+		t.Fatalf("沒有地點名稱時應使用預設內容: %+v, %v", message, err)
+	}
+
+	now := time.Now()
+	past, tooLate := now.Add(-time.Minute), now.Add(MaxLiveLocationSharing+time.Minute)
+	tests := []struct {
+		name     string
+		location *models.LocationPayload
+		want     error
+	}{
+		{"缺少位置", nil, ErrInvalidLocation},
+		{"緯度超出範圍", &models.LocationPayload{Latitude: 91}, ErrInvalidLocation},
+		{"經度超出範圍", &models.LocationPayload{Longitude: -181}, ErrInvalidLocation},
+		{"地點名稱過長", &models.LocationPayload{Label: strings.Repeat("地", MaxLocationLabelLength+1)}, ErrInvalidLocation},
+		{"結束時間已過", &models.LocationPayload{LiveUntil: &past}, ErrInvalidLiveLocation},
+		{"分享時間過長", &models.LocationPayload{LiveUntil: &tooLate}, ErrInvalidLiveLocation},
+	}
+	for _, tt := range tests {
+		if _, err := send(tt.location); !errors.Is(err, tt.want) {
+			t.Errorf("%s: 應回傳 %v，得到 %v", tt.name, tt.want, err)
+		}
+	}
+
+	// 其他訊息類型不能附帶位置
+	if _, _, err := SaveMessageToDB(SendMessageParams{
+		SenderID: users[0], ReceiverID: users[1], Content: "文字", Location: &models.LocationPayload{},
+	}); !errors.Is(err, ErrInvalidMessageType) {
+		t.Fatalf("文字訊息附帶位置應回傳 ErrInvalidMessageType，得到 %v", err)
+	}
+}
+
+func TestUpdateLiveLocation(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 3)
+	makeTestFriends(t, users[0], users[1])
+
+	liveUntil := time.Now().Add(time.Hour)
+	live, _, err := SaveMessageToDB(SendMessageParams{
+		SenderID:    users[0],
+		ReceiverID:  users[1],
+		MessageType: models.MessageTypeLocation,
+		Location:    &models.LocationPayload{Latitude: 25, Longitude: 121, LiveUntil: &liveUntil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	static, _, err := SaveMessageToDB(SendMessageParams{
+		SenderID:    users[0],
+		ReceiverID:  users[1],
+		MessageType: models.MessageTypeLocation,
+		Location:    &models.LocationPayload{Latitude: 25, Longitude: 121},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if _, location, err := UpdateLiveLocation(live.ID, users[0], 25.5, 121.5, now); err != nil ||
+		location.Latitude != 25.5 || location.Longitude != 121.5 || location.UpdatedAt == nil {
+		t.Fatalf("更新即時位置失敗: %+v, %v", location, err)
+	}
+	if payload := loadWithRelations(t, live.ID).DecodePayload(); payload.Location.Latitude != 25.5 {
+		t.Fatalf("即時位置應寫入資料庫: %+v", payload.Location)
+	}
+
+	tests := []struct {
+		name      string
+		messageID uint
+		userID    uint
+		latitude  float64
+		want      error
+	}{
+		{"無效的座標", live.ID, users[0], 100, ErrInvalidLocation},
+		{"接收者不能更新", live.ID, users[1], 25, ErrNotLiveLocation},
+		{"非參與者", live.ID, users[2], 25, ErrMessageNotFound},
+		{"靜態位置", static.ID, users[0], 25, ErrNotLiveLocation},
+	}
+	for _, tt := range tests {
+		if _, _, err := UpdateLiveLocation(tt.messageID, tt.userID, tt.latitude, 121, now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: 應回傳 %v，得到 %v", tt.name, tt.want, err)
+		}
+	}
+
+	// 提前結束後不能再更新
+	if _, location, err := StopLiveLocation(live.ID, users[0], now); err != nil || location.IsLive(now) {
+		t.Fatalf("結束即時位置失敗: %+v, %v", location, err)
+	}
+	if _, _, err := UpdateLiveLocation(live.ID, users[0], 25, 121, now.Add(time.Second)); !errors.Is(err, ErrLiveLocationEnded) {
+		t.Fatalf("結束後更新應回傳 ErrLiveLocationEnded，得到 %v", err)
+	}
+}
+
+func TestSendContact(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 4)
+	makeTestFriends(t, users[0], users[1])
+	makeTestFriends(t, users[0], users[2])
+
+	send := func(contactID uint) (*models.Message, error) {
+		message, _, err := SaveMessageToDB(SendMessageParams{
+			SenderID:    users[0],
+			ReceiverID:  users[1],
+			MessageType: models.MessageTypeContact,
+			Contact:     &models.ContactPayload{UserID: contactID, Username: "偽造的名稱"},
+		})
+		return message, err
+	}
+
+	// 名片以分享對象目前的資料建立快照，忽略客戶端提供的資料
+	message, err := send(users[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := message.DecodePayload()
+	if payload == nil || payload.Contact == nil || payload.Contact.UserID != users[2] ||
+		payload.Contact.Username != "user3" || message.Content != "user3" {
+		t.Fatalf("名片內容不正確: %q %+v", message.Content, payload)
+	}
+	if _, err := send(users[0]); err != nil {
+		t.Fatalf("應可分享自己的名片: %v", err)
+	}
+
+	stranger := users[3]
+	if _, err := send(stranger); !errors.Is(err, ErrInvalidContact) {
+		t.Fatalf("分享非好友的名片應回傳 ErrInvalidContact，得到 %v", err)
+	}
+	if _, err := send(stranger + 100); !errors.Is(err, ErrContactNotFound) {
+		t.Fatalf("分享不存在的使用者應回傳 ErrContactNotFound，得到 %v", err)
+	}
+
+	// 只有對話參與者能取得名片中的使用者
+	if user, err := GetSharedContact(message.ID, users[1]); err != nil || user.ID != users[2] {
+		t.Fatalf("接收者應可取得名片: %+v, %v", user, err)
+	}
+	if _, err := GetSharedContact(message.ID, users[2]); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("非參與者應回傳 ErrMessageNotFound，得到 %v", err)
+	}
+	text := sendTestMessage(t, users[0], users[1], "文字")
+	if _, err := GetSharedContact(text.ID, users[1]); !errors.Is(err, ErrNotContact) {
+		t.Fatalf("非名片訊息應回傳 ErrNotContact，得到 %v", err)
+	}
+}
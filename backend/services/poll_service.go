@@ -0,0 +1,315 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Poll service - 投票訊息的建立、投票與統計
+
+// 投票錯誤
+var (
+	ErrInvalidPoll          = errors.New("投票需有題目與 2 到 10 個不重複的選項")
+	ErrInvalidPollCloseTime = errors.New("投票截止時間需在未來")
+	ErrNotPoll              = errors.New("訊息不是投票")
+	ErrPollClosed           = errors.New("投票已截止")
+	ErrInvalidPollVote      = errors.New("無效的投票選項")
+)
+
+// 投票限制
+const (
+	MaxPollQuestionLength = 200
+	MaxPollOptionLength   = 100
+	MinPollOptions        = 2
+	MaxPollOptions        = 10
+)
+
+// PollParams 建立投票參數（同時作為 WebSocket 訊息的 poll 欄位）
+type PollParams struct {
+	Question       string     `json:"question"`
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	Anonymous      bool       `json:"anonymous"`
+	ClosesAt       *time.Time `json:"closes_at,omitempty"`
+}
+
+// checkPoll 驗證投票內容並去除前後空白，題目同時作為訊息內容（用於預覽與搜尋）
+func checkPoll(params *SendMessageParams) error {
+	if params.MessageType != models.MessageTypePoll {
+		if params.Poll != nil {
+			return ErrInvalidMessageType
+		}
+		return nil
+	}
+	poll := params.Poll
+	if poll == nil {
+		return ErrInvalidPoll
+	}
+
+	poll.Question = strings.TrimSpace(poll.Question)
+	if poll.Question == "" || utf8.RuneCountInString(poll.Question) > MaxPollQuestionLength {
+		return ErrInvalidPoll
+	}
+	if len(poll.Options) < MinPollOptions || len(poll.Options) > MaxPollOptions {
+		return ErrInvalidPoll
+	}
+	seen := make(map[string]bool, len(poll.Options))
+	for i, option := range poll.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || utf8.RuneCountInString(option) > MaxPollOptionLength || seen[option] {
+			return ErrInvalidPoll
+		}
+		seen[option] = true
+		poll.Options[i] = option
+	}
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(time.Now()) {
+		return ErrInvalidPollCloseTime
+	}
+
+	params.Content = poll.Question
+	return nil
+}
+
+// createPoll 建立投票訊息的投票與選項
+func createPoll(tx *gorm.DB, messageID uint, params *PollParams) error {
+	poll := models.Poll{
+		MessageID:      messageID,
+		Question:       params.Question,
+		MultipleChoice: params.MultipleChoice,
+		Anonymous:      params.Anonymous,
+		ClosesAt:       params.ClosesAt,
+	}
+	for i, text := range params.Options {
+		poll.Options = append(poll.Options, models.PollOption{Position: i, Text: text})
+	}
+	return tx.Create(&poll).Error
+}
+
+// deletePoll 永久刪除訊息的投票、選項與投票紀錄
+func deletePoll(tx *gorm.DB, messageID uint) error {
+	var pollIDs []uint
+	if err := tx.Model(&models.Poll{}).Where("message_id = ?", messageID).Pluck("id", &pollIDs).Error; err != nil {
+		return err
+	}
+	if len(pollIDs) == 0 {
+		return nil
+	}
+	for _, related := range []interface{}{&models.PollVote{}, &models.PollOption{}} {
+		if err := tx.Where("poll_id IN ?", pollIDs).Delete(related).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("id IN ?", pollIDs).Delete(&models.Poll{}).Error
+}
+
+// loadPolls 以固定查詢次數載入多則訊息的投票、選項與投票紀錄
+func loadPolls(messageIDs []uint) (map[uint]*models.Poll, map[uint][]models.PollVote, error) {
+	polls := make(map[uint]*models.Poll)
+	votes := make(map[uint][]models.PollVote)
+	if len(messageIDs) == 0 {
+		return polls, votes, nil
+	}
+
+	var rows []models.Poll
+	if err := config.DB.Where("message_id IN ?", messageIDs).
+		Preload("Options", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
+		Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 {
+		return polls, votes, nil
+	}
+
+	pollIDs := make([]uint, 0, len(rows))
+	for i := range rows {
+		polls[rows[i].MessageID] = &rows[i]
+		pollIDs = append(pollIDs, rows[i].ID)
+	}
+
+	var voteRows []models.PollVote
+	if err := config.DB.Where("poll_id IN ?", pollIDs).Order("id ASC").Find(&voteRows).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, vote := range voteRows {
+		votes[vote.PollID] = append(votes[vote.PollID], vote)
+	}
+	return polls, votes, nil
+}
+
+// AttachPolls 載入多則投票訊息的題目與統計（含查詢者已投的選項），已收回的投票不顯示
+func AttachPolls(responses []models.MessageResponse, userID uint) {
+	messageIDs := make([]uint, 0)
+	for _, response := range responses {
+		if response.MessageType == models.MessageTypePoll && !response.Recalled {
+			messageIDs = append(messageIDs, response.ID)
+		}
+	}
+
+	polls, votes, err := loadPolls(messageIDs)
+	if err != nil || len(polls) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for i := range responses {
+		poll, ok := polls[responses[i].ID]
+		if !ok || responses[i].Recalled {
+			continue
+		}
+		tally := poll.ToResponse(votes[poll.ID], userID, now)
+		responses[i].Poll = &tally
+	}
+}
+
+// MessageResponseFor 轉換為查詢者角度的響應格式，投票訊息附上統計
+func MessageResponseFor(message *models.Message, userID uint) models.MessageResponse {
+	responses := []models.MessageResponse{message.ToResponse()}
+	AttachPolls(responses, userID)
+	return responses[0]
+}
+
+// pollForMessage 取得可投票的投票訊息與投票（需為對話參與者、未收回且未截止）
+func pollForMessage(messageID, userID uint, now time.Time) (*models.Message, *models.Poll, error) {
+	message, err := GetAccessibleMessage(messageID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if message.MessageType != models.MessageTypePoll {
+		return nil, nil, ErrNotPoll
+	}
+	if message.RecalledAt != nil {
+		return nil, nil, ErrMessageRecalled
+	}
+
+	var poll models.Poll
+	if err := config.DB.Where("message_id = ?", message.ID).
+		Preload("Options", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
+		First(&poll).Error; err != nil {
+		return nil, nil, ErrNotPoll
+	}
+	if poll.IsClosed(now) {
+		return nil, nil, ErrPollClosed
+	}
+	return message, &poll, nil
+}
+
+// lockOpenPoll 在交易中鎖定投票並確認尚未截止，同一投票的投票與收回依序處理
+// 等待鎖定期間可能已過截止時間，以取得鎖定後的時間重新檢查
+func lockOpenPoll(tx *gorm.DB, pollID uint, now time.Time) error {
+	var poll models.Poll
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&poll, pollID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotPoll
+		}
+		return err
+	}
+	if checkedAt := time.Now(); checkedAt.After(now) {
+		now = checkedAt
+	}
+	if poll.IsClosed(now) {
+		return ErrPollClosed
+	}
+	return nil
+}
+
+// VotePoll 投票，取代自己先前的選擇；單選投票只能選一個選項
+func VotePoll(messageID, userID uint, optionIDs []uint, now time.Time) (*models.Message, *models.Poll, error) {
+	message, poll, err := pollForMessage(messageID, userID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	optionIDs = uniqueIDs(optionIDs)
+	if len(optionIDs) == 0 || (!poll.MultipleChoice && len(optionIDs) > 1) {
+		return nil, nil, ErrInvalidPollVote
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockOpenPoll(tx, poll.ID, now); err != nil {
+			return err
+		}
+		var valid int64
+		if err := tx.Model(&models.PollOption{}).
+			Where("poll_id = ? AND id IN ?", poll.ID, optionIDs).
+			Count(&valid).Error; err != nil {
+			return err
+		}
+		if int(valid) != len(optionIDs) {
+			return ErrInvalidPollVote
+		}
+
+		votes := make([]models.PollVote, 0, len(optionIDs))
+		for _, optionID := range optionIDs {
+			votes = append(votes, models.PollVote{PollID: poll.ID, OptionID: optionID, UserID: userID, CreatedAt: now})
+		}
+		if err := tx.Where("poll_id = ? AND user_id = ?", poll.ID, userID).Delete(&models.PollVote{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&votes).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return message, poll, nil
+}
+
+// RetractPollVote 收回自己的投票
+func RetractPollVote(messageID, userID uint, now time.Time) (*models.Message, *models.Poll, error) {
+	message, poll, err := pollForMessage(messageID, userID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockOpenPoll(tx, poll.ID, now); err != nil {
+			return err
+		}
+		return tx.Where("poll_id = ? AND user_id = ?", poll.ID, userID).Delete(&models.PollVote{}).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return message, poll, nil
+}
+
+// PollTally 以查詢者角度統計投票結果
+func PollTally(poll *models.Poll, userID uint) (models.PollResponse, error) {
+	var votes []models.PollVote
+	if err := config.DB.Where("poll_id = ?", poll.ID).Order("id ASC").Find(&votes).Error; err != nil {
+		return models.PollResponse{}, err
+	}
+	return poll.ToResponse(votes, userID, time.Now()), nil
+}
+
+// PushPollUpdated 推送最新的投票統計給對話所有參與者，每位參與者收到以自己角度統計的結果
+func (h *Hub) PushPollUpdated(operatorID uint, message *models.Message, poll *models.Poll) {
+	var votes []models.PollVote
+	if err := config.DB.Where("poll_id = ?", poll.ID).Order("id ASC").Find(&votes).Error; err != nil {
+		return
+	}
+
+	// 匿名投票不透露投票者
+	if poll.Anonymous {
+		operatorID = 0
+	}
+
+	now := time.Now()
+	for _, userID := range append(h.recipientIDs(message), message.SenderID) {
+		h.SendToUser(userID, &Message{
+			Type:       "poll_updated",
+			SenderID:   operatorID,
+			ReceiverID: message.GetReceiverID(),
+			RoomID:     message.GetRoomID(),
+			MessageID:  message.ID,
+			Timestamp:  now.Format(time.RFC3339),
+			Data:       poll.ToResponse(votes, userID, now),
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// createTestPoll 以 users[0] 發送投票訊息給 users[1]，回傳訊息與依序的選項 ID
+func createTestPoll(t *testing.T, users []uint, poll PollParams) (*models.Message, []uint) {
+	t.Helper()
+	message, _, err := SaveMessageToDB(SendMessageParams{
+		SenderID:    users[0],
+		ReceiverID:  users[1],
+		MessageType: models.MessageTypePoll,
+		Poll:        &poll,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var optionIDs []uint
+	config.DB.Model(&models.PollOption{}).
+		Where("poll_id = (SELECT id FROM polls WHERE message_id = ?)", message.ID).
+		Order("position ASC").Pluck("id", &optionIDs)
+	if len(optionIDs) != len(poll.Options) {
+		t.Fatalf("建立了 %d 個選項，預期 %d 個", len(optionIDs), len(poll.Options))
+	}
+	return message, optionIDs
+}
+
+// tallyFor 以使用者角度取得投票統計
+func tallyFor(t *testing.T, messageID, userID uint) models.PollResponse {
+	t.Helper()
+	response := MessageResponseFor(&models.Message{ID: messageID, MessageType: models.MessageTypePoll}, userID)
+	if response.Poll == nil {
+		t.Fatal("投票訊息應附上統計")
+	}
+	return *response.Poll
+}
+
+func TestVotePollSingleChoice(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 3)
+	makeTestFriends(t, users[0], users[1])
+	message, options := createTestPoll(t, users, PollParams{Question: "午餐吃什麼？", Options: []string{"拉麵", "咖哩", "披薩"}})
+	now := time.Now()
+
+	if _, _, err := VotePoll(message.ID, users[0], []uint{options[0]}, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := VotePoll(message.ID, users[1], []uint{options[0]}, now); err != nil {
+		t.Fatal(err)
+	}
+	// 重新投票取代先前的選擇
+	if _, _, err := VotePoll(message.ID, users[1], []uint{options[2]}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	tally := tallyFor(t, message.ID, users[1])
+	if tally.TotalVoters != 2 {
+		t.Fatalf("投票人數為 %d，預期 2", tally.TotalVoters)
+	}
+	want := []struct {
+		votes     int
+		votedByMe bool
+		voters    []uint
+	}{{1, false, []uint{users[0]}}, {0, false, nil}, {1, true, []uint{users[1]}}}
+	for i, option := range tally.Options {
+		if option.Votes != want[i].votes || option.VotedByMe != want[i].votedByMe ||
+			len(option.Voters) != len(want[i].voters) || (len(option.Voters) > 0 && option.Voters[0] != want[i].voters[0]) {
+			t.Fatalf("選項 %d 統計為 %+v，預期 %+v", i, option, want[i])
+		}
+	}
+
+	// 單選投票不能選兩個選項，重複的選項視為一個
+	if _, _, err := VotePoll(message.ID, users[0], []uint{options[0], options[1]}, now); !errors.Is(err, ErrInvalidPollVote) {
+		t.Fatalf("單選投票選兩個選項應回傳 ErrInvalidPollVote，得到 %v", err)
+	}
+	if _, _, err := VotePoll(message.ID, users[0], []uint{options[1], options[1]}, now); err != nil {
+		t.Fatalf("重複的選項應視為一個，得到 %v", err)
+	}
+	if _, _, err := VotePoll(message.ID, users[0], nil, now); !errors.Is(err, ErrInvalidPollVote) {
+		t.Fatalf("沒有選項應回傳 ErrInvalidPollVote，得到 %v", err)
+	}
+
+	// 非對話參與者不能投票
+	if _, _, err := VotePoll(message.ID, users[2], []uint{options[0]}, now); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("非參與者投票應回傳 ErrMessageNotFound，得到 %v", err)
+	}
+
+	// 收回投票
+	if _, _, err := RetractPollVote(message.ID, users[1], now); err != nil {
+		t.Fatal(err)
+	}
+	tally = tallyFor(t, message.ID, users[1])
+	if tally.TotalVoters != 1 || tally.Options[2].Votes != 0 || tally.Options[2].VotedByMe {
+		t.Fatalf("收回後統計不正確: %+v", tally)
+	}
+}
+
+func TestVotePollRejectsOtherPollOptions(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+	message, _ := createTestPoll(t, users, PollParams{Question: "A？", Options: []string{"是", "否"}})
+	_, otherOptions := createTestPoll(t, users, PollParams{Question: "B？", Options: []string{"是", "否"}})
+
+	now := time.Now()
+	for _, optionIDs := range [][]uint{{otherOptions[0]}, {otherOptions[1] + 100}} {
+		if _, _, err := VotePoll(message.ID, users[1], optionIDs, now); !errors.Is(err, ErrInvalidPollVote) {
+			t.Fatalf("選項 %v 不屬於此投票，應回傳 ErrInvalidPollVote，得到 %v", optionIDs, err)
+		}
+	}
+	var count int64
+	config.DB.Model(&models.PollVote{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("無效的投票不應寫入，仍有 %d 筆", count)
+	}
+}
+
+func TestVotePollMultipleChoiceAnonymous(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+	message, options := createTestPoll(t, users, PollParams{
+		Question:       "哪些時段方便？",
+		Options:        []string{"早上", "下午", "晚上"},
+		MultipleChoice: true,
+		Anonymous:      true,
+	})
+	now := time.Now()
+
+	if _, _, err := VotePoll(message.ID, users[0], []uint{options[0], options[1]}, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := VotePoll(message.ID, users[1], []uint{options[1], options[2]}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	tally := tallyFor(t, message.ID, users[0])
+	if tally.TotalVoters != 2 {
+		t.Fatalf("投票人數為 %d，預期 2", tally.TotalVoters)
+	}
+	for i, votes := range []int{1, 2, 1} {
+		option := tally.Options[i]
+		if option.Votes != votes {
+			t.Fatalf("選項 %d 得票 %d，預期 %d", i, option.Votes, votes)
+		}
+		if option.VotedByMe != (i < 2) {
+			t.Fatalf("選項 %d 的 voted_by_me 為 %v", i, option.VotedByMe)
+		}
+		if len(option.Voters) != 0 {
+			t.Fatalf("匿名投票不應列出投票者，選項 %d 得到 %v", i, option.Voters)
+		}
+	}
+}
+
+func TestVotePollClosed(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+	closesAt := time.Now().Add(time.Hour)
+	message, options := createTestPoll(t, users, PollParams{Question: "要去嗎？", Options: []string{"要", "不要"}, ClosesAt: &closesAt})
+
+	afterClose := closesAt.Add(time.Second)
+	if _, _, err := VotePoll(message.ID, users[1], []uint{options[0]}, afterClose); !errors.Is(err, ErrPollClosed) {
+		t.Fatalf("截止後投票應回傳 ErrPollClosed，得到 %v", err)
+	}
+	if _, _, err := RetractPollVote(message.ID, users[1], afterClose); !errors.Is(err, ErrPollClosed) {
+		t.Fatalf("截止後收回投票應回傳 ErrPollClosed，得到 %v", err)
+	}
+
+	// 取得鎖定後以當下時間重新檢查，等待鎖定期間截止的投票不能再投
+	var poll models.Poll
+	if err := config.DB.Where("message_id = ?", message.ID).First(&poll).Error; err != nil {
+		t.Fatal(err)
+	}
+	config.DB.Model(&poll).Update("closes_at", time.Now().Add(-time.Second))
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return lockOpenPoll(tx, poll.ID, time.Now().Add(-time.Minute))
+	})
+	if !errors.Is(err, ErrPollClosed) {
+		t.Fatalf("鎖定後應重新檢查截止時間，得到 %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"sort"
+	"sync"
+)
+
+// PresenceRegistry 在線狀態登記，多實例部署時需由所有實例共享
+type PresenceRegistry interface {
+	// AddSession 登記使用者的一個連線，first 表示這是該使用者在整個叢集中的第一個連線
+	AddSession(userID uint, sessionID string) (first bool, err error)
+
+	// RemoveSession 移除使用者的一個連線，last 表示該使用者在整個叢集中已無連線
+	RemoveSession(userID uint, sessionID string) (last bool, err error)
+
+	// IsOnline 檢查使用者是否在任一實例上有連線
+	IsOnline(userID uint) bool
+
+	// OnlineUsers 取得所有在線使用者
+	OnlineUsers() []uint
+
+	// PruneStale 移除屬於已失效實例（例如當機）的連線，回傳因此在整個叢集中已無連線的使用者
+	// 同一位使用者只會由一個實例取得，由該實例負責廣播下線
+	PruneStale() ([]uint, error)
+
+	// Close 停止登記，本實例的連線視為離線
+	Close() error
+}
+
+// MemoryPresence 單一行程內的在線狀態登記（單機部署與測試用）
+type MemoryPresence struct {
+	mu       sync.RWMutex
+	sessions map[uint]map[string]struct{}
+}
+
+// NewMemoryPresence 建立記憶體在線狀態登記
+func NewMemoryPresence() *MemoryPresence {
+	return &MemoryPresence{
+		sessions: make(map[uint]map[string]struct{}),
+	}
+}
+
+// AddSession 登記連線
+func (p *MemoryPresence) AddSession(userID uint, sessionID string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sessions, ok := p.sessions[userID]
+	if !ok {
+		sessions = make(map[string]struct{})
+		p.sessions[userID] = sessions
+	}
+	sessions[sessionID] = struct{}{}
+	return len(sessions) == 1, nil
+}
+
+// RemoveSession 移除連線
+func (p *MemoryPresence) RemoveSession(userID uint, sessionID string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sessions, ok := p.sessions[userID]
+	if !ok {
+		return false, nil
+	}
+	if _, ok := sessions[sessionID]; !ok {
+		return false, nil
+	}
+
+	delete(sessions, sessionID)
+	if len(sessions) == 0 {
+		delete(p.sessions, userID)
+		return true, nil
+	}
+	return false, nil
+}
+
+// IsOnline 檢查使用者是否在線
+func (p *MemoryPresence) IsOnline(userID uint) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.sessions[userID]
+	return ok
+}
+
+// OnlineUsers 取得所有在線使用者
+func (p *MemoryPresence) OnlineUsers() []uint {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	users := make([]uint, 0, len(p.sessions))
+	for userID := range p.sessions {
+		users = append(users, userID)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	return users
+}
+
+// PruneStale 單一行程內沒有其他實例，不會有失效的連線
+func (p *MemoryPresence) PruneStale() ([]uint, error) {
+	return nil, nil
+}
+
+// Close 清除所有連線
+func (p *MemoryPresence) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sessions = make(map[uint]map[string]struct{})
+	return nil
+}
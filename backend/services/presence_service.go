@@ -0,0 +1,255 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Presence service - 好友在線狀態、自訂狀態與閒置偵測
+
+// 在線狀態錯誤
+var (
+	ErrInvalidPresenceStatus = errors.New("無效的在線狀態")
+	ErrStatusTextTooLong     = errors.New("狀態文字不能超過 140 個字元")
+	ErrInvalidStatusExpiry   = errors.New("狀態到期時間必須晚於目前時間")
+)
+
+// IsValidPresenceStatus 檢查使用者可設定的狀態是否有效
+func IsValidPresenceStatus(status string) bool {
+	switch status {
+	case models.PresenceOnline, models.PresenceAway, models.PresenceBusy, models.PresenceInvisible:
+		return true
+	}
+	return false
+}
+
+// RecordLastSeen 記錄使用者最後上線時間並回傳
+func RecordLastSeen(userID uint) time.Time {
+	now := time.Now()
+	config.DB.Model(&models.User{}).Where("id = ?", userID).Update("last_seen_at", now)
+	return now
+}
+
+// GetUserPresence 取得使用者自訂狀態，未設定時為 online；已到期的狀態視為 online
+func GetUserPresence(userID uint) models.UserPresence {
+	presence := models.UserPresence{UserID: userID, Status: models.PresenceOnline}
+	config.DB.Where("user_id = ?", userID).Limit(1).Find(&presence)
+
+	if presence.StatusExpiresAt != nil && !presence.StatusExpiresAt.After(time.Now()) {
+		presence.Status = models.PresenceOnline
+		presence.StatusText = ""
+		presence.StatusExpiresAt = nil
+	}
+	return presence
+}
+
+// SetUserPresence 設定使用者自訂狀態與狀態文字
+func SetUserPresence(userID uint, status, statusText string, expiresAt *time.Time) (models.UserPresence, error) {
+	if !IsValidPresenceStatus(status) {
+		return models.UserPresence{}, ErrInvalidPresenceStatus
+	}
+	if len([]rune(statusText)) > 140 {
+		return models.UserPresence{}, ErrStatusTextTooLong
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return models.UserPresence{}, ErrInvalidStatusExpiry
+	}
+
+	presence := models.UserPresence{
+		UserID:          userID,
+		Status:          status,
+		StatusText:      statusText,
+		StatusExpiresAt: expiresAt,
+	}
+	err := config.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"status", "status_text", "status_expires_at", "updated_at"}),
+	}).Create(&presence).Error
+	if err != nil {
+		return models.UserPresence{}, err
+	}
+	return GetUserPresence(userID), nil
+}
+
+// setUserIdle 更新使用者閒置狀態
+func setUserIdle(userID uint, idle bool) {
+	presence := models.UserPresence{UserID: userID, Status: models.PresenceOnline, Idle: idle}
+	if err := config.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"idle", "updated_at"}),
+	}).Create(&presence).Error; err != nil {
+		log.Printf("❌ 更新使用者 %d 閒置狀態失敗: %v", userID, err)
+	}
+}
+
+// ResolvePresence 計算他人看到的在線狀態
+// 未連線或隱身顯示為 offline；手動設定的 away / busy 優先於自動閒置
+func (h *Hub) ResolvePresence(user *models.User) models.PresenceResponse {
+	response := models.PresenceResponse{
+		UserID: user.ID,
+		Status: models.PresenceOffline,
+	}
+
+	presence := GetUserPresence(user.ID)
+	if !h.IsUserOnline(user.ID) || presence.Status == models.PresenceInvisible {
+		response.LastSeenAt = user.LastSeenAt
+		return response
+	}
+
+	response.IsOnline = true
+	response.Status = presence.Status
+	if presence.Status == models.PresenceOnline && presence.Idle {
+		response.Status = models.PresenceAway
+	}
+	response.StatusText = presence.StatusText
+	response.StatusExpiresAt = presence.StatusExpiresAt
+	return response
+}
+
+// FriendPresence 組合好友資料與在線狀態
+func (h *Hub) FriendPresence(friend *models.User) models.FriendPresenceResponse {
+	presence := h.ResolvePresence(friend)
+	return models.FriendPresenceResponse{
+		UserResponse:    friend.ToResponse(),
+		Status:          presence.Status,
+		StatusText:      presence.StatusText,
+		StatusExpiresAt: presence.StatusExpiresAt,
+		IsOnline:        presence.IsOnline,
+		LastSeenAt:      presence.LastSeenAt,
+	}
+}
+
+// BroadcastPresence 將使用者目前的在線狀態以 presence 事件推送給其好友（不會推送給陌生人）
+func (h *Hub) BroadcastPresence(userID uint) {
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		return
+	}
+
+	h.sendEphemeral(FriendIDs(userID), &Message{
+		Type:      "presence",
+		SenderID:  userID,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Data:      h.ResolvePresence(&user),
+	})
+}
+
+// markActivity 記錄連線活動；idle 為 true 表示客戶端回報已閒置（例如分頁隱藏）
+// 回傳值表示此連線的活躍狀態是否改變
+func (c *Client) markActivity(idle bool, timeout time.Duration) bool {
+	c.activityMu.Lock()
+	defer c.activityMu.Unlock()
+
+	now := time.Now()
+	wasActive := !c.reportedIdle && now.Sub(c.lastActivity) < timeout
+	c.reportedIdle = idle
+	if !idle {
+		c.lastActivity = now
+	}
+	return wasActive == idle
+}
+
+// isActive 檢查連線在閒置時限內是否有活動
+func (c *Client) isActive(now time.Time, timeout time.Duration) bool {
+	c.activityMu.Lock()
+	defer c.activityMu.Unlock()
+	return !c.reportedIdle && now.Sub(c.lastActivity) < timeout
+}
+
+// refreshIdle 依本實例的連線活動重新計算使用者是否閒置，狀態改變時推送給好友
+func (h *Hub) refreshIdle(userID uint) {
+	now := time.Now()
+
+	h.mu.RLock()
+	sessions := h.Clients[userID]
+	connected := len(sessions) > 0
+	active := false
+	for _, client := range sessions {
+		if client.isActive(now, h.IdleTimeout) {
+			active = true
+			break
+		}
+	}
+	h.mu.RUnlock()
+
+	if !connected {
+		return
+	}
+
+	h.idleMu.Lock()
+	wasIdle := h.idleUsers[userID]
+	if wasIdle == !active {
+		h.idleMu.Unlock()
+		return
+	}
+	if active {
+		delete(h.idleUsers, userID)
+	} else {
+		h.idleUsers[userID] = true
+	}
+	h.idleMu.Unlock()
+
+	setUserIdle(userID, !active)
+	h.BroadcastPresence(userID)
+}
+
+// RunPresenceMonitor 定期檢查閒置連線、失效實例的連線與已到期的自訂狀態
+func (h *Hub) RunPresenceMonitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// 重新計算本實例使用者的閒置狀態
+		h.mu.RLock()
+		userIDs := make([]uint, 0, len(h.Clients))
+		for userID := range h.Clients {
+			userIDs = append(userIDs, userID)
+		}
+		h.mu.RUnlock()
+
+		for _, userID := range userIDs {
+			h.refreshIdle(userID)
+		}
+
+		h.pruneStalePresence()
+		h.expireStatuses()
+	}
+}
+
+// pruneStalePresence 移除已失效實例（例如當機）的連線，並為因此離線的使用者廣播下線
+func (h *Hub) pruneStalePresence() {
+	offline, err := h.Presence.PruneStale()
+	if err != nil {
+		log.Printf("❌ 清除失效實例的連線失敗: %v", err)
+	}
+	for _, userID := range offline {
+		h.markOffline(userID)
+	}
+}
+
+// expireStatuses 將已到期的自訂狀態恢復為 online 並通知好友
+func (h *Hub) expireStatuses() {
+	var expired []models.UserPresence
+	if err := config.DB.Where("status_expires_at IS NOT NULL AND status_expires_at <= ?", time.Now()).
+		Find(&expired).Error; err != nil {
+		log.Printf("❌ 查詢到期狀態失敗: %v", err)
+		return
+	}
+
+	for _, presence := range expired {
+		// 條件更新避免覆蓋使用者剛設定的新狀態
+		result := config.DB.Model(&models.UserPresence{}).
+			Where("user_id = ? AND status_expires_at = ?", presence.UserID, presence.StatusExpiresAt).
+			Updates(map[string]interface{}{
+				"status":            models.PresenceOnline,
+				"status_text":       "",
+				"status_expires_at": nil,
+			})
+		if result.Error == nil && result.RowsAffected > 0 && h.IsUserOnline(presence.UserID) {
+			h.BroadcastPresence(presence.UserID)
+		}
+	}
+}
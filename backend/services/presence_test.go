@@ -0,0 +1,55 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemoryPresenceMultiSession(t *testing.T) {
+	presence := NewMemoryPresence()
+
+	if first, _ := presence.AddSession(1, "phone"); !first {
+		t.Fatal("第一個連線應回傳 first=true")
+	}
+	if first, _ := presence.AddSession(1, "laptop"); first {
+		t.Fatal("第二個連線應回傳 first=false")
+	}
+	presence.AddSession(3, "phone")
+
+	if !presence.IsOnline(1) || presence.IsOnline(2) {
+		t.Fatal("在線狀態不正確")
+	}
+	if got := presence.OnlineUsers(); !reflect.DeepEqual(got, []uint{1, 3}) {
+		t.Fatalf("OnlineUsers = %v，預期 [1 3]", got)
+	}
+
+	if last, _ := presence.RemoveSession(1, "phone"); last {
+		t.Fatal("仍有其他連線時應回傳 last=false")
+	}
+	if last, _ := presence.RemoveSession(1, "unknown"); last {
+		t.Fatal("移除不存在的連線不應回傳 last=true")
+	}
+	if last, _ := presence.RemoveSession(1, "laptop"); !last {
+		t.Fatal("最後一個連線應回傳 last=true")
+	}
+	if presence.IsOnline(1) {
+		t.Fatal("所有連線移除後應顯示離線")
+	}
+	if last, _ := presence.RemoveSession(1, "laptop"); last {
+		t.Fatal("重複移除不應回傳 last=true")
+	}
+}
+
+func TestMemoryPresencePruneStaleAndClose(t *testing.T) {
+	presence := NewMemoryPresence()
+	presence.AddSession(1, "phone")
+
+	if offline, err := presence.PruneStale(); err != nil || len(offline) != 0 {
+		t.Fatalf("單一實例不應有失效連線，得到 %v, %v", offline, err)
+	}
+
+	presence.Close()
+	if presence.IsOnline(1) || len(presence.OnlineUsers()) != 0 {
+		t.Fatal("關閉後所有連線應視為離線")
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"unicode"
+
+	"gorm.io/gorm/clause"
+)
+
+// Reaction service - 訊息表情回應
+
+// 表情回應錯誤
+var (
+	ErrInvalidEmoji     = errors.New("無效的表情")
+	ErrReactionNotFound = errors.New("尚未使用此表情回應")
+)
+
+// maxEmojiLength 表情最多字元數（與 message_reactions.emoji 欄位長度一致）
+const maxEmojiLength = 32
+
+// 組成表情序列的特殊字元
+const (
+	zeroWidthJoiner     = '\u200D'     // 連接組合表情的各個元素
+	variationSelector16 = '\uFE0F'     // 以表情樣式顯示前一個字元
+	combiningKeycap     = '\u20E3'     // 按鍵帽
+	blackFlag           = '\U0001F3F4' // 子區域旗幟的開頭
+	cancelTag           = '\U000E007F' // 子區域旗幟的結尾
+)
+
+// emojiPictographic 可單獨作為表情的圖形符號（不含膚色修飾與區域指示符號）
+var emojiPictographic = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00A9, Hi: 0x00A9, Stride: 1}, {Lo: 0x00AE, Hi: 0x00AE, Stride: 1},
+		{Lo: 0x203C, Hi: 0x203C, Stride: 1}, {Lo: 0x2049, Hi: 0x2049, Stride: 1},
+		{Lo: 0x2122, Hi: 0x2122, Stride: 1}, {Lo: 0x2139, Hi: 0x2139, Stride: 1},
+		{Lo: 0x2194, Hi: 0x2199, Stride: 1}, {Lo: 0x21A9, Hi: 0x21AA, Stride: 1},
+		{Lo: 0x231A, Hi: 0x231B, Stride: 1}, {Lo: 0x2328, Hi: 0x2328, Stride: 1},
+		{Lo: 0x23CF, Hi: 0x23CF, Stride: 1}, {Lo: 0x23E9, Hi: 0x23F3, Stride: 1},
+		{Lo: 0x23F8, Hi: 0x23FA, Stride: 1}, {Lo: 0x24C2, Hi: 0x24C2, Stride: 1},
+		{Lo: 0x25AA, Hi: 0x25AB, Stride: 1}, {Lo: 0x25B6, Hi: 0x25B6, Stride: 1},
+		{Lo: 0x25C0, Hi: 0x25C0, Stride: 1}, {Lo: 0x25FB, Hi: 0x25FE, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27BF, Stride: 1}, {Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2B05, Hi: 0x2B07, Stride: 1}, {Lo: 0x2B1B, Hi: 0x2B1C, Stride: 1},
+		{Lo: 0x2B50, Hi: 0x2B50, Stride: 1}, {Lo: 0x2B55, Hi: 0x2B55, Stride: 1},
+		{Lo: 0x3030, Hi: 0x3030, Stride: 1}, {Lo: 0x303D, Hi: 0x303D, Stride: 1},
+		{Lo: 0x3297, Hi: 0x3297, Stride: 1}, {Lo: 0x3299, Hi: 0x3299, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1F000, Hi: 0x1F0FF, Stride: 1}, {Lo: 0x1F170, Hi: 0x1F19A, Stride: 1},
+		{Lo: 0x1F200, Hi: 0x1F2FF, Stride: 1}, {Lo: 0x1F300, Hi: 0x1F3FA, Stride: 1},
+		{Lo: 0x1F400, Hi: 0x1F64F, Stride: 1}, {Lo: 0x1F680, Hi: 0x1F6FF, Stride: 1},
+		{Lo: 0x1F7E0, Hi: 0x1F7FF, Stride: 1}, {Lo: 0x1F900, Hi: 0x1F9FF, Stride: 1},
+		{Lo: 0x1FA70, Hi: 0x1FAFF, Stride: 1},
+	},
+	LatinOffset: 2,
+}
+
+func isRegionalIndicator(r rune) bool { return r >= 0x1F1E6 && r <= 0x1F1FF }
+func isSkinTone(r rune) bool          { return r >= 0x1F3FB && r <= 0x1F3FF }
+func isEmojiTag(r rune) bool          { return r >= 0xE0020 && r <= 0xE007E }
+func isKeycapBase(r rune) bool        { return (r >= '0' && r <= '9') || r == '#' || r == '*' }
+
+// IsValidEmoji 檢查是否為單一表情符號，可接受：
+// 單一圖形符號（可加上膚色修飾與 VS16）、以 ZWJ 連接的組合表情、國旗（兩個區域指示符號）、
+// 按鍵帽（0-9、#、* 加上 U+20E3）與子區域旗幟（🏴 加上標籤字元）
+func IsValidEmoji(emoji string) bool {
+	runes := []rune(emoji)
+	if len(runes) == 0 || len(runes) > maxEmojiLength {
+		return false
+	}
+
+	switch first := runes[0]; {
+	case isRegionalIndicator(first):
+		return len(runes) == 2 && isRegionalIndicator(runes[1])
+	case isKeycapBase(first):
+		rest := runes[1:]
+		if len(rest) == 2 && rest[0] == variationSelector16 {
+			rest = rest[1:]
+		}
+		return len(rest) == 1 && rest[0] == combiningKeycap
+	case first == blackFlag && len(runes) > 1 && isEmojiTag(runes[1]):
+		for _, r := range runes[1 : len(runes)-1] {
+			if !isEmojiTag(r) {
+				return false
+			}
+		}
+		return runes[len(runes)-1] == cancelTag
+	}
+
+	// 以 ZWJ 連接的元素，每個元素為圖形符號，後面可接膚色修飾與 VS16
+	for i := 0; i < len(runes); i++ {
+		if !unicode.Is(emojiPictographic, runes[i]) {
+			return false
+		}
+		if i+1 < len(runes) && isSkinTone(runes[i+1]) {
+			i++
+		}
+		if i+1 < len(runes) && runes[i+1] == variationSelector16 {
+			i++
+		}
+		if i+1 == len(runes) {
+			return true
+		}
+		if runes[i+1] != zeroWidthJoiner {
+			return false
+		}
+		i++
+	}
+	return false
+}
+
+// reactableMessage 取得可回應的訊息
+func reactableMessage(messageID, userID uint) (*models.Message, error) {
+	message, err := GetAccessibleMessage(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if message.RecalledAt != nil {
+		return nil, ErrMessageRecalled
+	}
+	return message, nil
+}
+
+// AddReaction 對訊息加上表情回應（重複回應不會報錯），回傳訊息與該表情目前的回應數
+func AddReaction(messageID, userID uint, emoji string) (*models.Message, int64, error) {
+	if !IsValidEmoji(emoji) {
+		return nil, 0, ErrInvalidEmoji
+	}
+	message, err := reactableMessage(messageID, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.MessageReaction{MessageID: messageID, UserID: userID, Emoji: emoji}).Error; err != nil {
+		return nil, 0, err
+	}
+	return message, countReactions(messageID, emoji), nil
+}
+
+// RemoveReaction 移除自己對訊息的表情回應，回傳訊息與該表情目前的回應數
+func RemoveReaction(messageID, userID uint, emoji string) (*models.Message, int64, error) {
+	message, err := GetAccessibleMessage(messageID, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := config.DB.Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Delete(&models.MessageReaction{})
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, 0, ErrReactionNotFound
+	}
+	return message, countReactions(messageID, emoji), nil
+}
+
+// countReactions 取得訊息某個表情的回應數
+func countReactions(messageID uint, emoji string) int64 {
+	var count int64
+	config.DB.Model(&models.MessageReaction{}).
+		Where("message_id = ? AND emoji = ?", messageID, emoji).
+		Count(&count)
+	return count
+}
+
+// AttachReactions 以單一查詢載入多則訊息的表情回應統計（含查詢者是否已回應）
+func AttachReactions(responses []models.MessageResponse, userID uint) {
+	if len(responses) == 0 {
+		return
+	}
+
+	messageIDs := make([]uint, 0, len(responses))
+	index := make(map[uint]int, len(responses))
+	for i, response := range responses {
+		messageIDs = append(messageIDs, response.ID)
+		index[response.ID] = i
+	}
+
+	var rows []struct {
+		MessageID   uint
+		Emoji       string
+		Count       int64
+		ReactedByMe bool
+	}
+	config.DB.Model(&models.MessageReaction{}).
+		Select("message_id, emoji, COUNT(*) AS count, MAX(user_id = ?) AS reacted_by_me", userID).
+		Where("message_id IN ?", messageIDs).
+		Group("message_id, emoji").
+		Order("MIN(id) ASC").
+		Scan(&rows)
+
+	for _, row := range rows {
+		i := index[row.MessageID]
+		responses[i].Reactions = append(responses[i].Reactions, models.ReactionSummary{
+			Emoji:       row.Emoji,
+			Count:       row.Count,
+			ReactedByMe: row.ReactedByMe,
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import "testing"
+
+func TestIsValidEmoji(t *testing.T) {
+	tests := []struct {
+		name  string
+		emoji string
+		want  bool
+	}{
+		{"單一表情", "👍", true},
+		{"基本多文種平面的符號", "❤", true},
+		{"加上 VS16", "❤️", true},
+		{"膚色修飾", "👍🏽", true},
+		{"ZWJ 組合表情", "👨‍👩‍👧‍👦", true},
+		{"ZWJ 組合含 VS16", "🏳️‍🌈", true},
+		{"ZWJ 組合含膚色修飾", "🧑🏻‍💻", true},
+		{"國旗", "🇹🇼", true},
+		{"按鍵帽", "#️⃣", true},
+		{"按鍵帽省略 VS16", "1\u20E3", true},
+		{"子區域旗幟", "🏴\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F", true},
+
+		{"空字串", "", false},
+		{"英文字", "abc", false},
+		{"加號與數字", "+1", false},
+		{"HTML", "<b>", false},
+		{"數字", "1", false},
+		{"中文", "讚", false},
+		{"兩個表情", "👍👍", false},
+		{"表情加文字", "👍ok", false},
+		{"前後空白", " 👍", false},
+		{"單一區域指示符號", "🇹", false},
+		{"三個區域指示符號", "🇹🇼🇹", false},
+		{"單獨的膚色修飾", "🏽", false},
+		{"單獨的 VS16", "\uFE0F", false},
+		{"結尾的 ZWJ", "👨\u200D", false},
+		{"連續的 ZWJ", "👨\u200D\u200D👩", false},
+		{"ZWJ 連接文字", "👨\u200Da", false},
+		{"按鍵帽缺少 U+20E3", "#\uFE0F", false},
+		{"子區域旗幟缺少結尾", "🏴\U000E0067\U000E0062", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidEmoji(tt.emoji); got != tt.want {
+				t.Fatalf("IsValidEmoji(%q) = %v，預期 %v", tt.emoji, got, tt.want)
+			}
+		})
+	}
+}
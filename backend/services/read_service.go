@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Read service - 對話已讀位置與已讀回執
+
+// 已讀錯誤
+var (
+	ErrReadTargetMissing = errors.New("需指定好友或聊天室其中之一")
+	ErrNothingToRead     = errors.New("對話中沒有訊息")
+)
+
+// MarkReadParams 標記已讀參數
+type MarkReadParams struct {
+	UserID    uint
+	PeerID    uint // 私訊對象（與 RoomID 擇一）
+	RoomID    uint // 群組聊天室
+	MessageID uint // 已讀到的訊息，0 表示對話中最新的訊息
+}
+
+// conversationScope 限定對話範圍的查詢條件（以讀者角度）
+func (p MarkReadParams) conversationScope(db *gorm.DB) *gorm.DB {
+	if p.RoomID != 0 {
+		return db.Where("room_id = ?", p.RoomID)
+	}
+	return db.Where("((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))",
+		p.UserID, p.PeerID, p.PeerID, p.UserID)
+}
+
+// ReadReceipt 已讀位置前進的結果
+type ReadReceipt struct {
+	UserID            uint      `json:"user_id"` // 讀者
+	PeerID            uint      `json:"peer_id,omitempty"`
+	RoomID            uint      `json:"room_id,omitempty"`
+	LastReadMessageID uint      `json:"last_read_message_id"`
+	PreviousMessageID uint      `json:"-"`
+	ReadAt            time.Time `json:"read_at"`
+}
+
+// MarkConversationRead 將使用者在對話中的已讀位置前進到指定訊息
+// 已讀位置只會前進，回傳 nil 表示位置沒有變動
+func MarkConversationRead(params MarkReadParams) (*ReadReceipt, error) {
+	if (params.PeerID == 0) == (params.RoomID == 0) {
+		return nil, ErrReadTargetMissing
+	}
+	if params.RoomID != 0 {
+		if !IsRoomMember(params.RoomID, params.UserID) {
+			return nil, ErrNotRoomMember
+		}
+	} else if !AreFriends(params.UserID, params.PeerID) {
+		return nil, ErrNotFriend
+	}
+
+	// 確認訊息屬於此對話；未指定時取最新的訊息
+	db := config.DB.Model(&models.Message{}).Scopes(params.conversationScope)
+	if params.MessageID != 0 {
+		db = db.Where("id = ?", params.MessageID)
+	}
+	var ids []uint
+	if err := db.Order("id DESC").Limit(1).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		if params.MessageID != 0 {
+			return nil, ErrMessageNotFound
+		}
+		return nil, ErrNothingToRead
+	}
+	messageID := ids[0]
+
+	var receipt *ReadReceipt
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		watermark := models.ReadWatermark{UserID: params.UserID, PeerID: params.PeerID, RoomID: params.RoomID}
+		if err := clearMarkedUnread(tx, params.UserID, params.PeerID, params.RoomID); err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&watermark).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND peer_id = ? AND room_id = ?", params.UserID, params.PeerID, params.RoomID).
+			First(&watermark).Error; err != nil {
+			return err
+		}
+		if watermark.LastReadMessageID >= messageID {
+			return nil
+		}
+		// Updates 會把新值寫回 watermark，先保留前進前的位置
+		previousID := watermark.LastReadMessageID
+
+		now := time.Now()
+		if err := tx.Model(&watermark).Updates(map[string]interface{}{
+			"last_read_message_id": messageID,
+			"updated_at":           now,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := refreshUnreadCount(tx, params.UserID, params.PeerID, params.RoomID, messageID); err != nil {
+			return err
+		}
+		if err := startDisappearingOnRead(tx, params, previousID, messageID, now); err != nil {
+			return err
+		}
+
+		// 同步私訊的 is_read 欄位（訊息回應中的 is_read 使用）
+		if params.PeerID != 0 {
+			if err := tx.Model(&models.Message{}).
+				Where("sender_id = ? AND receiver_id = ? AND id <= ? AND is_read = ?", params.PeerID, params.UserID, messageID, false).
+				Update("is_read", true).Error; err != nil {
+				return err
+			}
+		}
+
+		receipt = &ReadReceipt{
+			UserID:            params.UserID,
+			PeerID:            params.PeerID,
+			RoomID:            params.RoomID,
+			LastReadMessageID: messageID,
+			PreviousMessageID: previousID,
+			ReadAt:            now,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// ConversationWatermarks 取得對話中其他參與者的已讀位置
+func ConversationWatermarks(userID, peerID, roomID uint) []models.ReadWatermark {
+	watermarks := []models.ReadWatermark{}
+	if roomID != 0 {
+		config.DB.Where("room_id = ? AND user_id <> ?", roomID, userID).Find(&watermarks)
+	} else {
+		config.DB.Where("user_id = ? AND peer_id = ?", peerID, userID).Find(&watermarks)
+	}
+	return watermarks
+}
+
+// GetMessageReadStatus 取得訊息在對話成員間的已讀狀態（不含發送者本人）
+func GetMessageReadStatus(messageID, userID uint) (*models.MessageReadStatus, error) {
+	message, err := GetAccessibleMessage(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var memberIDs []uint
+	if message.IsRoomMessage() {
+		memberIDs = RoomMemberIDs(message.GetRoomID())
+	} else {
+		memberIDs = []uint{message.SenderID, message.GetReceiverID()}
+	}
+
+	readers := make(map[uint]bool)
+	var readerIDs []uint
+	query := config.DB.Model(&models.ReadWatermark{}).Where("last_read_message_id >= ?", message.ID)
+	if message.IsRoomMessage() {
+		query = query.Where("room_id = ?", message.GetRoomID())
+	} else {
+		query = query.Where("user_id = ? AND peer_id = ?", message.GetReceiverID(), message.SenderID)
+	}
+	query.Pluck("user_id", &readerIDs)
+	for _, id := range readerIDs {
+		readers[id] = true
+	}
+
+	var users []models.User
+	config.DB.Where("id IN ?", memberIDs).Order("id ASC").Find(&users)
+
+	status := &models.MessageReadStatus{
+		MessageID: message.ID,
+		ReadBy:    []models.UserResponse{},
+		UnreadBy:  []models.UserResponse{},
+	}
+	for _, user := range users {
+		if user.ID == message.SenderID {
+			continue
+		}
+		if readers[user.ID] {
+			status.ReadBy = append(status.ReadBy, user.ToResponse())
+		} else {
+			status.UnreadBy = append(status.UnreadBy, user.ToResponse())
+		}
+	}
+	return status, nil
+}
+
+// PushReadReceipt 推送 read_receipt 事件給被讀取訊息的發送者與讀者自己的其他裝置
+// 私訊推送給對方；群組只推送給此次新讀到的訊息的發送者
+func (h *Hub) PushReadReceipt(receipt *ReadReceipt) {
+	event := &Message{
+		Type:      "read_receipt",
+		SenderID:  receipt.UserID,
+		RoomID:    receipt.RoomID,
+		MessageID: receipt.LastReadMessageID,
+		Timestamp: receipt.ReadAt.Format(time.RFC3339),
+		Data:      receipt,
+	}
+
+	var recipients []uint
+	if receipt.RoomID != 0 {
+		config.DB.Model(&models.Message{}).
+			Where("room_id = ? AND id > ? AND id <= ? AND sender_id <> ?",
+				receipt.RoomID, receipt.PreviousMessageID, receipt.LastReadMessageID, receipt.UserID).
+			Distinct("sender_id").
+			Pluck("sender_id", &recipients)
+	} else {
+		event.ReceiverID = receipt.PeerID
+		recipients = []uint{receipt.PeerID}
+	}
+
+	for _, userID := range recipients {
+		h.SendToUser(userID, event)
+	}
+	h.SendToUser(receipt.UserID, event)
+}
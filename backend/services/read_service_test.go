@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"testing"
+)
+
+// unreadFrom 計算 receiverID 尚未讀取的 senderID 私訊數
+func unreadFrom(t *testing.T, senderID, receiverID uint) int64 {
+	t.Helper()
+	var count int64
+	if err := config.DB.Model(&models.Message{}).
+		Where("sender_id = ? AND receiver_id = ? AND is_read = ?", senderID, receiverID, false).
+		Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestMarkConversationRead(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 3)
+	makeTestFriends(t, users[0], users[1])
+	makeTestFriends(t, users[0], users[2])
+
+	var ids []uint
+	for _, content := range []string{"一", "二", "三"} {
+		ids = append(ids, sendTestMessage(t, users[1], users[0], content).ID)
+	}
+	mine := sendTestMessage(t, users[0], users[1], "自己的訊息")
+	if unread := unreadFrom(t, users[1], users[0]); unread != 3 {
+		t.Fatalf("未讀數為 %d，預期 3", unread)
+	}
+
+	// 讀到第二則：之前的訊息都算已讀
+	receipt, err := MarkConversationRead(MarkReadParams{UserID: users[0], PeerID: users[1], MessageID: ids[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt == nil || receipt.LastReadMessageID != ids[1] || receipt.PreviousMessageID != 0 {
+		t.Fatalf("已讀回執不正確: %+v", receipt)
+	}
+	if unread := unreadFrom(t, users[1], users[0]); unread != 1 {
+		t.Fatalf("未讀數為 %d，預期 1", unread)
+	}
+
+	// 已讀位置不會倒退
+	if receipt, err := MarkConversationRead(MarkReadParams{UserID: users[0], PeerID: users[1], MessageID: ids[0]}); err != nil || receipt != nil {
+		t.Fatalf("已讀位置倒退時不應產生回執，得到 %+v, %v", receipt, err)
+	}
+
+	// 未指定訊息時讀到最新一則（含自己發送的訊息）
+	receipt, err = MarkConversationRead(MarkReadParams{UserID: users[0], PeerID: users[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt == nil || receipt.LastReadMessageID != mine.ID || receipt.PreviousMessageID != ids[1] {
+		t.Fatalf("已讀回執不正確: %+v", receipt)
+	}
+	if unread := unreadFrom(t, users[1], users[0]); unread != 0 {
+		t.Fatalf("未讀數為 %d，預期 0", unread)
+	}
+	// 讀者自己發送的訊息不受影響
+	if unread := unreadFrom(t, users[0], users[1]); unread != 1 {
+		t.Fatalf("對方的未讀數為 %d，預期 1", unread)
+	}
+
+	watermarks := ConversationWatermarks(users[1], users[0], 0)
+	if len(watermarks) != 1 || watermarks[0].UserID != users[0] || watermarks[0].LastReadMessageID != mine.ID {
+		t.Fatalf("對方看到的已讀位置不正確: %+v", watermarks)
+	}
+
+	other := sendTestMessage(t, users[0], users[2], "其他對話")
+	if _, err := MarkConversationRead(MarkReadParams{UserID: users[1], PeerID: users[0], MessageID: other.ID}); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("其他對話的訊息應回傳 ErrMessageNotFound，得到 %v", err)
+	}
+	if _, err := MarkConversationRead(MarkReadParams{UserID: users[0], PeerID: users[1], RoomID: 1}); !errors.Is(err, ErrReadTargetMissing) {
+		t.Fatalf("同時指定好友與聊天室應回傳 ErrReadTargetMissing，得到 %v", err)
+	}
+}
+
+func TestMarkConversationReadNothingToRead(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+	if _, err := MarkConversationRead(MarkReadParams{UserID: users[0], PeerID: users[1]}); !errors.Is(err, ErrNothingToRead) {
+		t.Fatalf("沒有訊息的對話應回傳 ErrNothingToRead，得到 %v", err)
+	}
+}
+
+func TestRoomMessageReadStatus(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 4)
+	makeTestFriends(t, users[0], users[1])
+	makeTestFriends(t, users[0], users[2])
+	room := createTestRoom(t, users[0], users[1], users[2])
+
+	first, _, err := SaveMessageToDB(SendMessageParams{SenderID: users[0], RoomID: room.ID, Content: "第一則"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := SaveMessageToDB(SendMessageParams{SenderID: users[0], RoomID: room.ID, Content: "第二則"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MarkConversationRead(MarkReadParams{UserID: users[3], RoomID: room.ID}); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("非成員標記已讀應回傳 ErrNotRoomMember，得到 %v", err)
+	}
+	if _, err := MarkConversationRead(MarkReadParams{UserID: users[1], RoomID: room.ID, MessageID: first.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MarkConversationRead(MarkReadParams{UserID: users[2], RoomID: room.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 已讀位置之前的訊息都算已讀，不含發送者本人
+	userIDs := func(responses []models.UserResponse) []uint {
+		ids := make([]uint, 0, len(responses))
+		for _, response := range responses {
+			ids = append(ids, response.ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		messageID    uint
+		read, unread []uint
+	}{
+		{first.ID, []uint{users[1], users[2]}, []uint{}},
+		{second.ID, []uint{users[2]}, []uint{users[1]}},
+	}
+	for _, tt := range tests {
+		status, err := GetMessageReadStatus(tt.messageID, users[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, unread := userIDs(status.ReadBy), userIDs(status.UnreadBy)
+		if !equalIDs(read, tt.read) || !equalIDs(unread, tt.unread) {
+			t.Errorf("訊息 %d 已讀 %v、未讀 %v，預期已讀 %v、未讀 %v", tt.messageID, read, unread, tt.read, tt.unread)
+		}
+	}
+}
+
+func equalIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
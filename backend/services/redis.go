@@ -0,0 +1,279 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// redisError Redis 回傳的錯誤回覆
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisConn 最小化的 Redis RESP 協定客戶端，只實作本專案需要的功能
+// 任何相容 RESP 協定的伺服器（包含測試用的替身）皆可使用
+type redisConn struct {
+	addr     string
+	password string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialRedis 建立 Redis 連線
+func dialRedis(addr, password string) (*redisConn, error) {
+	c := &redisConn{addr: addr, password: password}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect 建立底層連線並驗證密碼（呼叫者需持有鎖或在初始化階段呼叫）
+func (c *redisConn) connect() error {
+	conn, err := net.DialTimeout("tcp", c.addr, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("無法連接到 Redis %s: %v", c.addr, err)
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+
+	if c.password != "" {
+		if err := c.writeCommand("AUTH", c.password); err != nil {
+			c.reset()
+			return err
+		}
+		if _, err := c.readReply(); err != nil {
+			c.reset()
+			return err
+		}
+	}
+	return nil
+}
+
+// reset 關閉底層連線，下次使用時重新連線
+func (c *redisConn) reset() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = nil
+	c.r = nil
+}
+
+// Do 執行單一指令並回傳回覆
+func (c *redisConn) Do(args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	replies, err := c.pipeline([][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := replies[0].(redisError); ok {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// Transaction 以 MULTI/EXEC 原子執行多個指令，回傳各指令的結果
+func (c *redisConn) Transaction(commands ...[]string) ([]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	batch := make([][]string, 0, len(commands)+2)
+	batch = append(batch, []string{"MULTI"})
+	batch = append(batch, commands...)
+	batch = append(batch, []string{"EXEC"})
+
+	replies, err := c.pipeline(batch)
+	if err != nil {
+		return nil, err
+	}
+	for _, reply := range replies {
+		if err, ok := reply.(redisError); ok {
+			return nil, err
+		}
+	}
+
+	results, ok := replies[len(replies)-1].([]interface{})
+	if !ok {
+		return nil, errors.New("redis: 交易被中止")
+	}
+	return results, nil
+}
+
+// pipeline 依序送出多個指令並讀取對應回覆（呼叫者需持有鎖）
+// 連線錯誤時會重連一次再重試
+func (c *redisConn) pipeline(commands [][]string) ([]interface{}, error) {
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.conn == nil {
+			if err := c.connect(); err != nil {
+				return nil, err
+			}
+		}
+
+		replies, err := c.roundTrip(commands)
+		if err == nil {
+			return replies, nil
+		}
+		lastErr = err
+		c.reset()
+	}
+	return nil, lastErr
+}
+
+// roundTrip 寫入指令並讀取回覆
+func (c *redisConn) roundTrip(commands [][]string) ([]interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	defer c.conn.SetDeadline(time.Time{})
+
+	for _, args := range commands {
+		if err := c.writeCommand(args...); err != nil {
+			return nil, err
+		}
+	}
+
+	replies := make([]interface{}, 0, len(commands))
+	for range commands {
+		reply, err := c.readReply()
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+// writeCommand 以 RESP 陣列格式寫入指令
+func (c *redisConn) writeCommand(args ...string) error {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// readReply 讀取一個 RESP 回覆
+func (c *redisConn) readReply() (interface{}, error) {
+	return readRESP(c.r)
+}
+
+// readRESP 從 reader 讀取一個 RESP 回覆
+// 回傳型別：string（簡單字串）、redisError、int64、[]byte（nil 表示空值）、[]interface{}
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: 空白回覆")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return []byte(nil), nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			item, err := readRESP(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: 無法識別的回覆 %q", line)
+}
+
+// readLine 讀取一行並去除結尾的 CRLF
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: 格式錯誤的回覆 %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// Close 關閉連線
+func (c *redisConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reset()
+	return nil
+}
+
+// replyInt 將回覆轉為整數
+func replyInt(reply interface{}) int64 {
+	switch v := reply.(type) {
+	case int64:
+		return v
+	case []byte:
+		n, _ := strconv.ParseInt(string(v), 10, 64)
+		return n
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// replyStrings 將陣列回覆轉為字串切片
+func replyStrings(reply interface{}) []string {
+	items, _ := reply.([]interface{})
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case []byte:
+			values = append(values, string(v))
+		case string:
+			values = append(values, v)
+		}
+	}
+	return values
+}
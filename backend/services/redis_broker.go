@@ -0,0 +1,405 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisBroker 以 Redis pub/sub 實作的跨實例訊息代理
+type RedisBroker struct {
+	pub *redisConn
+	sub *redisConn
+
+	mu       sync.RWMutex
+	handlers map[string][]func(payload []byte)
+
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewRedisBroker 連接 Redis 並啟動訂閱迴圈
+func NewRedisBroker(addr, password string) (*RedisBroker, error) {
+	pub, err := dialRedis(addr, password)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := dialRedis(addr, password)
+	if err != nil {
+		pub.Close()
+		return nil, err
+	}
+
+	b := &RedisBroker{
+		pub:      pub,
+		sub:      sub,
+		handlers: make(map[string][]func(payload []byte)),
+		closed:   make(chan struct{}),
+	}
+	go b.receiveLoop()
+	return b, nil
+}
+
+// Publish 發布訊息
+func (b *RedisBroker) Publish(channel string, payload []byte) error {
+	_, err := b.pub.Do("PUBLISH", channel, string(payload))
+	return err
+}
+
+// Subscribe 訂閱頻道，第一次訂閱某頻道時才送出 SUBSCRIBE
+func (b *RedisBroker) Subscribe(channel string, handler func(payload []byte)) error {
+	b.mu.Lock()
+	_, exists := b.handlers[channel]
+	b.handlers[channel] = append(b.handlers[channel], handler)
+	b.mu.Unlock()
+
+	if exists {
+		return nil
+	}
+
+	b.sub.mu.Lock()
+	defer b.sub.mu.Unlock()
+	if b.sub.conn == nil {
+		// 訂閱迴圈重連時會重新訂閱所有頻道
+		return nil
+	}
+	return b.sub.writeCommand("SUBSCRIBE", channel)
+}
+
+// Close 關閉連線並停止訂閱迴圈
+func (b *RedisBroker) Close() error {
+	b.once.Do(func() {
+		close(b.closed)
+		b.pub.Close()
+		b.sub.Close()
+	})
+	return nil
+}
+
+// receiveLoop 持續讀取訂閱訊息，斷線時自動重連並重新訂閱
+func (b *RedisBroker) receiveLoop() {
+	backoff := time.Second
+	for {
+		select {
+		case <-b.closed:
+			return
+		default:
+		}
+
+		b.sub.mu.Lock()
+		reader := b.sub.r
+		b.sub.mu.Unlock()
+
+		if reader == nil {
+			if err := b.resubscribe(); err != nil {
+				log.Printf("❌ Redis 訂閱重連失敗: %v", err)
+				select {
+				case <-b.closed:
+					return
+				case <-time.After(backoff):
+				}
+				if backoff < 30*time.Second {
+					backoff *= 2
+				}
+				continue
+			}
+			// 重新連線後重新取得 reader
+			backoff = time.Second
+			continue
+		}
+
+		reply, err := readRESP(reader)
+		if err != nil {
+			select {
+			case <-b.closed:
+				return
+			default:
+			}
+			log.Printf("⚠ Redis 訂閱連線中斷: %v", err)
+			b.sub.mu.Lock()
+			b.sub.reset()
+			b.sub.mu.Unlock()
+			continue
+		}
+
+		b.dispatch(reply)
+	}
+}
+
+// resubscribe 重新連線並訂閱所有已登記的頻道
+func (b *RedisBroker) resubscribe() error {
+	b.mu.RLock()
+	channels := make([]string, 0, len(b.handlers))
+	for channel := range b.handlers {
+		channels = append(channels, channel)
+	}
+	b.mu.RUnlock()
+
+	b.sub.mu.Lock()
+	defer b.sub.mu.Unlock()
+
+	if err := b.sub.connect(); err != nil {
+		return err
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+	return b.sub.writeCommand(append([]string{"SUBSCRIBE"}, channels...)...)
+}
+
+// dispatch 將 "message" 推送分派給對應頻道的處理函式
+func (b *RedisBroker) dispatch(reply interface{}) {
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != 3 {
+		return
+	}
+	parts := replyStrings(items[:2])
+	if len(parts) != 2 || parts[0] != "message" {
+		return
+	}
+	payload, ok := items[2].([]byte)
+	if !ok {
+		return
+	}
+
+	b.mu.RLock()
+	handlers := append([]func(payload []byte){}, b.handlers[parts[1]]...)
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+}
+
+// Redis 在線狀態登記使用的鍵
+const (
+	presenceOnlineKey      = "easychat:presence:online"
+	presenceUserKeyPrefix  = "easychat:presence:user:"
+	presenceAliveKeyPrefix = "easychat:presence:alive:"
+)
+
+// RedisPresence 以 Redis 實作的叢集在線狀態登記
+// 每個實例定期更新存活鍵，實例當機後其連線會在存活鍵過期時被視為離線
+type RedisPresence struct {
+	conn       *redisConn
+	instanceID string
+	ttl        time.Duration
+
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewRedisPresence 建立 Redis 在線狀態登記並開始維持實例存活鍵
+func NewRedisPresence(addr, password, instanceID string) (*RedisPresence, error) {
+	conn, err := dialRedis(addr, password)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &RedisPresence{
+		conn:       conn,
+		instanceID: instanceID,
+		ttl:        30 * time.Second,
+		closed:     make(chan struct{}),
+	}
+	if err := p.refresh(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go p.keepAlive()
+	return p, nil
+}
+
+// AddSession 登記連線
+func (p *RedisPresence) AddSession(userID uint, sessionID string) (bool, error) {
+	p.pruneStale(userID)
+
+	key := presenceUserKey(userID)
+	results, err := p.conn.Transaction(
+		[]string{"SADD", key, p.member(sessionID)},
+		[]string{"SCARD", key},
+		[]string{"SADD", presenceOnlineKey, strconv.FormatUint(uint64(userID), 10)},
+	)
+	if err != nil {
+		return false, err
+	}
+	return replyInt(results[1]) == 1, nil
+}
+
+// RemoveSession 移除連線
+func (p *RedisPresence) RemoveSession(userID uint, sessionID string) (bool, error) {
+	removed, err := p.conn.Do("SREM", presenceUserKey(userID), p.member(sessionID))
+	if err != nil {
+		return false, err
+	}
+	if replyInt(removed) == 0 {
+		return false, nil
+	}
+
+	p.pruneStale(userID)
+	if p.countSessions(userID) > 0 {
+		return false, nil
+	}
+	return p.markOffline(userID)
+}
+
+// IsOnline 檢查使用者是否在任一存活實例上有連線
+func (p *RedisPresence) IsOnline(userID uint) bool {
+	p.pruneStale(userID)
+	return p.countSessions(userID) > 0
+}
+
+// OnlineUsers 取得叢集中所有在線使用者
+func (p *RedisPresence) OnlineUsers() []uint {
+	reply, err := p.conn.Do("SMEMBERS", presenceOnlineKey)
+	if err != nil {
+		log.Printf("❌ 取得在線使用者失敗: %v", err)
+		return []uint{}
+	}
+
+	users := make([]uint, 0)
+	for _, value := range replyStrings(reply) {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			continue
+		}
+		// 已無連線的使用者由 PruneStale 移除並廣播下線
+		if p.IsOnline(uint(id)) {
+			users = append(users, uint(id))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	return users
+}
+
+// PruneStale 移除已失效實例的連線，回傳因此離線的使用者
+func (p *RedisPresence) PruneStale() ([]uint, error) {
+	reply, err := p.conn.Do("SMEMBERS", presenceOnlineKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var offline []uint
+	for _, value := range replyStrings(reply) {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			continue
+		}
+		userID := uint(id)
+
+		p.pruneStale(userID)
+		if p.countSessions(userID) > 0 {
+			continue
+		}
+		last, err := p.markOffline(userID)
+		if err != nil {
+			return offline, err
+		}
+		if last {
+			offline = append(offline, userID)
+		}
+	}
+	return offline, nil
+}
+
+// markOffline 將已無連線的使用者移出在線集合，只有實際移除的實例會得到 true
+// 移除後若使用者剛好在其他實例重新連線，則放回在線集合
+func (p *RedisPresence) markOffline(userID uint) (bool, error) {
+	value := strconv.FormatUint(uint64(userID), 10)
+	removed, err := p.conn.Do("SREM", presenceOnlineKey, value)
+	if err != nil {
+		return false, err
+	}
+	if replyInt(removed) == 0 {
+		return false, nil
+	}
+	if p.countSessions(userID) > 0 {
+		_, err := p.conn.Do("SADD", presenceOnlineKey, value)
+		return false, err
+	}
+	return true, nil
+}
+
+// Close 停止維持存活鍵並移除，使本實例的連線立即視為離線
+func (p *RedisPresence) Close() error {
+	p.once.Do(func() {
+		close(p.closed)
+		p.conn.Do("DEL", presenceAliveKeyPrefix+p.instanceID)
+		p.conn.Close()
+	})
+	return nil
+}
+
+// member 連線在使用者集合中的成員值（實例 ID|連線 ID）
+func (p *RedisPresence) member(sessionID string) string {
+	return p.instanceID + "|" + sessionID
+}
+
+// countSessions 取得使用者的連線數
+func (p *RedisPresence) countSessions(userID uint) int64 {
+	reply, err := p.conn.Do("SCARD", presenceUserKey(userID))
+	if err != nil {
+		log.Printf("❌ 查詢使用者 %d 在線狀態失敗: %v", userID, err)
+		return 0
+	}
+	return replyInt(reply)
+}
+
+// pruneStale 移除屬於已失效實例的連線
+func (p *RedisPresence) pruneStale(userID uint) {
+	key := presenceUserKey(userID)
+	reply, err := p.conn.Do("SMEMBERS", key)
+	if err != nil {
+		return
+	}
+
+	alive := make(map[string]bool)
+	for _, member := range replyStrings(reply) {
+		instanceID, _, found := strings.Cut(member, "|")
+		if !found {
+			continue
+		}
+		isAlive, checked := alive[instanceID]
+		if !checked {
+			exists, err := p.conn.Do("EXISTS", presenceAliveKeyPrefix+instanceID)
+			isAlive = err != nil || replyInt(exists) > 0
+			alive[instanceID] = isAlive
+		}
+		if !isAlive {
+			p.conn.Do("SREM", key, member)
+		}
+	}
+}
+
+// refresh 更新本實例的存活鍵
+func (p *RedisPresence) refresh() error {
+	_, err := p.conn.Do("SET", presenceAliveKeyPrefix+p.instanceID, "1",
+		"PX", strconv.FormatInt(p.ttl.Milliseconds(), 10))
+	return err
+}
+
+// keepAlive 定期更新存活鍵
+func (p *RedisPresence) keepAlive() {
+	ticker := time.NewTicker(p.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.closed:
+			return
+		case <-ticker.C:
+			if err := p.refresh(); err != nil {
+				log.Printf("❌ 更新實例存活狀態失敗: %v", err)
+			}
+		}
+	}
+}
+
+// presenceUserKey 使用者連線集合的鍵
+func presenceUserKey(userID uint) string {
+	return fmt.Sprintf("%s%d", presenceUserKeyPrefix, userID)
+}
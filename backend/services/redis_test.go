@@ -0,0 +1,507 @@
+package services
+
+import (
+	"bufio"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis 測試用的 Redis 替身，實作 RedisBroker 與 RedisPresence 使用到的指令
+type fakeRedis struct {
+	t        *testing.T
+	listener net.Listener
+
+	mu          sync.Mutex
+	strings     map[string]string
+	sets        map[string]map[string]bool
+	subscribers map[string][]*fakeRedisConn
+	conns       map[*fakeRedisConn]bool
+}
+
+// fakeRedisConn 替身上的一個客戶端連線
+type fakeRedisConn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	queued  [][]string // MULTI 之後排入的指令，nil 表示不在交易中
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("無法啟動 Redis 替身: %v", err)
+	}
+	s := &fakeRedis{
+		t:           t,
+		listener:    listener,
+		strings:     make(map[string]string),
+		sets:        make(map[string]map[string]bool),
+		subscribers: make(map[string][]*fakeRedisConn),
+		conns:       make(map[*fakeRedisConn]bool),
+	}
+	go s.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		s.dropConnections()
+	})
+	return s
+}
+
+func (s *fakeRedis) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &fakeRedisConn{conn: conn}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+		go s.handle(c)
+	}
+}
+
+// dropConnections 中斷所有客戶端連線（模擬 Redis 重新啟動或網路中斷）
+func (s *fakeRedis) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.conn.Close()
+	}
+	s.conns = make(map[*fakeRedisConn]bool)
+	s.subscribers = make(map[string][]*fakeRedisConn)
+}
+
+// subscriberCount 取得頻道目前的訂閱連線數
+func (s *fakeRedis) subscriberCount(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscribers[channel])
+}
+
+// waitSubscribers 等待頻道的訂閱連線數達到 n
+func (s *fakeRedis) waitSubscribers(channel string, n int) {
+	s.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.subscriberCount(channel) < n {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("等待 %s 的訂閱逾時（目前 %d 個）", channel, s.subscriberCount(channel))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// deleteKey 直接刪除鍵（模擬實例當機後存活鍵過期）
+func (s *fakeRedis) deleteKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.strings, key)
+	delete(s.sets, key)
+}
+
+func (s *fakeRedis) handle(c *fakeRedisConn) {
+	defer func() {
+		c.conn.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		for channel, subs := range s.subscribers {
+			for i, sub := range subs {
+				if sub == c {
+					s.subscribers[channel] = append(subs[:i:i], subs[i+1:]...)
+					break
+				}
+			}
+		}
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(c.conn)
+	for {
+		reply, err := readRESP(r)
+		if err != nil {
+			return
+		}
+		args := replyStrings(reply)
+		if len(args) == 0 {
+			return
+		}
+		c.write(s.dispatch(c, args))
+	}
+}
+
+func (c *fakeRedisConn) write(data []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.Write(data)
+}
+
+// dispatch 執行一個指令並回傳已編碼的回覆
+func (s *fakeRedis) dispatch(c *fakeRedisConn, args []string) []byte {
+	command := strings.ToUpper(args[0])
+	switch {
+	case command == "MULTI":
+		c.queued = [][]string{}
+		return respSimple("OK")
+	case command == "EXEC":
+		queued := c.queued
+		c.queued = nil
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		out := respArrayHeader(len(queued))
+		for _, queuedArgs := range queued {
+			out = append(out, s.execute(c, queuedArgs)...)
+		}
+		return out
+	case c.queued != nil:
+		c.queued = append(c.queued, args)
+		return respSimple("QUEUED")
+	case command == "SUBSCRIBE":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var out []byte
+		for i, channel := range args[1:] {
+			s.subscribers[channel] = append(s.subscribers[channel], c)
+			out = append(out, respArrayHeader(3)...)
+			out = append(out, respBulk("subscribe")...)
+			out = append(out, respBulk(channel)...)
+			out = append(out, respInt(int64(i+1))...)
+		}
+		return out
+	case command == "PUBLISH":
+		s.mu.Lock()
+		subs := append([]*fakeRedisConn{}, s.subscribers[args[1]]...)
+		s.mu.Unlock()
+		message := respArrayHeader(3)
+		message = append(message, respBulk("message")...)
+		message = append(message, respBulk(args[1])...)
+		message = append(message, respBulk(args[2])...)
+		for _, sub := range subs {
+			sub.write(message)
+		}
+		return respInt(int64(len(subs)))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.execute(c, args)
+}
+
+// execute 執行資料指令（呼叫者需持有鎖）
+func (s *fakeRedis) execute(c *fakeRedisConn, args []string) []byte {
+	switch strings.ToUpper(args[0]) {
+	case "AUTH", "PING":
+		return respSimple("OK")
+	case "SET":
+		s.strings[args[1]] = args[2]
+		return respSimple("OK")
+	case "DEL":
+		var removed int64
+		for _, key := range args[1:] {
+			if _, ok := s.strings[key]; ok {
+				removed++
+			}
+			if _, ok := s.sets[key]; ok {
+				removed++
+			}
+			delete(s.strings, key)
+			delete(s.sets, key)
+		}
+		return respInt(removed)
+	case "EXISTS":
+		var count int64
+		for _, key := range args[1:] {
+			if _, ok := s.strings[key]; ok {
+				count++
+			} else if len(s.sets[key]) > 0 {
+				count++
+			}
+		}
+		return respInt(count)
+	case "SADD":
+		set, ok := s.sets[args[1]]
+		if !ok {
+			set = make(map[string]bool)
+			s.sets[args[1]] = set
+		}
+		var added int64
+		for _, member := range args[2:] {
+			if !set[member] {
+				set[member] = true
+				added++
+			}
+		}
+		return respInt(added)
+	case "SREM":
+		set := s.sets[args[1]]
+		var removed int64
+		for _, member := range args[2:] {
+			if set[member] {
+				delete(set, member)
+				removed++
+			}
+		}
+		if len(set) == 0 {
+			delete(s.sets, args[1])
+		}
+		return respInt(removed)
+	case "SCARD":
+		return respInt(int64(len(s.sets[args[1]])))
+	case "SMEMBERS":
+		members := make([]string, 0, len(s.sets[args[1]]))
+		for member := range s.sets[args[1]] {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		out := respArrayHeader(len(members))
+		for _, member := range members {
+			out = append(out, respBulk(member)...)
+		}
+		return out
+	}
+	return []byte("-ERR unknown command '" + args[0] + "'\r\n")
+}
+
+func respSimple(value string) []byte {
+	return []byte("+" + value + "\r\n")
+}
+
+func respInt(value int64) []byte {
+	return []byte(":" + strconv.FormatInt(value, 10) + "\r\n")
+}
+
+func respBulk(value string) []byte {
+	return []byte("$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n")
+}
+
+func respArrayHeader(count int) []byte {
+	return []byte("*" + strconv.Itoa(count) + "\r\n")
+}
+
+// receiver 收集訂閱到的訊息
+type receiver struct {
+	messages chan string
+}
+
+func newReceiver() *receiver {
+	return &receiver{messages: make(chan string, 16)}
+}
+
+func (r *receiver) handle(payload []byte) {
+	r.messages <- string(payload)
+}
+
+func (r *receiver) expect(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case got := <-r.messages:
+		if got != want {
+			t.Fatalf("收到 %q，預期 %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("等待訊息 %q 逾時", want)
+	}
+}
+
+func (r *receiver) expectNone(t *testing.T) {
+	t.Helper()
+	select {
+	case got := <-r.messages:
+		t.Fatalf("不應收到訊息，卻收到 %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func newTestRedisBroker(t *testing.T, server *fakeRedis) *RedisBroker {
+	t.Helper()
+	broker, err := NewRedisBroker(server.addr(), "secret")
+	if err != nil {
+		t.Fatalf("建立 RedisBroker 失敗: %v", err)
+	}
+	t.Cleanup(func() { broker.Close() })
+	return broker
+}
+
+func newTestRedisPresence(t *testing.T, server *fakeRedis, instanceID string) *RedisPresence {
+	t.Helper()
+	presence, err := NewRedisPresence(server.addr(), "secret", instanceID)
+	if err != nil {
+		t.Fatalf("建立 RedisPresence 失敗: %v", err)
+	}
+	t.Cleanup(func() { presence.Close() })
+	return presence
+}
+
+func TestRedisBrokerPublishSubscribe(t *testing.T) {
+	server := newFakeRedis(t)
+	a := newTestRedisBroker(t, server)
+	b := newTestRedisBroker(t, server)
+
+	onA, onB, other := newReceiver(), newReceiver(), newReceiver()
+	if err := a.Subscribe("chat", onA.handle); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Subscribe("chat", onB.handle); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Subscribe("other", other.handle); err != nil {
+		t.Fatal(err)
+	}
+	server.waitSubscribers("chat", 2)
+	server.waitSubscribers("other", 1)
+
+	if err := a.Publish("chat", []byte(`{"hello":"世界"}`)); err != nil {
+		t.Fatal(err)
+	}
+	onA.expect(t, `{"hello":"世界"}`)
+	onB.expect(t, `{"hello":"世界"}`)
+	other.expectNone(t)
+}
+
+func TestRedisBrokerReconnect(t *testing.T) {
+	server := newFakeRedis(t)
+	publisher := newTestRedisBroker(t, server)
+	subscriber := newTestRedisBroker(t, server)
+
+	received := newReceiver()
+	if err := subscriber.Subscribe("chat", received.handle); err != nil {
+		t.Fatal(err)
+	}
+	server.waitSubscribers("chat", 1)
+
+	// 中斷所有連線後，訂閱迴圈應重新連線並重新訂閱，發布端應在下次發布時重連
+	server.dropConnections()
+	server.waitSubscribers("chat", 1)
+
+	if err := publisher.Publish("chat", []byte("after reconnect")); err != nil {
+		t.Fatalf("重連後發布失敗: %v", err)
+	}
+	received.expect(t, "after reconnect")
+}
+
+func TestRedisBrokerCloseStopsDelivery(t *testing.T) {
+	server := newFakeRedis(t)
+	publisher := newTestRedisBroker(t, server)
+	subscriber := newTestRedisBroker(t, server)
+
+	received := newReceiver()
+	if err := subscriber.Subscribe("chat", received.handle); err != nil {
+		t.Fatal(err)
+	}
+	server.waitSubscribers("chat", 1)
+
+	subscriber.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for server.subscriberCount("chat") > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("關閉後訂閱連線仍存在")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	publisher.Publish("chat", []byte("ignored"))
+	received.expectNone(t)
+}
+
+func TestRedisPresenceMultiSession(t *testing.T) {
+	server := newFakeRedis(t)
+	a := newTestRedisPresence(t, server, "instance-a")
+	b := newTestRedisPresence(t, server, "instance-b")
+
+	first, err := a.AddSession(1, "s1")
+	if err != nil || !first {
+		t.Fatalf("第一個連線應回傳 first=true，得到 %v, %v", first, err)
+	}
+	first, err = b.AddSession(1, "s2")
+	if err != nil || first {
+		t.Fatalf("其他實例上的第二個連線應回傳 first=false，得到 %v, %v", first, err)
+	}
+	if !a.IsOnline(1) || !b.IsOnline(1) {
+		t.Fatal("使用者應在所有實例上顯示在線")
+	}
+
+	last, err := a.RemoveSession(1, "s1")
+	if err != nil || last {
+		t.Fatalf("仍有其他連線時應回傳 last=false，得到 %v, %v", last, err)
+	}
+	if last, _ := a.RemoveSession(1, "s1"); last {
+		t.Fatal("重複移除同一連線不應回傳 last=true")
+	}
+	if got := a.OnlineUsers(); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("OnlineUsers = %v，預期 [1]", got)
+	}
+
+	last, err = b.RemoveSession(1, "s2")
+	if err != nil || !last {
+		t.Fatalf("最後一個連線應回傳 last=true，得到 %v, %v", last, err)
+	}
+	if a.IsOnline(1) {
+		t.Fatal("所有連線移除後應顯示離線")
+	}
+	if got := b.OnlineUsers(); len(got) != 0 {
+		t.Fatalf("OnlineUsers = %v，預期為空", got)
+	}
+}
+
+func TestRedisPresencePruneStaleReportsOfflineOnce(t *testing.T) {
+	server := newFakeRedis(t)
+	crashed := newTestRedisPresence(t, server, "instance-crashed")
+	a := newTestRedisPresence(t, server, "instance-a")
+	b := newTestRedisPresence(t, server, "instance-b")
+
+	crashed.AddSession(1, "s1") // 只在當機的實例上連線
+	crashed.AddSession(2, "s2")
+	a.AddSession(2, "s3") // 在存活的實例上也有連線
+
+	if offline, err := a.PruneStale(); err != nil || len(offline) != 0 {
+		t.Fatalf("實例存活時不應有離線使用者，得到 %v, %v", offline, err)
+	}
+
+	// 當機的實例不再更新存活鍵，存活鍵過期
+	server.deleteKey(presenceAliveKeyPrefix + "instance-crashed")
+
+	offline, err := a.PruneStale()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offline) != 1 || offline[0] != 1 {
+		t.Fatalf("PruneStale = %v，預期 [1]", offline)
+	}
+	if again, _ := b.PruneStale(); len(again) != 0 {
+		t.Fatalf("其他實例不應重複回報離線，得到 %v", again)
+	}
+	if a.IsOnline(1) {
+		t.Fatal("只在當機實例上連線的使用者應顯示離線")
+	}
+	if !a.IsOnline(2) {
+		t.Fatal("在存活實例上仍有連線的使用者應顯示在線")
+	}
+}
+
+func TestRedisPresenceCloseRemovesInstance(t *testing.T) {
+	server := newFakeRedis(t)
+	closing := newTestRedisPresence(t, server, "instance-closing")
+	a := newTestRedisPresence(t, server, "instance-a")
+
+	closing.AddSession(1, "s1")
+	if !a.IsOnline(1) {
+		t.Fatal("使用者應顯示在線")
+	}
+
+	closing.Close()
+	offline, err := a.PruneStale()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offline) != 1 || offline[0] != 1 {
+		t.Fatalf("關閉的實例上的使用者應被回報離線，得到 %v", offline)
+	}
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Room invite service - 聊天室邀請連結與加入申請
+
+// 邀請連結錯誤
+var (
+	ErrInviteNotFound       = errors.New("邀請連結不存在")
+	ErrInviteUnusable       = errors.New("邀請連結已失效")
+	ErrInvalidInviteOptions = errors.New("邀請連結的有效時間與使用次數不能為負數")
+	ErrAlreadyInRoom        = errors.New("你已是聊天室成員")
+	ErrJoinRequestNotFound  = errors.New("加入申請不存在")
+)
+
+// CreateRoomInviteParams 建立邀請連結參數
+type CreateRoomInviteParams struct {
+	ExpiresIn       time.Duration // 0 表示永不過期
+	MaxUses         int           // 0 表示不限次數
+	RequireApproval bool
+}
+
+// newInviteCode 產生邀請碼
+func newInviteCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// CreateRoomInvite 建立邀請連結（擁有者與管理員）
+func CreateRoomInvite(roomID, operatorID uint, params CreateRoomInviteParams) (*models.RoomInvite, error) {
+	if params.ExpiresIn < 0 || params.MaxUses < 0 {
+		return nil, ErrInvalidInviteOptions
+	}
+	if _, err := AuthorizeRoomAction(roomID, operatorID, RoomActionManageInvites); err != nil {
+		return nil, err
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, err
+	}
+
+	invite := models.RoomInvite{
+		RoomID:          roomID,
+		Code:            code,
+		CreatedBy:       operatorID,
+		MaxUses:         params.MaxUses,
+		RequireApproval: params.RequireApproval,
+	}
+	if params.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(params.ExpiresIn)
+		invite.ExpiresAt = &expiresAt
+	}
+	if err := config.DB.Create(&invite).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// ListRoomInvites 取得聊天室所有邀請連結與透過各連結加入的記錄（擁有者與管理員）
+func ListRoomInvites(roomID, operatorID uint) ([]models.RoomInvite, error) {
+	if _, err := AuthorizeRoomAction(roomID, operatorID, RoomActionManageInvites); err != nil {
+		return nil, err
+	}
+
+	var invites []models.RoomInvite
+	err := config.DB.Where("room_id = ?", roomID).
+		Preload("Joins", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		Preload("Joins.User").
+		Order("created_at DESC").
+		Find(&invites).Error
+	return invites, err
+}
+
+// RevokeRoomInvite 撤銷邀請連結（擁有者與管理員）
+func RevokeRoomInvite(roomID, operatorID, inviteID uint) error {
+	if _, err := AuthorizeRoomAction(roomID, operatorID, RoomActionManageInvites); err != nil {
+		return err
+	}
+
+	result := config.DB.Model(&models.RoomInvite{}).
+		Where("id = ? AND room_id = ? AND revoked_at IS NULL", inviteID, roomID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// findInvite 依邀請碼取得邀請連結
+func findInvite(code string) (*models.RoomInvite, error) {
+	var invite models.RoomInvite
+	if err := config.DB.Preload("Room").Where("code = ?", code).First(&invite).Error; err != nil {
+		return nil, ErrInviteNotFound
+	}
+	// 聊天室已解散
+	if invite.Room.ID == 0 {
+		return nil, ErrInviteNotFound
+	}
+	return &invite, nil
+}
+
+// hasPendingJoin 檢查使用者是否已有待審核的加入申請
+func hasPendingJoin(roomID, userID uint) (*models.RoomInviteJoin, bool) {
+	var join models.RoomInviteJoin
+	if err := config.DB.Preload("User").
+		Where("room_id = ? AND user_id = ? AND status = ?", roomID, userID, models.InviteJoinPending).
+		First(&join).Error; err != nil {
+		return nil, false
+	}
+	return &join, true
+}
+
+// PreviewRoomInvite 以邀請碼預覽聊天室
+func PreviewRoomInvite(code string, userID uint) (*models.RoomInvitePreview, error) {
+	invite, err := findInvite(code)
+	if err != nil {
+		return nil, err
+	}
+	if !invite.IsUsable(time.Now()) {
+		return nil, ErrInviteUnusable
+	}
+
+	var memberCount int64
+	config.DB.Model(&models.RoomMember{}).Where("room_id = ?", invite.RoomID).Count(&memberCount)
+	_, pending := hasPendingJoin(invite.RoomID, userID)
+
+	return &models.RoomInvitePreview{
+		RoomID:          invite.RoomID,
+		RoomName:        invite.Room.Name,
+		MemberCount:     memberCount,
+		RequireApproval: invite.RequireApproval,
+		ExpiresAt:       invite.ExpiresAt,
+		IsMember:        IsRoomMember(invite.RoomID, userID),
+		Pending:         pending,
+	}, nil
+}
+
+// claimInviteUse 在交易中佔用邀請連結一次使用次數，連結已失效時回傳 ErrInviteUnusable
+func claimInviteUse(tx *gorm.DB, inviteID uint) error {
+	result := tx.Model(&models.RoomInvite{}).
+		Where("id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?) AND (max_uses = 0 OR use_count < max_uses)",
+			inviteID, time.Now()).
+		Update("use_count", gorm.Expr("use_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInviteUnusable
+	}
+	return nil
+}
+
+// addInviteMember 在交易中將使用者加入聊天室
+func addInviteMember(tx *gorm.DB, roomID, userID uint) error {
+	return tx.Create(&models.RoomMember{
+		RoomID:   roomID,
+		UserID:   userID,
+		Role:     models.RoomRoleMember,
+		JoinedAt: time.Now(),
+	}).Error
+}
+
+// JoinRoomByInvite 使用邀請碼加入聊天室
+// 需要審核的連結會建立待審核申請（Status 為 pending），否則直接加入（Status 為 approved）
+func JoinRoomByInvite(code string, userID uint) (*models.RoomInviteJoin, error) {
+	invite, err := findInvite(code)
+	if err != nil {
+		return nil, err
+	}
+	if !invite.IsUsable(time.Now()) {
+		return nil, ErrInviteUnusable
+	}
+	if IsRoomMember(invite.RoomID, userID) {
+		return nil, ErrAlreadyInRoom
+	}
+	if join, pending := hasPendingJoin(invite.RoomID, userID); pending {
+		return join, nil
+	}
+
+	join := models.RoomInviteJoin{
+		InviteID: invite.ID,
+		RoomID:   invite.RoomID,
+		UserID:   userID,
+		Status:   models.InviteJoinPending,
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if !invite.RequireApproval {
+			if err := claimInviteUse(tx, invite.ID); err != nil {
+				return err
+			}
+			if err := addInviteMember(tx, invite.RoomID, userID); err != nil {
+				return err
+			}
+			join.Status = models.InviteJoinApproved
+		}
+		return tx.Create(&join).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	config.DB.Preload("User").First(&join, join.ID)
+	return &join, nil
+}
+
+// ListRoomJoinRequests 取得待審核的加入申請（擁有者與管理員）
+func ListRoomJoinRequests(roomID, operatorID uint) ([]models.RoomInviteJoin, error) {
+	if _, err := AuthorizeRoomAction(roomID, operatorID, RoomActionManageInvites); err != nil {
+		return nil, err
+	}
+
+	var joins []models.RoomInviteJoin
+	err := config.DB.Preload("User").
+		Where("room_id = ? AND status = ?", roomID, models.InviteJoinPending).
+		Order("created_at ASC").
+		Find(&joins).Error
+	return joins, err
+}
+
+// ReviewRoomJoinRequest 審核加入申請（擁有者與管理員），核准時佔用邀請連結使用次數並加入聊天室
+func ReviewRoomJoinRequest(roomID, operatorID, requestID uint, approve bool) (*models.RoomInviteJoin, error) {
+	if _, err := AuthorizeRoomAction(roomID, operatorID, RoomActionManageInvites); err != nil {
+		return nil, err
+	}
+
+	var join models.RoomInviteJoin
+	if err := config.DB.Where("id = ? AND room_id = ? AND status = ?", requestID, roomID, models.InviteJoinPending).
+		First(&join).Error; err != nil {
+		return nil, ErrJoinRequestNotFound
+	}
+
+	now := time.Now()
+	status := models.InviteJoinRejected
+	if approve {
+		status = models.InviteJoinApproved
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// 條件更新避免多位管理員同時審核
+		result := tx.Model(&models.RoomInviteJoin{}).
+			Where("id = ? AND status = ?", join.ID, models.InviteJoinPending).
+			Updates(map[string]interface{}{
+				"status":      status,
+				"reviewed_by": operatorID,
+				"reviewed_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrJoinRequestNotFound
+		}
+
+		if !approve {
+			return nil
+		}
+		// 申請期間已透過其他方式加入
+		if IsRoomMember(roomID, join.UserID) {
+			return nil
+		}
+		if err := claimInviteUse(tx, join.InviteID); err != nil {
+			return err
+		}
+		return addInviteMember(tx, roomID, join.UserID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	config.DB.Preload("User").First(&join, join.ID)
+	return &join, nil
+}
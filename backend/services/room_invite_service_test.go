@@ -0,0 +1,183 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestRoomInviteIsUsable(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	tests := []struct {
+		name   string
+		invite models.RoomInvite
+		want   bool
+	}{
+		{"不限次數且永不過期", models.RoomInvite{}, true},
+		{"尚未過期", models.RoomInvite{ExpiresAt: &future}, true},
+		{"已過期", models.RoomInvite{ExpiresAt: &past}, false},
+		{"剛好到期", models.RoomInvite{ExpiresAt: &now}, false},
+		{"尚有使用次數", models.RoomInvite{MaxUses: 2, UseCount: 1}, true},
+		{"使用次數已滿", models.RoomInvite{MaxUses: 2, UseCount: 2}, false},
+		{"已撤銷", models.RoomInvite{RevokedAt: &past}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.invite.IsUsable(now); got != tt.want {
+			t.Errorf("%s: IsUsable = %v，預期 %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// claimTestInvite 在交易中佔用一次邀請連結使用次數
+func claimTestInvite(inviteID uint) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		return claimInviteUse(tx, inviteID)
+	})
+}
+
+func TestClaimInviteUse(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 1)
+	room := createTestRoom(t, users[0])
+
+	limited, err := CreateRoomInvite(room.ID, users[0], CreateRoomInviteParams{MaxUses: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := claimTestInvite(limited.ID); err != nil {
+			t.Fatalf("第 %d 次使用失敗: %v", i+1, err)
+		}
+	}
+	if err := claimTestInvite(limited.ID); !errors.Is(err, ErrInviteUnusable) {
+		t.Fatalf("超過使用次數應回傳 ErrInviteUnusable，得到 %v", err)
+	}
+	var invite models.RoomInvite
+	config.DB.First(&invite, limited.ID)
+	if invite.UseCount != 2 {
+		t.Fatalf("使用次數為 %d，預期 2", invite.UseCount)
+	}
+
+	expiring, err := CreateRoomInvite(room.ID, users[0], CreateRoomInviteParams{ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := claimTestInvite(expiring.ID); err != nil {
+		t.Fatalf("未過期的連結應可使用: %v", err)
+	}
+	config.DB.Model(expiring).Update("expires_at", time.Now().Add(-time.Second))
+	if err := claimTestInvite(expiring.ID); !errors.Is(err, ErrInviteUnusable) {
+		t.Fatalf("過期的連結應回傳 ErrInviteUnusable，得到 %v", err)
+	}
+
+	unlimited, err := CreateRoomInvite(room.ID, users[0], CreateRoomInviteParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := claimTestInvite(unlimited.ID); err != nil {
+			t.Fatalf("不限次數的連結第 %d 次使用失敗: %v", i+1, err)
+		}
+	}
+	if err := RevokeRoomInvite(room.ID, users[0], unlimited.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := claimTestInvite(unlimited.ID); !errors.Is(err, ErrInviteUnusable) {
+		t.Fatalf("已撤銷的連結應回傳 ErrInviteUnusable，得到 %v", err)
+	}
+}
+
+func TestJoinRoomByInvite(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 4)
+	makeTestFriends(t, users[0], users[1])
+	owner, member := users[0], users[1]
+	room := createTestRoom(t, owner, member)
+
+	if _, err := CreateRoomInvite(room.ID, member, CreateRoomInviteParams{}); !errors.Is(err, ErrRoomPermissionDenied) {
+		t.Fatalf("一般成員建立邀請連結應回傳 ErrRoomPermissionDenied，得到 %v", err)
+	}
+	if _, err := CreateRoomInvite(room.ID, owner, CreateRoomInviteParams{MaxUses: -1}); !errors.Is(err, ErrInvalidInviteOptions) {
+		t.Fatalf("負的使用次數應回傳 ErrInvalidInviteOptions，得到 %v", err)
+	}
+
+	invite, err := CreateRoomInvite(room.ID, owner, CreateRoomInviteParams{MaxUses: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := JoinRoomByInvite(invite.Code, member); !errors.Is(err, ErrAlreadyInRoom) {
+		t.Fatalf("成員使用邀請連結應回傳 ErrAlreadyInRoom，得到 %v", err)
+	}
+	join, err := JoinRoomByInvite(invite.Code, users[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if join.Status != models.InviteJoinApproved || !IsRoomMember(room.ID, users[2]) {
+		t.Fatalf("不需審核的連結應直接加入: %+v", join)
+	}
+	if _, err := JoinRoomByInvite(invite.Code, users[3]); !errors.Is(err, ErrInviteUnusable) {
+		t.Fatalf("使用次數已滿應回傳 ErrInviteUnusable，得到 %v", err)
+	}
+	if _, err := JoinRoomByInvite("not-a-code", users[3]); !errors.Is(err, ErrInviteNotFound) {
+		t.Fatalf("不存在的邀請碼應回傳 ErrInviteNotFound，得到 %v", err)
+	}
+}
+
+func TestReviewRoomJoinRequest(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 4)
+	owner := users[0]
+	room := createTestRoom(t, owner)
+
+	invite, err := CreateRoomInvite(room.ID, owner, CreateRoomInviteParams{MaxUses: 1, RequireApproval: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := make([]*models.RoomInviteJoin, 0, 3)
+	for _, userID := range users[1:] {
+		join, err := JoinRoomByInvite(invite.Code, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if join.Status != models.InviteJoinPending || IsRoomMember(room.ID, userID) {
+			t.Fatalf("需審核的連結應建立待審核申請: %+v", join)
+		}
+		requests = append(requests, join)
+	}
+	// 重複申請回傳既有的待審核申請
+	if again, err := JoinRoomByInvite(invite.Code, users[1]); err != nil || again.ID != requests[0].ID {
+		t.Fatalf("重複申請應回傳既有申請 %d，得到 %+v, %v", requests[0].ID, again, err)
+	}
+
+	// 拒絕不佔用使用次數
+	if join, err := ReviewRoomJoinRequest(room.ID, owner, requests[0].ID, false); err != nil || join.Status != models.InviteJoinRejected {
+		t.Fatalf("拒絕申請失敗: %+v, %v", join, err)
+	}
+	if IsRoomMember(room.ID, users[1]) {
+		t.Fatal("被拒絕的使用者不應加入")
+	}
+
+	// 核准時佔用使用次數，次數用完後無法再核准，申請維持待審核
+	if join, err := ReviewRoomJoinRequest(room.ID, owner, requests[1].ID, true); err != nil || join.Status != models.InviteJoinApproved {
+		t.Fatalf("核准申請失敗: %+v, %v", join, err)
+	}
+	if !IsRoomMember(room.ID, users[2]) {
+		t.Fatal("核准後應加入聊天室")
+	}
+	if _, err := ReviewRoomJoinRequest(room.ID, owner, requests[1].ID, true); !errors.Is(err, ErrJoinRequestNotFound) {
+		t.Fatalf("重複審核應回傳 ErrJoinRequestNotFound，得到 %v", err)
+	}
+	if _, err := ReviewRoomJoinRequest(room.ID, owner, requests[2].ID, true); !errors.Is(err, ErrInviteUnusable) {
+		t.Fatalf("使用次數已滿時核准應回傳 ErrInviteUnusable，得到 %v", err)
+	}
+	var join models.RoomInviteJoin
+	config.DB.First(&join, requests[2].ID)
+	if join.Status != models.InviteJoinPending || IsRoomMember(room.ID, users[3]) {
+		t.Fatalf("核准失敗時申請應維持待審核: %+v", join)
+	}
+}
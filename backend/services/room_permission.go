@@ -0,0 +1,121 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+)
+
+// Room permission - 群組聊天室角色權限
+
+// RoomAction 聊天室管理操作
+type RoomAction string
+
+// 聊天室管理操作
+const (
+	RoomActionRename          RoomAction = "rename"           // 修改聊天室名稱
+	RoomActionInvite          RoomAction = "invite"           // 邀請成員
+	RoomActionManageInvites   RoomAction = "manage_invites"   // 管理邀請連結與加入申請
+	RoomActionKick            RoomAction = "kick"             // 移除成員
+	RoomActionMute            RoomAction = "mute"             // 禁言成員
+	RoomActionDeleteMessage   RoomAction = "delete_message"   // 刪除他人訊息
+	RoomActionSetDisappearing RoomAction = "set_disappearing" // 設定訊息自動銷毀
+	RoomActionSetRole         RoomAction = "set_role"         // 設定管理員
+	RoomActionTransfer        RoomAction = "transfer"         // 轉移擁有者
+)
+
+// ErrRoomPermissionDenied 角色權限不足
+var ErrRoomPermissionDenied = errors.New("權限不足")
+
+// roomActionMinRole 各操作所需的最低角色
+var roomActionMinRole = map[RoomAction]string{
+	RoomActionRename:          models.RoomRoleAdmin,
+	RoomActionInvite:          models.RoomRoleMember,
+	RoomActionManageInvites:   models.RoomRoleAdmin,
+	RoomActionKick:            models.RoomRoleAdmin,
+	RoomActionMute:            models.RoomRoleAdmin,
+	RoomActionDeleteMessage:   models.RoomRoleAdmin,
+	RoomActionSetDisappearing: models.RoomRoleAdmin,
+	RoomActionSetRole:         models.RoomRoleOwner,
+	RoomActionTransfer:        models.RoomRoleOwner,
+}
+
+// roomRoleRank 角色等級，數字越大權限越高
+func roomRoleRank(role string) int {
+	switch role {
+	case models.RoomRoleOwner:
+		return 3
+	case models.RoomRoleAdmin:
+		return 2
+	case models.RoomRoleMember:
+		return 1
+	}
+	return 0
+}
+
+// RoomRoleCan 檢查角色是否可執行操作
+func RoomRoleCan(role string, action RoomAction) bool {
+	minRole, ok := roomActionMinRole[action]
+	return ok && roomRoleRank(role) >= roomRoleRank(minRole)
+}
+
+// RoomRoleOutranks 檢查角色是否高於目標角色（只能管理比自己低階的成員）
+func RoomRoleOutranks(role, targetRole string) bool {
+	return roomRoleRank(role) > roomRoleRank(targetRole)
+}
+
+// GetRoomMember 取得聊天室成員資料
+func GetRoomMember(roomID, userID uint) (*models.RoomMember, error) {
+	var member models.RoomMember
+	if err := config.DB.Preload("User").
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		First(&member).Error; err != nil {
+		var count int64
+		config.DB.Model(&models.ChatRoom{}).Where("id = ?", roomID).Count(&count)
+		if count == 0 {
+			return nil, ErrRoomNotFound
+		}
+		return nil, ErrNotRoomMember
+	}
+	return &member, nil
+}
+
+// RoomAdminIDs 取得聊天室擁有者與管理員的 ID
+func RoomAdminIDs(roomID uint) []uint {
+	var ids []uint
+	config.DB.Model(&models.RoomMember{}).
+		Where("room_id = ? AND role IN ?", roomID, []string{models.RoomRoleOwner, models.RoomRoleAdmin}).
+		Pluck("user_id", &ids)
+	return ids
+}
+
+// AuthorizeRoomAction 檢查操作者在聊天室中是否有權限執行操作，回傳操作者的成員資料
+func AuthorizeRoomAction(roomID, operatorID uint, action RoomAction) (*models.RoomMember, error) {
+	member, err := GetRoomMember(roomID, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	if !RoomRoleCan(member.Role, action) {
+		return nil, ErrRoomPermissionDenied
+	}
+	return member, nil
+}
+
+// authorizeOverMember 檢查操作者可對目標成員執行操作，回傳雙方的成員資料
+func authorizeOverMember(roomID, operatorID, targetID uint, action RoomAction) (*models.RoomMember, *models.RoomMember, error) {
+	operator, err := AuthorizeRoomAction(roomID, operatorID, action)
+	if err != nil {
+		return nil, nil, err
+	}
+	target, err := GetRoomMember(roomID, targetID)
+	if err != nil {
+		if errors.Is(err, ErrNotRoomMember) {
+			return nil, nil, ErrMemberNotInRoom
+		}
+		return nil, nil, err
+	}
+	if !RoomRoleOutranks(operator.Role, target.Role) {
+		return nil, nil, ErrRoomPermissionDenied
+	}
+	return operator, target, nil
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"testing"
+	"time"
+)
+
+func TestRoomRoleCan(t *testing.T) {
+	owner, admin, member := models.RoomRoleOwner, models.RoomRoleAdmin, models.RoomRoleMember
+	tests := []struct {
+		role   string
+		action RoomAction
+		want   bool
+	}{
+		{member, RoomActionInvite, true},
+		{member, RoomActionRename, false},
+		{member, RoomActionKick, false},
+		{member, RoomActionMute, false},
+		{member, RoomActionDeleteMessage, false},
+		{member, RoomActionSetRole, false},
+		{member, RoomActionTransfer, false},
+
+		{admin, RoomActionInvite, true},
+		{admin, RoomActionRename, true},
+		{admin, RoomActionKick, true},
+		{admin, RoomActionMute, true},
+		{admin, RoomActionDeleteMessage, true},
+		{admin, RoomActionSetRole, false},
+		{admin, RoomActionTransfer, false},
+
+		{owner, RoomActionInvite, true},
+		{owner, RoomActionRename, true},
+		{owner, RoomActionKick, true},
+		{owner, RoomActionMute, true},
+		{owner, RoomActionDeleteMessage, true},
+		{owner, RoomActionSetRole, true},
+		{owner, RoomActionTransfer, true},
+
+		{"", RoomActionInvite, false},
+		{"guest", RoomActionInvite, false},
+		{owner, RoomAction("unknown"), false},
+	}
+	for _, tt := range tests {
+		if got := RoomRoleCan(tt.role, tt.action); got != tt.want {
+			t.Errorf("RoomRoleCan(%q, %q) = %v，預期 %v", tt.role, tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestRoomRoleOutranks(t *testing.T) {
+	owner, admin, member := models.RoomRoleOwner, models.RoomRoleAdmin, models.RoomRoleMember
+	tests := []struct {
+		role, target string
+		want         bool
+	}{
+		{owner, admin, true},
+		{owner, member, true},
+		{owner, owner, false},
+		{admin, member, true},
+		{admin, admin, false},
+		{admin, owner, false},
+		{member, member, false},
+		{member, admin, false},
+		{member, "", true},
+		{"", member, false},
+	}
+	for _, tt := range tests {
+		if got := RoomRoleOutranks(tt.role, tt.target); got != tt.want {
+			t.Errorf("RoomRoleOutranks(%q, %q) = %v，預期 %v", tt.role, tt.target, got, tt.want)
+		}
+	}
+}
+
+func roomRole(t *testing.T, roomID, userID uint) string {
+	t.Helper()
+	member, err := GetRoomMember(roomID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return member.Role
+}
+
+func TestRoomModeration(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 4)
+	for _, userID := range users[1:] {
+		makeTestFriends(t, users[0], userID)
+	}
+	owner, admin, member, other := users[0], users[1], users[2], users[3]
+	room := createTestRoom(t, owner, admin, member, other)
+
+	if got := roomRole(t, room.ID, owner); got != models.RoomRoleOwner {
+		t.Fatalf("建立者角色為 %s，預期 owner", got)
+	}
+
+	// 只有擁有者可以設定管理員，且只能設定為 admin 或 member
+	if err := SetRoomMemberRole(room.ID, member, admin, models.RoomRoleAdmin); !errors.Is(err, ErrRoomPermissionDenied) {
+		t.Fatalf("成員設定角色應回傳 ErrRoomPermissionDenied，得到 %v", err)
+	}
+	if err := SetRoomMemberRole(room.ID, owner, admin, models.RoomRoleOwner); !errors.Is(err, ErrInvalidRoomRole) {
+		t.Fatalf("設定為 owner 應回傳 ErrInvalidRoomRole，得到 %v", err)
+	}
+	if err := SetRoomMemberRole(room.ID, owner, admin, models.RoomRoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	// 成員不能移除他人，管理員只能管理比自己低階的成員
+	if err := RemoveRoomMember(room.ID, member, other); !errors.Is(err, ErrRoomPermissionDenied) {
+		t.Fatalf("成員移除他人應回傳 ErrRoomPermissionDenied，得到 %v", err)
+	}
+	if _, err := MuteRoomMember(room.ID, admin, owner, time.Hour); !errors.Is(err, ErrRoomPermissionDenied) {
+		t.Fatalf("管理員禁言擁有者應回傳 ErrRoomPermissionDenied，得到 %v", err)
+	}
+	if err := RemoveRoomMember(room.ID, admin, other); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveRoomMember(room.ID, admin, other); !errors.Is(err, ErrMemberNotInRoom) {
+		t.Fatalf("移除非成員應回傳 ErrMemberNotInRoom，得到 %v", err)
+	}
+
+	// 禁言期間不能發言，解除後恢復
+	if _, err := MuteRoomMember(room.ID, admin, member, -time.Second); !errors.Is(err, ErrInvalidMuteTime) {
+		t.Fatalf("負的禁言時間應回傳 ErrInvalidMuteTime，得到 %v", err)
+	}
+	if until, err := MuteRoomMember(room.ID, admin, member, time.Hour); err != nil || until == nil {
+		t.Fatalf("禁言失敗: %v, %v", until, err)
+	}
+	if _, _, err := SaveMessageToDB(SendMessageParams{SenderID: member, RoomID: room.ID, Content: "hi"}); !errors.Is(err, ErrMemberMuted) {
+		t.Fatalf("禁言中發言應回傳 ErrMemberMuted，得到 %v", err)
+	}
+	if until, err := MuteRoomMember(room.ID, admin, member, 0); err != nil || until != nil {
+		t.Fatalf("解除禁言失敗: %v, %v", until, err)
+	}
+	memberMessage, _, err := SaveMessageToDB(SendMessageParams{SenderID: member, RoomID: room.ID, Content: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownerMessage, _, err := SaveMessageToDB(SendMessageParams{SenderID: owner, RoomID: room.ID, Content: "公告"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 管理員可刪除成員的訊息，但不能刪除擁有者的訊息
+	if _, err := DeleteRoomMessage(room.ID, admin, ownerMessage.ID); !errors.Is(err, ErrRoomPermissionDenied) {
+		t.Fatalf("管理員刪除擁有者訊息應回傳 ErrRoomPermissionDenied，得到 %v", err)
+	}
+	if _, err := DeleteRoomMessage(room.ID, admin, memberMessage.ID); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	config.DB.Model(&models.Message{}).Where("id = ?", memberMessage.ID).Count(&count)
+	if count != 0 {
+		t.Fatal("被刪除的訊息不應再出現")
+	}
+
+	// 擁有者需先轉移才能退出，轉移後原擁有者降為管理員
+	if err := RemoveRoomMember(room.ID, owner, owner); !errors.Is(err, ErrOwnerMustTransfer) {
+		t.Fatalf("擁有者直接退出應回傳 ErrOwnerMustTransfer，得到 %v", err)
+	}
+	if err := TransferRoomOwnership(room.ID, owner, owner); !errors.Is(err, ErrTransferToSelf) {
+		t.Fatalf("轉移給自己應回傳 ErrTransferToSelf，得到 %v", err)
+	}
+	if err := TransferRoomOwnership(room.ID, admin, member); !errors.Is(err, ErrRoomPermissionDenied) {
+		t.Fatalf("管理員轉移應回傳 ErrRoomPermissionDenied，得到 %v", err)
+	}
+	if err := TransferRoomOwnership(room.ID, owner, member); err != nil {
+		t.Fatal(err)
+	}
+	if got := roomRole(t, room.ID, owner); got != models.RoomRoleAdmin {
+		t.Fatalf("原擁有者角色為 %s，預期 admin", got)
+	}
+	if got := roomRole(t, room.ID, member); got != models.RoomRoleOwner {
+		t.Fatalf("新擁有者角色為 %s，預期 owner", got)
+	}
+	if err := RemoveRoomMember(room.ID, owner, owner); err != nil {
+		t.Fatal(err)
+	}
+}
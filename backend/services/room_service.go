@@ -0,0 +1,376 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Room service - 群組聊天室
+
+// 群組聊天室錯誤
+var (
+	ErrRoomNotFound      = errors.New("聊天室不存在")
+	ErrNotRoomMember     = errors.New("不是聊天室成員")
+	ErrInvalidRoomName   = errors.New("聊天室名稱需為 1-100 個字元")
+	ErrMemberNotFriend   = errors.New("只能邀請好友加入聊天室")
+	ErrMemberNotInRoom   = errors.New("使用者不是聊天室成員")
+	ErrOwnerMustTransfer = errors.New("擁有者需先轉移聊天室才能退出")
+	ErrInvalidRoomRole   = errors.New("角色只能設定為 admin 或 member")
+	ErrInvalidMuteTime   = errors.New("禁言時間無效")
+	ErrMemberMuted       = errors.New("你已被禁言")
+	ErrTransferToSelf    = errors.New("不能將聊天室轉移給自己")
+	ErrMessageNotInRoom  = errors.New("訊息不存在")
+)
+
+// IsRoomMember 檢查使用者是否為聊天室成員
+func IsRoomMember(roomID, userID uint) bool {
+	var count int64
+	config.DB.Model(&models.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Count(&count)
+	return count > 0
+}
+
+// RoomMemberIDs 取得聊天室所有成員的 ID
+func RoomMemberIDs(roomID uint) []uint {
+	var ids []uint
+	config.DB.Model(&models.RoomMember{}).
+		Where("room_id = ?", roomID).
+		Pluck("user_id", &ids)
+	return ids
+}
+
+// GetRoomForMember 取得聊天室（含成員資料），使用者需為成員
+func GetRoomForMember(roomID, userID uint) (*models.ChatRoom, error) {
+	var room models.ChatRoom
+	if err := config.DB.Preload("Members.User").First(&room, roomID).Error; err != nil {
+		return nil, ErrRoomNotFound
+	}
+	for _, member := range room.Members {
+		if member.UserID == userID {
+			return &room, nil
+		}
+	}
+	return nil, ErrNotRoomMember
+}
+
+// CreateRoom 建立聊天室，建立者成為擁有者，指定的好友成為一般成員
+func CreateRoom(creatorID uint, name string, memberIDs []uint) (*models.ChatRoom, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > 100 {
+		return nil, ErrInvalidRoomName
+	}
+
+	// 只能邀請好友
+	members := uniqueIDs(append([]uint{creatorID}, memberIDs...))
+	for _, memberID := range members {
+		if memberID != creatorID && !AreFriends(creatorID, memberID) {
+			return nil, ErrMemberNotFriend
+		}
+	}
+
+	room := models.ChatRoom{Name: name, CreatedBy: creatorID}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&room).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, memberID := range members {
+			role := models.RoomRoleMember
+			if memberID == creatorID {
+				role = models.RoomRoleOwner
+			}
+			if err := tx.Create(&models.RoomMember{RoomID: room.ID, UserID: memberID, Role: role, JoinedAt: now}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetRoomForMember(room.ID, creatorID)
+}
+
+// AddRoomMembers 由成員邀請好友加入聊天室，回傳實際新增的使用者 ID
+func AddRoomMembers(roomID, inviterID uint, userIDs []uint) ([]uint, error) {
+	if _, err := AuthorizeRoomAction(roomID, inviterID, RoomActionInvite); err != nil {
+		return nil, err
+	}
+
+	var added []uint
+	now := time.Now()
+	for _, userID := range uniqueIDs(userIDs) {
+		if userID == inviterID || IsRoomMember(roomID, userID) {
+			continue
+		}
+		if !AreFriends(inviterID, userID) {
+			return added, ErrMemberNotFriend
+		}
+		result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.RoomMember{RoomID: roomID, UserID: userID, Role: models.RoomRoleMember, JoinedAt: now})
+		if result.Error != nil {
+			return added, result.Error
+		}
+		if result.RowsAffected > 0 {
+			added = append(added, userID)
+		}
+	}
+	return added, nil
+}
+
+// RemoveRoomMember 移除聊天室成員：成員可自行退出，管理員可移除比自己低階的成員
+// 擁有者需先轉移聊天室才能退出；最後一位成員退出時聊天室一併刪除
+func RemoveRoomMember(roomID, operatorID, userID uint) error {
+	if operatorID != userID {
+		if _, _, err := authorizeOverMember(roomID, operatorID, userID, RoomActionKick); err != nil {
+			return err
+		}
+	} else {
+		member, err := GetRoomMember(roomID, userID)
+		if err != nil {
+			return err
+		}
+		if member.Role == models.RoomRoleOwner && len(RoomMemberIDs(roomID)) > 1 {
+			return ErrOwnerMustTransfer
+		}
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("room_id = ? AND user_id = ?", roomID, userID).Delete(&models.RoomMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMemberNotInRoom
+		}
+		// 離開後不再出現在最近聊天列表
+		if err := tx.Where("room_id = ? AND user_id = ?", roomID, userID).Delete(&models.Conversation{}).Error; err != nil {
+			return err
+		}
+
+		var remaining int64
+		if err := tx.Model(&models.RoomMember{}).Where("room_id = ?", roomID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return tx.Delete(&models.ChatRoom{}, roomID).Error
+		}
+		return nil
+	})
+}
+
+// RenameRoom 修改聊天室名稱
+func RenameRoom(roomID, operatorID uint, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > 100 {
+		return ErrInvalidRoomName
+	}
+	if _, err := AuthorizeRoomAction(roomID, operatorID, RoomActionRename); err != nil {
+		return err
+	}
+	return config.DB.Model(&models.ChatRoom{}).Where("id = ?", roomID).Update("name", name).Error
+}
+
+// SetRoomMemberRole 設定成員角色（admin 或 member），僅擁有者可操作
+func SetRoomMemberRole(roomID, operatorID, userID uint, role string) error {
+	if role != models.RoomRoleAdmin && role != models.RoomRoleMember {
+		return ErrInvalidRoomRole
+	}
+	if _, _, err := authorizeOverMember(roomID, operatorID, userID, RoomActionSetRole); err != nil {
+		return err
+	}
+	return config.DB.Model(&models.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("role", role).Error
+}
+
+// MuteRoomMember 禁言成員，duration 為 0 表示解除禁言，回傳禁言到期時間
+func MuteRoomMember(roomID, operatorID, userID uint, duration time.Duration) (*time.Time, error) {
+	if duration < 0 {
+		return nil, ErrInvalidMuteTime
+	}
+	if _, _, err := authorizeOverMember(roomID, operatorID, userID, RoomActionMute); err != nil {
+		return nil, err
+	}
+
+	var mutedUntil *time.Time
+	if duration > 0 {
+		until := time.Now().Add(duration)
+		mutedUntil = &until
+	}
+	if err := config.DB.Model(&models.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("muted_until", mutedUntil).Error; err != nil {
+		return nil, err
+	}
+	return mutedUntil, nil
+}
+
+// TransferRoomOwnership 將擁有者轉移給其他成員，原擁有者降為管理員
+func TransferRoomOwnership(roomID, operatorID, newOwnerID uint) error {
+	if operatorID == newOwnerID {
+		return ErrTransferToSelf
+	}
+	if _, err := AuthorizeRoomAction(roomID, operatorID, RoomActionTransfer); err != nil {
+		return err
+	}
+	if !IsRoomMember(roomID, newOwnerID) {
+		return ErrMemberNotInRoom
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, operatorID).
+			Update("role", models.RoomRoleAdmin).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, newOwnerID).
+			Updates(map[string]interface{}{"role": models.RoomRoleOwner, "muted_until": nil}).Error
+	})
+}
+
+// DeleteRoomMessage 刪除聊天室訊息：成員可刪除自己的訊息，管理員可刪除比自己低階成員的訊息
+// 回傳被刪除的訊息
+func DeleteRoomMessage(roomID, operatorID, messageID uint) (*models.Message, error) {
+	operator, err := GetRoomMember(roomID, operatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var message models.Message
+	if err := config.DB.Where("id = ? AND room_id = ?", messageID, roomID).First(&message).Error; err != nil {
+		return nil, ErrMessageNotInRoom
+	}
+	if message.MessageType == models.MessageTypeSystem {
+		return nil, ErrRoomPermissionDenied
+	}
+
+	if message.SenderID != operatorID {
+		if !RoomRoleCan(operator.Role, RoomActionDeleteMessage) {
+			return nil, ErrRoomPermissionDenied
+		}
+		// 已退出的成員視為一般成員
+		senderRole := models.RoomRoleMember
+		if sender, err := GetRoomMember(roomID, message.SenderID); err == nil {
+			senderRole = sender.Role
+		}
+		if !RoomRoleOutranks(operator.Role, senderRole) {
+			return nil, ErrRoomPermissionDenied
+		}
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&message).Error; err != nil {
+			return err
+		}
+		if message.ThreadRootID != nil {
+			if err := refreshThreadStats(tx, *message.ThreadRootID); err != nil {
+				return err
+			}
+		}
+		return forgetConversationMessage(tx, &message)
+	})
+	if err != nil {
+		return nil, err
+	}
+	RemoveMessageFromIndex(message.ID)
+	return &message, nil
+}
+
+// ListUserRooms 取得使用者加入的所有聊天室（依最近活動排序）
+func ListUserRooms(userID uint) ([]models.ChatRoom, error) {
+	var rooms []models.ChatRoom
+	err := config.DB.
+		Joins("JOIN room_members ON room_members.room_id = chat_rooms.id AND room_members.user_id = ?", userID).
+		Preload("Members.User").
+		Order("chat_rooms.updated_at DESC").
+		Find(&rooms).Error
+	return rooms, err
+}
+
+// PostSystemMessage 在聊天室時間軸寫入系統訊息並推送給所有成員
+func (h *Hub) PostSystemMessage(roomID, actorID uint, content string) {
+	message := models.Message{
+		SenderID:    actorID,
+		RoomID:      &roomID,
+		Content:     content,
+		MessageType: models.MessageTypeSystem,
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+		return recordConversationMessage(tx, &message)
+	})
+	if err != nil {
+		log.Printf("❌ 寫入聊天室 %d 系統訊息失敗: %v", roomID, err)
+		return
+	}
+	config.DB.Scopes(WithMessageRelations).First(&message, message.ID)
+	config.DB.Model(&models.ChatRoom{}).Where("id = ?", roomID).Update("updated_at", message.CreatedAt)
+
+	h.PushChatMessage(&message)
+}
+
+// RoomDisplayName 系統訊息中顯示的使用者名稱
+func RoomDisplayName(userID uint) string {
+	var user models.User
+	if err := config.DB.Unscoped().First(&user, userID).Error; err != nil {
+		return "未知使用者"
+	}
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	return user.Username
+}
+
+// uniqueIDs 去除重複與無效的 ID
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
+
+// sendToRoom 推送即時事件（正在輸入）給聊天室中除了發送者以外的成員，發送者必須是成員
+func (h *Hub) sendToRoom(roomID, senderID uint, message *Message) {
+	if !IsRoomMember(roomID, senderID) {
+		return
+	}
+	var others []uint
+	for _, memberID := range RoomMemberIDs(roomID) {
+		if memberID != senderID {
+			others = append(others, memberID)
+		}
+	}
+	h.sendEphemeral(others, message)
+}
+
+// NotifyRoom 推送聊天室事件（成員異動等）給指定使用者
+func (h *Hub) NotifyRoom(eventType string, operatorID, roomID uint, userIDs []uint, data interface{}) {
+	for _, userID := range userIDs {
+		h.SendToUser(userID, &Message{
+			Type:      eventType,
+			SenderID:  operatorID,
+			RoomID:    roomID,
+			Timestamp: time.Now().Format(time.RFC3339),
+			Data:      data,
+		})
+	}
+}
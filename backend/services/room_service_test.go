@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"gin-project/models"
+	"testing"
+)
+
+// createTestRoom 由 creatorID 建立聊天室
+func createTestRoom(t *testing.T, creatorID uint, memberIDs ...uint) *models.ChatRoom {
+	t.Helper()
+	room, err := CreateRoom(creatorID, "測試群組", memberIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return room
+}
+
+func TestCreateRoom(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 4)
+	makeTestFriends(t, users[0], users[1])
+	makeTestFriends(t, users[2], users[0])
+
+	if _, err := CreateRoom(users[0], "   ", []uint{users[1]}); !errors.Is(err, ErrInvalidRoomName) {
+		t.Fatalf("空白名稱應回傳 ErrInvalidRoomName，得到 %v", err)
+	}
+	if _, err := CreateRoom(users[0], "群組", []uint{users[1], users[3]}); !errors.Is(err, ErrMemberNotFriend) {
+		t.Fatalf("邀請非好友應回傳 ErrMemberNotFriend，得到 %v", err)
+	}
+
+	room := createTestRoom(t, users[0], users[1], users[2], users[1], users[0])
+	if room.Name != "測試群組" || room.CreatedBy != users[0] || len(room.Members) != 3 {
+		t.Fatalf("聊天室資料不正確: %+v", room)
+	}
+	for _, userID := range users[:3] {
+		if !IsRoomMember(room.ID, userID) {
+			t.Fatalf("使用者 %d 應為聊天室成員", userID)
+		}
+	}
+	if IsRoomMember(room.ID, users[3]) {
+		t.Fatal("未受邀的使用者不應為成員")
+	}
+	if _, err := GetRoomForMember(room.ID, users[3]); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("非成員取得聊天室應回傳 ErrNotRoomMember，得到 %v", err)
+	}
+	if _, err := GetRoomForMember(room.ID+1, users[0]); !errors.Is(err, ErrRoomNotFound) {
+		t.Fatalf("不存在的聊天室應回傳 ErrRoomNotFound，得到 %v", err)
+	}
+}
+
+func TestRoomMembership(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 4)
+	makeTestFriends(t, users[0], users[1])
+	makeTestFriends(t, users[0], users[2])
+	makeTestFriends(t, users[1], users[3])
+	room := createTestRoom(t, users[0], users[1], users[2])
+
+	// 非成員不能邀請或發言
+	if _, err := AddRoomMembers(room.ID, users[3], []uint{users[1]}); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("非成員邀請應回傳 ErrNotRoomMember，得到 %v", err)
+	}
+	if _, _, err := SaveMessageToDB(SendMessageParams{SenderID: users[3], RoomID: room.ID, Content: "hi"}); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("非成員發言應回傳 ErrNotRoomMember，得到 %v", err)
+	}
+
+	// 只能邀請自己的好友，已是成員的使用者略過
+	if _, err := AddRoomMembers(room.ID, users[2], []uint{users[3]}); !errors.Is(err, ErrMemberNotFriend) {
+		t.Fatalf("邀請非好友應回傳 ErrMemberNotFriend，得到 %v", err)
+	}
+	added, err := AddRoomMembers(room.ID, users[1], []uint{users[0], users[3], users[3]})
+	if err != nil || len(added) != 1 || added[0] != users[3] {
+		t.Fatalf("應只新增使用者 %d，得到 %v, %v", users[3], added, err)
+	}
+
+	message, _, err := SaveMessageToDB(SendMessageParams{SenderID: users[3], RoomID: room.ID, Content: "大家好"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.GetRoomID() != room.ID || message.GetReceiverID() != 0 {
+		t.Fatalf("群組訊息應只指定聊天室: %+v", message)
+	}
+
+	// 成員自行退出
+	if err := RemoveRoomMember(room.ID, users[2], users[2]); err != nil {
+		t.Fatal(err)
+	}
+	if IsRoomMember(room.ID, users[2]) {
+		t.Fatal("退出後不應為成員")
+	}
+	if rooms, err := ListUserRooms(users[2]); err != nil || len(rooms) != 0 {
+		t.Fatalf("退出後不應列出聊天室，得到 %d 個, %v", len(rooms), err)
+	}
+	if rooms, err := ListUserRooms(users[3]); err != nil || len(rooms) != 1 || rooms[0].ID != room.ID {
+		t.Fatalf("應列出加入的聊天室，得到 %+v, %v", rooms, err)
+	}
+	if err := RemoveRoomMember(room.ID, users[2], users[2]); !errors.Is(err, ErrNotRoomMember) {
+		t.Fatalf("已退出的使用者再次退出應回傳 ErrNotRoomMember，得到 %v", err)
+	}
+}
@@ -0,0 +1,366 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"log"
+	"time"
+)
+
+// Scheduled message service - 排程訊息與背景排程器
+
+// 排程訊息錯誤
+var (
+	ErrScheduledNotFound   = errors.New("排程訊息不存在")
+	ErrScheduledNotPending = errors.New("排程訊息已發送或已取消")
+	ErrInvalidScheduleTime = errors.New("排程時間需在未來一年內")
+)
+
+// MaxScheduleAhead 最多可排程到多久之後
+const MaxScheduleAhead = 365 * 24 * time.Hour
+
+// Clock 取得目前時間，排程器可注入假時鐘以便測試
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock 使用系統時間的時鐘
+type SystemClock struct{}
+
+// Now 取得系統時間
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ScheduleMessageParams 建立排程訊息參數
+type ScheduleMessageParams struct {
+	SenderID    uint
+	ReceiverID  uint
+	RoomID      uint
+	Content     string
+	MessageType string
+	FileURL     string
+	FileName    string
+	FileSize    int64
+	ReplyToID   uint
+	ScheduledAt time.Time
+}
+
+// UpdateScheduledMessageParams 修改排程訊息參數，nil 欄位表示不變更
+type UpdateScheduledMessageParams struct {
+	Content     *string
+	ScheduledAt *time.Time
+	FileURL     *string // 更換附件時需一併提供 FileName 與 FileSize
+	FileName    *string
+	FileSize    *int64
+}
+
+// checkScheduleTime 排程時間需在 now 之後、一年之內
+func checkScheduleTime(scheduledAt, now time.Time) error {
+	if !scheduledAt.After(now) || scheduledAt.Sub(now) > MaxScheduleAhead {
+		return ErrInvalidScheduleTime
+	}
+	return nil
+}
+
+// scheduledSendParams 轉換為發送訊息參數
+func scheduledSendParams(scheduled *models.ScheduledMessage) SendMessageParams {
+	params := SendMessageParams{
+		SenderID:    scheduled.SenderID,
+		Content:     scheduled.Content,
+		MessageType: scheduled.MessageType,
+		FileURL:     scheduled.FileURL,
+		FileName:    scheduled.FileName,
+		FileSize:    scheduled.FileSize,
+		ClientMsgID: scheduled.ClientMsgID(),
+		scheduled:   true,
+	}
+	if scheduled.ReceiverID != nil {
+		params.ReceiverID = *scheduled.ReceiverID
+	}
+	if scheduled.RoomID != nil {
+		params.RoomID = *scheduled.RoomID
+	}
+	if scheduled.ReplyToID != nil {
+		params.ReplyToID = *scheduled.ReplyToID
+	}
+	return params
+}
+
+// CreateScheduledMessage 建立排程訊息，建立時即驗證內容與發送對象
+func CreateScheduledMessage(params ScheduleMessageParams, now time.Time) (*models.ScheduledMessage, error) {
+	if err := checkScheduleTime(params.ScheduledAt, now); err != nil {
+		return nil, err
+	}
+
+	send := SendMessageParams{
+		SenderID:    params.SenderID,
+		ReceiverID:  params.ReceiverID,
+		RoomID:      params.RoomID,
+		Content:     params.Content,
+		MessageType: params.MessageType,
+		FileURL:     params.FileURL,
+		FileName:    params.FileName,
+		FileSize:    params.FileSize,
+		ReplyToID:   params.ReplyToID,
+	}
+	if err := validateSendParams(&send); err != nil {
+		return nil, err
+	}
+
+	scheduled := models.ScheduledMessage{
+		SenderID:    params.SenderID,
+		Content:     send.Content,
+		MessageType: send.MessageType,
+		FileURL:     send.FileURL,
+		FileName:    send.FileName,
+		FileSize:    send.FileSize,
+		ScheduledAt: params.ScheduledAt,
+		Status:      models.ScheduledPending,
+	}
+	if params.RoomID != 0 {
+		scheduled.RoomID = &params.RoomID
+	} else {
+		scheduled.ReceiverID = &params.ReceiverID
+	}
+	if params.ReplyToID != 0 {
+		scheduled.ReplyToID = &params.ReplyToID
+	}
+
+	if err := config.DB.Create(&scheduled).Error; err != nil {
+		return nil, err
+	}
+	return &scheduled, nil
+}
+
+// ListScheduledMessages 取得自己的排程訊息，status 為空時只列出等待發送的
+func ListScheduledMessages(userID uint, status string) ([]models.ScheduledMessage, error) {
+	if status == "" {
+		status = models.ScheduledPending
+	}
+	scheduled := []models.ScheduledMessage{}
+	err := config.DB.Where("sender_id = ? AND status = ?", userID, status).
+		Order("scheduled_at ASC, id ASC").
+		Find(&scheduled).Error
+	return scheduled, err
+}
+
+// getOwnScheduledMessage 取得自己的排程訊息
+func getOwnScheduledMessage(id, userID uint) (*models.ScheduledMessage, error) {
+	var scheduled models.ScheduledMessage
+	if err := config.DB.Where("id = ? AND sender_id = ?", id, userID).First(&scheduled).Error; err != nil {
+		return nil, ErrScheduledNotFound
+	}
+	return &scheduled, nil
+}
+
+// UpdateScheduledMessage 修改尚未發送的排程訊息，修改後重新驗證內容與發送對象
+func UpdateScheduledMessage(id, userID uint, params UpdateScheduledMessageParams, now time.Time) (*models.ScheduledMessage, error) {
+	scheduled, err := getOwnScheduledMessage(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if scheduled.Status != models.ScheduledPending {
+		return nil, ErrScheduledNotPending
+	}
+
+	updates := map[string]interface{}{}
+	edited := *scheduled
+	if params.ScheduledAt != nil {
+		if err := checkScheduleTime(*params.ScheduledAt, now); err != nil {
+			return nil, err
+		}
+		updates["scheduled_at"] = *params.ScheduledAt
+	}
+	if params.Content != nil {
+		edited.Content = *params.Content
+	}
+	if params.FileURL != nil {
+		if scheduled.MessageType == "text" {
+			return nil, ErrInvalidMessageType
+		}
+		edited.FileURL = *params.FileURL
+		if params.FileName != nil {
+			edited.FileName = *params.FileName
+		}
+		if params.FileSize != nil {
+			edited.FileSize = *params.FileSize
+		}
+	}
+	if params.ScheduledAt == nil && params.Content == nil && params.FileURL == nil {
+		return scheduled, nil
+	}
+
+	// 好友關係、聊天室成員、禁言狀態與回覆對象可能在建立後改變，與建立時相同完整驗證
+	send := scheduledSendParams(&edited)
+	if err := validateSendParams(&send); err != nil {
+		return nil, err
+	}
+	if params.Content != nil {
+		updates["content"] = send.Content
+	}
+	if params.FileURL != nil {
+		updates["file_url"] = send.FileURL
+		updates["file_name"] = send.FileName
+		updates["file_size"] = send.FileSize
+	}
+
+	// 條件更新，避免與排程器同時處理
+	result := config.DB.Model(&models.ScheduledMessage{}).
+		Where("id = ? AND status = ?", id, models.ScheduledPending).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrScheduledNotPending
+	}
+	return getOwnScheduledMessage(id, userID)
+}
+
+// CancelScheduledMessage 取消尚未發送的排程訊息
+func CancelScheduledMessage(id, userID uint) (*models.ScheduledMessage, error) {
+	if _, err := getOwnScheduledMessage(id, userID); err != nil {
+		return nil, err
+	}
+
+	result := config.DB.Model(&models.ScheduledMessage{}).
+		Where("id = ? AND status = ?", id, models.ScheduledPending).
+		Update("status", models.ScheduledCanceled)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrScheduledNotPending
+	}
+	return getOwnScheduledMessage(id, userID)
+}
+
+// MessageScheduler 背景排程器：定期取出到期的排程訊息，透過一般發送流程寫入並推送
+// 排程訊息保存在資料庫，重新啟動後會補發停機期間到期的訊息
+type MessageScheduler struct {
+	Hub       *Hub
+	Clock     Clock
+	BatchSize int
+
+	// StaleAfter 取得後超過此時間仍未完成的排程視為中斷，重新排入等待發送
+	StaleAfter time.Duration
+}
+
+// NewMessageScheduler 建立使用系統時間的排程器
+func NewMessageScheduler(hub *Hub) *MessageScheduler {
+	return &MessageScheduler{
+		Hub:        hub,
+		Clock:      SystemClock{},
+		BatchSize:  100,
+		StaleAfter: 2 * time.Minute,
+	}
+}
+
+// Run 每隔 interval 發送到期的排程訊息
+func (s *MessageScheduler) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if sent := s.RunDue(); sent > 0 {
+			log.Printf("✓ 已處理 %d 則排程訊息", sent)
+		}
+		<-ticker.C
+	}
+}
+
+// RunDue 處理目前時間已到期的排程訊息，回傳處理的筆數
+func (s *MessageScheduler) RunDue() int {
+	now := s.Clock.Now()
+
+	// 回收中斷的發送（以冪等鍵發送，重試不會重複建立訊息）
+	if err := config.DB.Model(&models.ScheduledMessage{}).
+		Where("status = ? AND claimed_at < ?", models.ScheduledSending, now.Add(-s.StaleAfter)).
+		Update("status", models.ScheduledPending).Error; err != nil {
+		log.Printf("❌ 回收中斷的排程訊息失敗: %v", err)
+	}
+
+	var due []models.ScheduledMessage
+	if err := config.DB.Where("status = ? AND scheduled_at <= ?", models.ScheduledPending, now).
+		Order("scheduled_at ASC, id ASC").
+		Limit(s.BatchSize).
+		Find(&due).Error; err != nil {
+		log.Printf("❌ 查詢到期排程訊息失敗: %v", err)
+		return 0
+	}
+
+	processed := 0
+	for i := range due {
+		if s.claim(&due[i], now) {
+			s.deliver(&due[i])
+			processed++
+		}
+	}
+	return processed
+}
+
+// claim 以條件更新取得排程訊息，多個實例同時執行時只有一個會成功
+func (s *MessageScheduler) claim(scheduled *models.ScheduledMessage, now time.Time) bool {
+	result := config.DB.Model(&models.ScheduledMessage{}).
+		Where("id = ? AND status = ?", scheduled.ID, models.ScheduledPending).
+		Updates(map[string]interface{}{"status": models.ScheduledSending, "claimed_at": now})
+	if result.Error != nil {
+		log.Printf("❌ 取得排程訊息 %d 失敗: %v", scheduled.ID, result.Error)
+		return false
+	}
+	return result.RowsAffected == 1
+}
+
+// deliver 透過一般發送流程寫入訊息並推送，結果通知發送者
+func (s *MessageScheduler) deliver(scheduled *models.ScheduledMessage) {
+	message, duplicate, err := SaveMessageToDB(scheduledSendParams(scheduled))
+	if err != nil {
+		scheduled.Status = models.ScheduledFailed
+		scheduled.Error = err.Error()
+		if err := config.DB.Model(scheduled).Updates(map[string]interface{}{
+			"status": models.ScheduledFailed,
+			"error":  scheduled.Error,
+		}).Error; err != nil {
+			log.Printf("❌ 更新排程訊息 %d 狀態失敗: %v", scheduled.ID, err)
+		}
+		s.notifySender("scheduled_message_failed", scheduled)
+		return
+	}
+
+	// 重試時訊息可能已寫入但尚未推送，仍推送一次（客戶端以訊息 ID 去重）
+	if duplicate {
+		s.Hub.PushChatMessage(message)
+	} else {
+		s.Hub.DispatchChatMessage(message, false)
+	}
+
+	sentAt := s.Clock.Now()
+	scheduled.Status = models.ScheduledSent
+	scheduled.MessageID = &message.ID
+	scheduled.SentAt = &sentAt
+	if err := config.DB.Model(scheduled).Updates(map[string]interface{}{
+		"status":     models.ScheduledSent,
+		"message_id": message.ID,
+		"sent_at":    sentAt,
+	}).Error; err != nil {
+		log.Printf("❌ 更新排程訊息 %d 狀態失敗: %v", scheduled.ID, err)
+	}
+	s.notifySender("scheduled_message_sent", scheduled)
+}
+
+// notifySender 通知發送者排程訊息的發送結果
+func (s *MessageScheduler) notifySender(eventType string, scheduled *models.ScheduledMessage) {
+	event := &Message{
+		Type:       eventType,
+		SenderID:   scheduled.SenderID,
+		ReceiverID: scheduled.SenderID,
+		Timestamp:  s.Clock.Now().Format(time.RFC3339),
+		Data:       scheduled,
+	}
+	if scheduled.MessageID != nil {
+		event.MessageID = *scheduled.MessageID
+	}
+	s.Hub.SendToUser(scheduled.SenderID, event)
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"testing"
+	"time"
+)
+
+// fakeClock 測試用的時鐘，時間只在呼叫 advance 時前進
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestScheduler(clock Clock) *MessageScheduler {
+	return &MessageScheduler{Hub: NewHub(), Clock: clock, BatchSize: 10, StaleAfter: 2 * time.Minute}
+}
+
+func loadScheduled(t *testing.T, id uint) models.ScheduledMessage {
+	t.Helper()
+	var scheduled models.ScheduledMessage
+	if err := config.DB.First(&scheduled, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return scheduled
+}
+
+// expectEventType 讀取連線收到的下一則推送並檢查類型
+func expectEventType(t *testing.T, client *Client, eventType string) {
+	t.Helper()
+	select {
+	case frame := <-client.Send:
+		var event Message
+		if err := json.Unmarshal(frame, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != eventType {
+			t.Fatalf("收到 %s，預期 %s", event.Type, eventType)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("沒有收到 %s", eventType)
+	}
+}
+
+func TestSaveMessageRejectsReservedClientMsgID(t *testing.T) {
+	scheduled := models.ScheduledMessage{ID: 17}
+	_, _, err := SaveMessageToDB(SendMessageParams{
+		SenderID:    1,
+		ReceiverID:  2,
+		Content:     "hello",
+		ClientMsgID: scheduled.ClientMsgID(),
+	})
+	if !errors.Is(err, ErrReservedClientMsgID) {
+		t.Fatalf("客戶端使用排程訊息的冪等鍵應被拒絕，得到 %v", err)
+	}
+}
+
+func TestMessageSchedulerRunDue(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+
+	clock := &fakeClock{now: time.Now().Truncate(time.Second)}
+	scheduler := newTestScheduler(clock)
+	sender := attachTestClient(scheduler.Hub, users[0], "phone")
+
+	scheduled, err := CreateScheduledMessage(ScheduleMessageParams{
+		SenderID:    users[0],
+		ReceiverID:  users[1],
+		Content:     "生日快樂",
+		ScheduledAt: clock.now.Add(time.Hour),
+	}, clock.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 尚未到期
+	clock.advance(59 * time.Minute)
+	if processed := scheduler.RunDue(); processed != 0 {
+		t.Fatalf("未到期時不應發送，處理了 %d 則", processed)
+	}
+	if got := loadScheduled(t, scheduled.ID); got.Status != models.ScheduledPending {
+		t.Fatalf("狀態為 %s，預期 pending", got.Status)
+	}
+
+	// 到期後發送一次
+	clock.advance(time.Minute)
+	if processed := scheduler.RunDue(); processed != 1 {
+		t.Fatalf("到期時應發送 1 則，處理了 %d 則", processed)
+	}
+	got := loadScheduled(t, scheduled.ID)
+	if got.Status != models.ScheduledSent || got.MessageID == nil || got.SentAt == nil || !got.SentAt.Equal(clock.now) {
+		t.Fatalf("發送後狀態不正確: %+v", got)
+	}
+	var message models.Message
+	if err := config.DB.First(&message, *got.MessageID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if message.Content != "生日快樂" || message.GetReceiverID() != users[1] {
+		t.Fatalf("發送的訊息不正確: %+v", message)
+	}
+	// 發送者依序收到 ack、訊息本身與排程發送結果（接收者離線，沒有 delivered）
+	expectEventType(t, sender, "ack")
+	expectEventType(t, sender, "message")
+	expectEventType(t, sender, "scheduled_message_sent")
+
+	if processed := scheduler.RunDue(); processed != 0 {
+		t.Fatalf("已發送的排程不應重複發送，處理了 %d 則", processed)
+	}
+}
+
+func TestMessageSchedulerFailsWhenNoLongerFriends(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+
+	clock := &fakeClock{now: time.Now().Truncate(time.Second)}
+	scheduler := newTestScheduler(clock)
+	sender := attachTestClient(scheduler.Hub, users[0], "phone")
+
+	scheduled, err := CreateScheduledMessage(ScheduleMessageParams{
+		SenderID:    users[0],
+		ReceiverID:  users[1],
+		Content:     "hello",
+		ScheduledAt: clock.now.Add(time.Minute),
+	}, clock.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.DB.Where("user_id = ? AND friend_id = ?", users[0], users[1]).Delete(&models.Friendship{})
+
+	clock.advance(time.Minute)
+	scheduler.RunDue()
+	got := loadScheduled(t, scheduled.ID)
+	if got.Status != models.ScheduledFailed || got.Error != ErrNotFriend.Error() {
+		t.Fatalf("已不是好友時應標記失敗: %+v", got)
+	}
+	expectEventType(t, sender, "scheduled_message_failed")
+}
+
+func TestMessageSchedulerRecoversAfterRestart(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+
+	clock := &fakeClock{now: time.Now().Truncate(time.Second)}
+	create := func(content string, after time.Duration) *models.ScheduledMessage {
+		scheduled, err := CreateScheduledMessage(ScheduleMessageParams{
+			SenderID:    users[0],
+			ReceiverID:  users[1],
+			Content:     content,
+			ScheduledAt: clock.now.Add(after),
+		}, clock.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return scheduled
+	}
+	interrupted := create("發送到一半", time.Minute)
+	missed := create("停機期間到期", 2*time.Minute)
+
+	// 第一個實例取得排程並寫入訊息後中斷，尚未更新排程狀態
+	clock.advance(time.Minute)
+	crashed := newTestScheduler(clock)
+	if !crashed.claim(interrupted, clock.now) {
+		t.Fatal("應取得排程訊息")
+	}
+	written, _, err := SaveMessageToDB(scheduledSendParams(interrupted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新啟動後，中斷未超過 StaleAfter 的排程不會被回收，停機期間到期的排程照常補發
+	clock.advance(time.Minute)
+	restarted := newTestScheduler(clock)
+	if processed := restarted.RunDue(); processed != 1 {
+		t.Fatalf("應補發 1 則停機期間到期的排程，處理了 %d 則", processed)
+	}
+	if got := loadScheduled(t, missed.ID); got.Status != models.ScheduledSent {
+		t.Fatalf("停機期間到期的排程狀態為 %s，預期 sent", got.Status)
+	}
+	if got := loadScheduled(t, interrupted.ID); got.Status != models.ScheduledSending {
+		t.Fatalf("中斷未超過 StaleAfter 時狀態為 %s，預期 sending", got.Status)
+	}
+
+	// 超過 StaleAfter 後回收並以相同冪等鍵重試，不會重複建立訊息
+	clock.advance(2 * time.Minute)
+	if processed := restarted.RunDue(); processed != 1 {
+		t.Fatalf("應回收 1 則中斷的排程，處理了 %d 則", processed)
+	}
+	got := loadScheduled(t, interrupted.ID)
+	if got.Status != models.ScheduledSent || got.MessageID == nil || *got.MessageID != written.ID {
+		t.Fatalf("回收後應標記為已發送並指向中斷前寫入的訊息 %d: %+v", written.ID, got)
+	}
+	var count int64
+	config.DB.Model(&models.Message{}).Where("sender_id = ? AND content = ?", users[0], "發送到一半").Count(&count)
+	if count != 1 {
+		t.Fatalf("重試後有 %d 則訊息，預期 1 則", count)
+	}
+}
+
+func TestUpdateScheduledMessageRevalidates(t *testing.T) {
+	openTestDB(t)
+	users := createTestUsers(t, 2)
+	makeTestFriends(t, users[0], users[1])
+
+	now := time.Now().Truncate(time.Second)
+	scheduled, err := CreateScheduledMessage(ScheduleMessageParams{
+		SenderID:    users[0],
+		ReceiverID:  users[1],
+		Content:     "原本的內容",
+		ScheduledAt: now.Add(time.Hour),
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := "修改後的內容"
+	updated, err := UpdateScheduledMessage(scheduled.ID, users[0], UpdateScheduledMessageParams{Content: &content}, now)
+	if err != nil || updated.Content != content {
+		t.Fatalf("仍是好友時應可修改，得到 %+v, %v", updated, err)
+	}
+
+	config.DB.Where("user_id = ? AND friend_id = ?", users[0], users[1]).Delete(&models.Friendship{})
+	later := now.Add(2 * time.Hour)
+	if _, err := UpdateScheduledMessage(scheduled.ID, users[0], UpdateScheduledMessageParams{ScheduledAt: &later}, now); !errors.Is(err, ErrNotFriend) {
+		t.Fatalf("已不是好友時修改應回傳 ErrNotFriend，得到 %v", err)
+	}
+	if got := loadScheduled(t, scheduled.ID); !got.ScheduledAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("驗證失敗時不應變更排程時間，得到 %v", got.ScheduledAt)
+	}
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"gin-project/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// MessageIndex 訊息全文索引，負責依關鍵字與篩選條件找出訊息 ID
+type MessageIndex interface {
+	// Index 建立或更新訊息的索引（系統訊息與已收回的訊息不會被索引）
+	Index(message *models.Message) error
+
+	// Remove 移除訊息的索引
+	Remove(messageID uint) error
+
+	// Search 依查詢條件回傳符合的訊息 ID（由新到舊，最多 Limit 筆）
+	Search(query MessageSearchQuery) ([]uint, error)
+}
+
+// MessageSearchQuery 索引查詢條件
+type MessageSearchQuery struct {
+	Terms       []string  // 關鍵字（全部都需出現）
+	ViewerID    uint      // 查詢者，只會找到其參與的私訊（支援的索引會一併排除其自行刪除的訊息）
+	RoomIDs     []uint    // 查詢者所屬的聊天室
+	PeerID      uint      // 限定與某位使用者的私訊
+	RoomID      uint      // 限定某個聊天室（需已確認查詢者為成員）
+	SenderID    uint      // 限定發送者
+	MessageType string    // 限定訊息類型
+	From        time.Time // 發送時間下限（含），零值表示不限
+	To          time.Time // 發送時間上限（不含），零值表示不限
+	BeforeID    uint      // 分頁游標，只回傳 ID 小於此值的訊息
+	Limit       int
+}
+
+// isSearchable 訊息是否應被索引
+func isSearchable(message *models.Message) bool {
+	return message.MessageType != models.MessageTypeSystem && message.RecalledAt == nil &&
+		strings.TrimSpace(message.Content) != ""
+}
+
+// indexedMessage 記憶體索引中保存的訊息資料
+type indexedMessage struct {
+	ID          uint
+	SenderID    uint
+	ReceiverID  uint
+	RoomID      uint
+	MessageType string
+	CreatedAt   time.Time
+	Content     string   // 轉為小寫的內容，用於確認關鍵字確實連續出現
+	Grams       []string // 建立索引用的 n-gram
+}
+
+// MemoryMessageIndex 單一行程內的倒排索引（單機部署與測試用）
+// 以單字與雙字 n-gram 建立索引，與 MySQL ngram 解析器的行為一致
+type MemoryMessageIndex struct {
+	mu       sync.RWMutex
+	messages map[uint]*indexedMessage
+	postings map[string]map[uint]struct{}
+}
+
+// NewMemoryMessageIndex 建立記憶體訊息索引
+func NewMemoryMessageIndex() *MemoryMessageIndex {
+	return &MemoryMessageIndex{
+		messages: make(map[uint]*indexedMessage),
+		postings: make(map[string]map[uint]struct{}),
+	}
+}
+
+// Index 建立或更新訊息索引
+func (idx *MemoryMessageIndex) Index(message *models.Message) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(message.ID)
+	if !isSearchable(message) {
+		return nil
+	}
+
+	content := strings.ToLower(message.Content)
+	doc := &indexedMessage{
+		ID:          message.ID,
+		SenderID:    message.SenderID,
+		ReceiverID:  message.GetReceiverID(),
+		RoomID:      message.GetRoomID(),
+		MessageType: message.MessageType,
+		CreatedAt:   message.CreatedAt,
+		Content:     content,
+		Grams:       ngrams(content),
+	}
+	idx.messages[doc.ID] = doc
+	for _, gram := range doc.Grams {
+		ids, ok := idx.postings[gram]
+		if !ok {
+			ids = make(map[uint]struct{})
+			idx.postings[gram] = ids
+		}
+		ids[doc.ID] = struct{}{}
+	}
+	return nil
+}
+
+// Remove 移除訊息索引
+func (idx *MemoryMessageIndex) Remove(messageID uint) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(messageID)
+	return nil
+}
+
+// remove 移除訊息索引（呼叫者需持有寫鎖）
+func (idx *MemoryMessageIndex) remove(messageID uint) {
+	doc, ok := idx.messages[messageID]
+	if !ok {
+		return
+	}
+	for _, gram := range doc.Grams {
+		if ids, ok := idx.postings[gram]; ok {
+			delete(ids, messageID)
+			if len(ids) == 0 {
+				delete(idx.postings, gram)
+			}
+		}
+	}
+	delete(idx.messages, messageID)
+}
+
+// Search 以最稀有的 n-gram 取得候選訊息，再逐一確認篩選條件與關鍵字
+func (idx *MemoryMessageIndex) Search(query MessageSearchQuery) ([]uint, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	terms := make([]string, 0, len(query.Terms))
+	var candidates map[uint]struct{}
+	for _, term := range query.Terms {
+		term = strings.ToLower(term)
+		terms = append(terms, term)
+		for _, gram := range termGrams(term) {
+			ids, ok := idx.postings[gram]
+			if !ok {
+				return []uint{}, nil
+			}
+			if candidates == nil || len(ids) < len(candidates) {
+				candidates = ids
+			}
+		}
+	}
+	if len(terms) == 0 {
+		return []uint{}, nil
+	}
+
+	rooms := make(map[uint]struct{}, len(query.RoomIDs))
+	for _, roomID := range query.RoomIDs {
+		rooms[roomID] = struct{}{}
+	}
+
+	ids := make([]uint, 0)
+	for id := range candidates {
+		doc := idx.messages[id]
+		if doc.matches(query, rooms) && doc.containsAll(terms) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	if query.Limit > 0 && len(ids) > query.Limit {
+		ids = ids[:query.Limit]
+	}
+	return ids, nil
+}
+
+// matches 檢查訊息是否符合查詢者可見範圍與篩選條件
+func (doc *indexedMessage) matches(query MessageSearchQuery, rooms map[uint]struct{}) bool {
+	if doc.RoomID != 0 {
+		if _, ok := rooms[doc.RoomID]; !ok {
+			return false
+		}
+		if query.PeerID != 0 || (query.RoomID != 0 && doc.RoomID != query.RoomID) {
+			return false
+		}
+	} else {
+		if doc.SenderID != query.ViewerID && doc.ReceiverID != query.ViewerID {
+			return false
+		}
+		if query.RoomID != 0 {
+			return false
+		}
+		if query.PeerID != 0 && doc.SenderID != query.PeerID && doc.ReceiverID != query.PeerID {
+			return false
+		}
+	}
+
+	if query.SenderID != 0 && doc.SenderID != query.SenderID {
+		return false
+	}
+	if query.MessageType != "" && doc.MessageType != query.MessageType {
+		return false
+	}
+	if !query.From.IsZero() && doc.CreatedAt.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !doc.CreatedAt.Before(query.To) {
+		return false
+	}
+	if query.BeforeID != 0 && doc.ID >= query.BeforeID {
+		return false
+	}
+	return true
+}
+
+// containsAll 檢查內容是否包含所有關鍵字
+func (doc *indexedMessage) containsAll(terms []string) bool {
+	for _, term := range terms {
+		if !strings.Contains(doc.Content, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// ngrams 將內容切成不含空白的片段，產生所有單字與雙字 n-gram（去除重複）
+func ngrams(content string) []string {
+	seen := make(map[string]struct{})
+	grams := make([]string, 0)
+	for _, field := range strings.FieldsFunc(content, unicode.IsSpace) {
+		runes := []rune(field)
+		for i := range runes {
+			for _, gram := range []string{string(runes[i]), string(runes[i:min(i+2, len(runes))])} {
+				if _, ok := seen[gram]; !ok {
+					seen[gram] = struct{}{}
+					grams = append(grams, gram)
+				}
+			}
+		}
+	}
+	return grams
+}
+
+// termGrams 取得查詢關鍵字需命中的 n-gram（單一字元的關鍵字使用單字 n-gram）
+func termGrams(term string) []string {
+	runes := []rune(term)
+	if len(runes) <= 1 {
+		return []string{term}
+	}
+	grams := make([]string, 0, len(runes)-1)
+	for i := 0; i+1 < len(runes); i++ {
+		grams = append(grams, string(runes[i:i+2]))
+	}
+	return grams
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"gin-project/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNgrams(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"英文單字", "abc", []string{"a", "ab", "b", "bc", "c"}},
+		{"中文", "你好嗎", []string{"你", "你好", "好", "好嗎", "嗎"}},
+		{"空白分隔不跨字", "ab cd", []string{"a", "ab", "b", "c", "cd", "d"}},
+		{"重複片段只保留一次", "aaa", []string{"a", "aa"}},
+		{"空白內容", "  \t ", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ngrams(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ngrams(%q) = %v，預期 %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTermGrams(t *testing.T) {
+	tests := []struct {
+		term string
+		want []string
+	}{
+		{"a", []string{"a"}},
+		{"好", []string{"好"}},
+		{"abc", []string{"ab", "bc"}},
+		{"你好嗎", []string{"你好", "好嗎"}},
+	}
+	for _, tt := range tests {
+		if got := termGrams(tt.term); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("termGrams(%q) = %v，預期 %v", tt.term, got, tt.want)
+		}
+	}
+}
+
+// 測試資料：使用者 1 與 2、1 與 3 的私訊，聊天室 10（1、2 為成員）與 20（1 不是成員）
+func newTestMessageIndex(t *testing.T) (*MemoryMessageIndex, time.Time) {
+	t.Helper()
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	user := func(id uint) *uint { return &id }
+
+	messages := []models.Message{
+		{ID: 1, SenderID: 1, ReceiverID: user(2), Content: "Hello 晚餐吃什麼", MessageType: "text", CreatedAt: base},
+		{ID: 2, SenderID: 2, ReceiverID: user(1), Content: "晚餐吃拉麵", MessageType: "text", CreatedAt: base.Add(time.Hour)},
+		{ID: 3, SenderID: 1, ReceiverID: user(3), Content: "明天晚餐見", MessageType: "text", CreatedAt: base.Add(2 * time.Hour)},
+		{ID: 4, SenderID: 2, RoomID: user(10), Content: "聚會晚餐地點", MessageType: "text", CreatedAt: base.Add(3 * time.Hour)},
+		{ID: 5, SenderID: 2, RoomID: user(20), Content: "別的聊天室晚餐", MessageType: "text", CreatedAt: base.Add(4 * time.Hour)},
+		{ID: 6, SenderID: 2, ReceiverID: user(3), Content: "與我無關的晚餐", MessageType: "text", CreatedAt: base.Add(5 * time.Hour)},
+		{ID: 7, SenderID: 1, ReceiverID: user(2), Content: "晚餐照片.jpg", MessageType: "image", CreatedAt: base.Add(6 * time.Hour)},
+		{ID: 8, SenderID: 1, RoomID: user(10), Content: "晚餐", MessageType: models.MessageTypeSystem, CreatedAt: base.Add(7 * time.Hour)},
+	}
+
+	index := NewMemoryMessageIndex()
+	for i := range messages {
+		if err := index.Index(&messages[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return index, base
+}
+
+func TestMemoryMessageIndexSearch(t *testing.T) {
+	index, base := newTestMessageIndex(t)
+	viewer := MessageSearchQuery{ViewerID: 1, RoomIDs: []uint{10}}
+	with := func(modify func(q *MessageSearchQuery)) MessageSearchQuery {
+		q := viewer
+		q.Terms = []string{"晚餐"}
+		modify(&q)
+		return q
+	}
+
+	tests := []struct {
+		name  string
+		query MessageSearchQuery
+		want  []uint
+	}{
+		{"只找到參與的對話，由新到舊，不含系統訊息", with(func(q *MessageSearchQuery) {}), []uint{7, 4, 3, 2, 1}},
+		{"多個關鍵字需全部出現", with(func(q *MessageSearchQuery) { q.Terms = []string{"晚餐", "拉麵"} }), []uint{2}},
+		{"不分大小寫", with(func(q *MessageSearchQuery) { q.Terms = []string{"HELLO"} }), []uint{1}},
+		{"單一字元關鍵字", with(func(q *MessageSearchQuery) { q.Terms = []string{"麵"} }), []uint{2}},
+		{"關鍵字需連續出現", with(func(q *MessageSearchQuery) { q.Terms = []string{"晚吃"} }), []uint{}},
+		{"沒有命中的 n-gram", with(func(q *MessageSearchQuery) { q.Terms = []string{"咖啡"} }), []uint{}},
+		{"限定私訊對象", with(func(q *MessageSearchQuery) { q.PeerID = 2 }), []uint{7, 2, 1}},
+		{"限定聊天室", with(func(q *MessageSearchQuery) { q.RoomID = 10 }), []uint{4}},
+		{"非成員的聊天室找不到", with(func(q *MessageSearchQuery) { q.RoomID = 20 }), []uint{}},
+		{"限定發送者", with(func(q *MessageSearchQuery) { q.SenderID = 2 }), []uint{4, 2}},
+		{"限定訊息類型", with(func(q *MessageSearchQuery) { q.MessageType = "image" }), []uint{7}},
+		{"時間下限（含）", with(func(q *MessageSearchQuery) { q.From = base.Add(3 * time.Hour) }), []uint{7, 4}},
+		{"時間上限（不含）", with(func(q *MessageSearchQuery) { q.To = base.Add(2 * time.Hour) }), []uint{2, 1}},
+		{"分頁游標", with(func(q *MessageSearchQuery) { q.BeforeID = 4 }), []uint{3, 2, 1}},
+		{"筆數限制", with(func(q *MessageSearchQuery) { q.Limit = 2 }), []uint{7, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := index.Search(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Search = %v，預期 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryMessageIndexUpdateAndRemove(t *testing.T) {
+	index, _ := newTestMessageIndex(t)
+	query := MessageSearchQuery{ViewerID: 1, Terms: []string{"拉麵"}}
+
+	// 編輯後以新內容索引
+	receiver := uint(1)
+	edited := models.Message{ID: 2, SenderID: 2, ReceiverID: &receiver, Content: "改吃壽司", MessageType: "text"}
+	index.Index(&edited)
+	if got, _ := index.Search(query); len(got) != 0 {
+		t.Fatalf("編輯後不應再找到舊內容，得到 %v", got)
+	}
+	query.Terms = []string{"壽司"}
+	if got, _ := index.Search(query); !reflect.DeepEqual(got, []uint{2}) {
+		t.Fatalf("編輯後應找到新內容，得到 %v", got)
+	}
+
+	// 收回的訊息不會被索引
+	now := time.Now()
+	edited.RecalledAt = &now
+	index.Index(&edited)
+	if got, _ := index.Search(query); len(got) != 0 {
+		t.Fatalf("收回後不應找到，得到 %v", got)
+	}
+
+	index.Remove(1)
+	query.Terms = []string{"hello"}
+	if got, _ := index.Search(query); len(got) != 0 {
+		t.Fatalf("移除後不應找到，得到 %v", got)
+	}
+	if len(index.postings["hello"]) != 0 || len(index.postings["he"]) != 0 {
+		t.Fatal("移除後不應殘留索引")
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	// 關鍵字前保留 20 個字，摘要共 80 個字
+	long := strings.Repeat("前", 30) + "關鍵字" + strings.Repeat("後", 80)
+	longWant := "…" + strings.Repeat("前", 20) + "<mark>關鍵字</mark>" + strings.Repeat("後", 57) + "…"
+
+	tests := []struct {
+		name    string
+		content string
+		terms   []string
+		want    string
+	}{
+		{"標示關鍵字", "今天晚餐吃拉麵", []string{"晚餐"}, "今天<mark>晚餐</mark>吃拉麵"},
+		{"不分大小寫並保留原文", "Hello World", []string{"hello"}, "<mark>Hello</mark> World"},
+		{"多個關鍵字與重複出現", "晚餐吃拉麵，拉麵好吃", []string{"拉麵", "晚餐"}, "<mark>晚餐</mark>吃<mark>拉麵</mark>，<mark>拉麵</mark>好吃"},
+		{"相鄰的關鍵字合併標示", "abcd", []string{"ab", "cd"}, "<mark>abcd</mark>"},
+		{"跳脫 HTML", "<b>晚餐</b> & 甜點", []string{"晚餐"}, "&lt;b&gt;<mark>晚餐</mark>&lt;/b&gt; &amp; 甜點"},
+		{"沒有關鍵字時從頭擷取", "沒有符合的內容", []string{"咖啡"}, "沒有符合的內容"},
+		{"長內容從關鍵字前擷取並加上省略號", long, []string{"關鍵字"}, longWant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HighlightSnippet(tt.content, tt.terms); got != tt.want {
+				t.Fatalf("HighlightSnippet = %q\n預期 %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"html"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// Search service - 跨對話的訊息全文搜尋
+
+// 搜尋錯誤
+var (
+	ErrInvalidSearchQuery  = errors.New("搜尋關鍵字不可為空，且最多 100 個字")
+	ErrInvalidSearchFilter = errors.New("無效的搜尋條件")
+)
+
+// 搜尋限制
+const (
+	MaxSearchQueryLength = 100
+	MaxSearchTerms       = 10
+	searchSnippetBefore  = 20 // 摘要中關鍵字前保留的字數
+	searchSnippetLength  = 80 // 摘要總字數
+)
+
+var (
+	messageIndexMu sync.RWMutex
+	messageIndex   MessageIndex = NewMySQLMessageIndex()
+)
+
+// SetMessageIndex 設定訊息搜尋使用的索引（預設為 MySQL 全文索引）
+func SetMessageIndex(index MessageIndex) {
+	messageIndexMu.Lock()
+	defer messageIndexMu.Unlock()
+	messageIndex = index
+}
+
+// currentMessageIndex 取得目前使用的索引
+func currentMessageIndex() MessageIndex {
+	messageIndexMu.RLock()
+	defer messageIndexMu.RUnlock()
+	return messageIndex
+}
+
+// IndexMessage 更新訊息的搜尋索引，失敗時只記錄錯誤不影響主流程
+func IndexMessage(message *models.Message) {
+	if err := currentMessageIndex().Index(message); err != nil {
+		log.Printf("❌ 更新訊息 %d 的搜尋索引失敗: %v", message.ID, err)
+	}
+}
+
+// RemoveMessageFromIndex 移除訊息的搜尋索引
+func RemoveMessageFromIndex(messageID uint) {
+	if err := currentMessageIndex().Remove(messageID); err != nil {
+		log.Printf("❌ 移除訊息 %d 的搜尋索引失敗: %v", messageID, err)
+	}
+}
+
+// RebuildMessageIndex 將資料庫中所有可搜尋的訊息寫入索引（記憶體索引啟動時使用）
+func RebuildMessageIndex(index MessageIndex) error {
+	var batch []models.Message
+	return config.DB.
+		Where("message_type <> ? AND recalled_at IS NULL", models.MessageTypeSystem).
+		FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				if err := index.Index(&batch[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// SearchMessagesParams 搜尋訊息參數
+type SearchMessagesParams struct {
+	UserID      uint
+	Query       string
+	PeerID      uint // 限定與某位使用者的私訊
+	RoomID      uint // 限定某個聊天室
+	SenderID    uint
+	MessageType string
+	From        time.Time
+	To          time.Time
+	Cursor      uint // 上一頁最後一筆的訊息 ID
+	Limit       int
+}
+
+// MessageSearchHit 搜尋結果
+type MessageSearchHit struct {
+	Message models.MessageResponse `json:"message"`
+	Snippet string                 `json:"snippet"` // 已跳脫 HTML，關鍵字以 <mark> 標示
+}
+
+// MessageSearchResult 搜尋結果頁
+type MessageSearchResult struct {
+	Results    []MessageSearchHit `json:"results"`
+	NextCursor uint               `json:"next_cursor,omitempty"`
+	HasMore    bool               `json:"has_more"`
+}
+
+// SearchMessages 在使用者參與的對話中搜尋訊息（由新到舊），排除自行刪除與已收回的訊息
+func SearchMessages(params SearchMessagesParams) (*MessageSearchResult, error) {
+	query := strings.TrimSpace(params.Query)
+	if query == "" || utf8.RuneCountInString(query) > MaxSearchQueryLength {
+		return nil, ErrInvalidSearchQuery
+	}
+	terms := strings.Fields(query)
+	if len(terms) > MaxSearchTerms {
+		return nil, ErrInvalidSearchQuery
+	}
+	if params.PeerID != 0 && params.RoomID != 0 {
+		return nil, ErrInvalidSearchFilter
+	}
+	if !params.From.IsZero() && !params.To.IsZero() && !params.From.Before(params.To) {
+		return nil, ErrInvalidSearchFilter
+	}
+	if params.MessageType != "" && !IsValidMessageType(params.MessageType) {
+		return nil, ErrInvalidMessageType
+	}
+	if params.RoomID != 0 {
+		if _, err := GetRoomForMember(params.RoomID, params.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	var roomIDs []uint
+	config.DB.Model(&models.RoomMember{}).Where("user_id = ?", params.UserID).Pluck("room_id", &roomIDs)
+
+	index := currentMessageIndex()
+	search := MessageSearchQuery{
+		Terms:       terms,
+		ViewerID:    params.UserID,
+		RoomIDs:     roomIDs,
+		PeerID:      params.PeerID,
+		RoomID:      params.RoomID,
+		SenderID:    params.SenderID,
+		MessageType: params.MessageType,
+		From:        params.From,
+		To:          params.To,
+		BeforeID:    params.Cursor,
+		Limit:       params.Limit + 1, // 多取一筆判斷是否還有下一頁
+	}
+
+	// 索引可能落後於資料庫，記憶體索引也不知道使用者自行刪除的訊息：載入時再次排除，
+	// 排除後不足一頁時繼續向索引取下一批，確保每頁筆數與 has_more 正確
+	messages := make([]models.Message, 0, search.Limit)
+	for len(messages) < search.Limit {
+		ids, err := index.Search(search)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		visible, err := loadSearchHits(ids, params.UserID)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, visible...)
+		if len(ids) < search.Limit {
+			break
+		}
+		search.BeforeID = ids[len(ids)-1]
+	}
+
+	result := &MessageSearchResult{Results: []MessageSearchHit{}}
+	if len(messages) > params.Limit {
+		messages = messages[:params.Limit]
+		result.HasMore = true
+		result.NextCursor = messages[len(messages)-1].ID
+	}
+	if len(messages) == 0 {
+		return result, nil
+	}
+
+	responses := make([]models.MessageResponse, 0, len(messages))
+	snippets := make([]string, 0, len(messages))
+	for i := range messages {
+		responses = append(responses, messages[i].ToResponse())
+		snippets = append(snippets, HighlightSnippet(messages[i].Content, terms))
+	}
+	AttachReactions(responses, params.UserID)
+	AttachPolls(responses, params.UserID)
+
+	for i, response := range responses {
+		result.Results = append(result.Results, MessageSearchHit{Message: response, Snippet: snippets[i]})
+	}
+	return result, nil
+}
+
+// loadSearchHits 依索引回傳的順序載入訊息，排除已收回與使用者自行刪除的訊息
+func loadSearchHits(ids []uint, userID uint) ([]models.Message, error) {
+	var messages []models.Message
+	if err := config.DB.
+		Where("id IN ? AND recalled_at IS NULL", ids).
+		Scopes(NotDeletedForUser(userID), WithMessageRelations).
+		Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*models.Message, len(messages))
+	for i := range messages {
+		byID[messages[i].ID] = &messages[i]
+	}
+	ordered := make([]models.Message, 0, len(messages))
+	for _, id := range ids {
+		if message, ok := byID[id]; ok {
+			ordered = append(ordered, *message)
+		}
+	}
+	return ordered, nil
+}
+
+// HighlightSnippet 擷取第一個關鍵字附近的內容作為摘要，跳脫 HTML 後以 <mark> 標示所有關鍵字（不分大小寫）
+func HighlightSnippet(content string, terms []string) string {
+	runes := []rune(content)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	// 標記每個字元是否屬於關鍵字
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		needle := []rune(term)
+		for i, r := range needle {
+			needle[i] = unicode.ToLower(r)
+		}
+		if len(needle) == 0 {
+			continue
+		}
+		for i := 0; i+len(needle) <= len(lower); i++ {
+			if string(lower[i:i+len(needle)]) != string(needle) {
+				continue
+			}
+			for j := i; j < i+len(needle); j++ {
+				marked[j] = true
+			}
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start := 0
+	if first > searchSnippetBefore {
+		start = first - searchSnippetBefore
+	}
+	end := min(start+searchSnippetLength, len(runes))
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	inMark := false
+	for i := start; i < end; i++ {
+		if marked[i] != inMark {
+			if marked[i] {
+				b.WriteString("<mark>")
+			} else {
+				b.WriteString("</mark>")
+			}
+			inMark = marked[i]
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+	}
+	if inMark {
+		b.WriteString("</mark>")
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
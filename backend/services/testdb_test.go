@@ -0,0 +1,154 @@
+package services
+
+import (
+	"fmt"
+	"gin-project/config"
+	"gin-project/models"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	gmsserver "github.com/dolthub/go-mysql-server/server"
+	gmssql "github.com/dolthub/go-mysql-server/sql"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testModels 測試資料庫使用的資料表，與 main.go 的遷移清單一致
+var testModels = []interface{}{
+	&models.User{},
+	&models.Friendship{},
+	&models.Message{},
+	&models.MessageEdit{},
+	&models.MessageDeletion{},
+	&models.MessageReaction{},
+	&models.ThreadFollow{},
+	&models.ReadWatermark{},
+	&models.Conversation{},
+	&models.ScheduledMessage{},
+	&models.DisappearingTimer{},
+	&models.Poll{},
+	&models.PollOption{},
+	&models.PollVote{},
+	&models.ChatRoom{},
+	&models.RoomMember{},
+	&models.RoomInvite{},
+	&models.RoomInviteJoin{},
+	&models.UserEvent{},
+	&models.UserEventCursor{},
+	&models.UserPresence{},
+}
+
+// openTestDB 連接測試資料庫並重建資料表
+// 設定 TEST_DB_DSN 時使用指定的 MySQL（注意：會刪除該資料庫中的所有資料表），
+// 例如 TEST_DB_DSN="root:password@tcp(127.0.0.1:3306)/easychat_test?charset=utf8mb4&parseTime=True&loc=Local"；
+// 未設定時使用程序內的 MySQL 相容資料庫（go-mysql-server），不需要另外安裝
+func openTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DB_DSN")
+	embedded := dsn == ""
+	if embedded {
+		dsn = embeddedTestDSN(t)
+	}
+
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("無法連接測試資料庫: %v", err)
+	}
+	if embedded {
+		// 程序內資料庫不支援 ngram 全文解析器，改用預設解析器建立 FULLTEXT 索引
+		db.Callback().Raw().Before("gorm:raw").Register("test:strip_ngram_parser", func(tx *gorm.DB) {
+			if sql := tx.Statement.SQL.String(); strings.Contains(sql, "WITH PARSER ngram") {
+				tx.Statement.SQL.Reset()
+				tx.Statement.SQL.WriteString(strings.ReplaceAll(sql, "WITH PARSER ngram", ""))
+			}
+		})
+	}
+	if err := db.Migrator().DropTable(testModels...); err != nil {
+		t.Fatalf("清除測試資料表失敗: %v", err)
+	}
+	if err := db.AutoMigrate(testModels...); err != nil {
+		t.Fatalf("建立測試資料表失敗: %v", err)
+	}
+
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// 程序內測試資料庫，整個測試程序共用一個，每個測試開始時重建資料表
+var (
+	embeddedDBOnce sync.Once
+	embeddedDBAddr string
+	embeddedDBErr  error
+)
+
+// embeddedTestDSN 啟動程序內的 MySQL 相容資料庫並回傳連線字串
+func embeddedTestDSN(t *testing.T) string {
+	t.Helper()
+	embeddedDBOnce.Do(func() {
+		logrus.SetLevel(logrus.ErrorLevel)
+
+		database := memory.NewDatabase("easychat_test")
+		database.BaseDatabase.EnablePrimaryKeyIndexes()
+		provider := memory.NewDBProvider(database)
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			embeddedDBErr = err
+			return
+		}
+		embeddedDBAddr = listener.Addr().String()
+		listener.Close()
+
+		server, err := gmsserver.NewServer(gmsserver.Config{Protocol: "tcp", Address: embeddedDBAddr},
+			sqle.NewDefault(provider), gmssql.NewContext, memory.NewSessionBuilder(provider), nil)
+		if err != nil {
+			embeddedDBErr = err
+			return
+		}
+		go server.Start()
+	})
+	if embeddedDBErr != nil {
+		t.Fatalf("無法啟動測試資料庫: %v", embeddedDBErr)
+	}
+	return fmt.Sprintf("root@tcp(%s)/easychat_test?charset=utf8mb4&parseTime=True&loc=Local", embeddedDBAddr)
+}
+
+// createTestUsers 建立 n 個使用者，回傳依序的 ID
+func createTestUsers(t *testing.T, n int) []uint {
+	t.Helper()
+	ids := make([]uint, 0, n)
+	for i := 1; i <= n; i++ {
+		user := models.User{
+			Username: fmt.Sprintf("user%d", i),
+			Email:    fmt.Sprintf("user%d@example.com", i),
+			Password: "hashed",
+		}
+		if err := config.DB.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	return ids
+}
+
+// makeTestFriends 建立已接受的好友關係
+func makeTestFriends(t *testing.T, userID, friendID uint) {
+	t.Helper()
+	friendship := models.Friendship{UserID: userID, FriendID: friendID, Status: models.FriendshipStatusAccepted}
+	if err := config.DB.Create(&friendship).Error; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"errors"
+	"gin-project/config"
+	"gin-project/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Thread service - 訊息討論串
+
+// 討論串錯誤
+var (
+	ErrInvalidThreadRoot = errors.New("無法在此訊息下建立討論串")
+)
+
+// checkThreadRoot 驗證討論串根訊息：需屬於同一對話、位於主對話中，且不是系統訊息或已收回的訊息
+func checkThreadRoot(params SendMessageParams) error {
+	var root models.Message
+	if err := config.DB.First(&root, params.ThreadRootID).Error; err != nil {
+		return ErrInvalidThreadRoot
+	}
+	if root.ThreadRootID != nil || root.RecalledAt != nil || root.MessageType == models.MessageTypeSystem {
+		return ErrInvalidThreadRoot
+	}
+	if !sameConversation(&root, params) {
+		return ErrInvalidThreadRoot
+	}
+	return nil
+}
+
+// sameConversation 檢查訊息是否與發送參數屬於同一對話
+func sameConversation(message *models.Message, params SendMessageParams) bool {
+	if params.RoomID != 0 {
+		return message.GetRoomID() == params.RoomID
+	}
+	if message.IsRoomMessage() {
+		return false
+	}
+	sameDirection := message.SenderID == params.SenderID && message.GetReceiverID() == params.ReceiverID
+	reverseDirection := message.SenderID == params.ReceiverID && message.GetReceiverID() == params.SenderID
+	return sameDirection || reverseDirection
+}
+
+// recordThreadReply 在交易中更新根訊息的回覆數與最後回覆時間，並讓回覆者與根訊息作者追蹤討論串
+func recordThreadReply(tx *gorm.DB, reply *models.Message) error {
+	rootID := *reply.ThreadRootID
+	if err := tx.Model(&models.Message{}).Where("id = ?", rootID).
+		Updates(map[string]interface{}{
+			"thread_reply_count":   gorm.Expr("thread_reply_count + 1"),
+			"thread_last_reply_at": reply.CreatedAt,
+		}).Error; err != nil {
+		return err
+	}
+
+	// 回覆者重新追蹤（即使先前取消過）
+	if err := tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"following": true}),
+	}).Create(&models.ThreadFollow{RootMessageID: rootID, UserID: reply.SenderID, Following: true}).Error; err != nil {
+		return err
+	}
+
+	// 根訊息作者預設追蹤，但保留其取消追蹤的設定
+	var rootSenderID uint
+	if err := tx.Model(&models.Message{}).Where("id = ?", rootID).Pluck("sender_id", &rootSenderID).Error; err != nil {
+		return err
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.ThreadFollow{RootMessageID: rootID, UserID: rootSenderID, Following: true}).Error
+}
+
+// refreshThreadStats 重新計算討論串的回覆數與最後回覆時間（不含已收回與已刪除的回覆）
+// 回覆被收回、刪除或到期時在同一交易中呼叫
+func refreshThreadStats(tx *gorm.DB, rootID uint) error {
+	var stats struct {
+		Count       int
+		LastReplyAt *time.Time
+	}
+	if err := tx.Model(&models.Message{}).
+		Select("COUNT(*) AS count, MAX(created_at) AS last_reply_at").
+		Where("thread_root_id = ? AND recalled_at IS NULL", rootID).
+		Scan(&stats).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Message{}).Where("id = ?", rootID).
+		Updates(map[string]interface{}{
+			"thread_reply_count":   stats.Count,
+			"thread_last_reply_at": stats.LastReplyAt,
+		}).Error
+}
+
+// ThreadFollowerIDs 取得追蹤討論串且仍是對話參與者的使用者
+func ThreadFollowerIDs(root *models.Message) []uint {
+	query := config.DB.Model(&models.ThreadFollow{}).
+		Where("root_message_id = ? AND following = ?", root.ID, true)
+	if root.IsRoomMessage() {
+		query = query.Where("user_id IN (?)",
+			config.DB.Model(&models.RoomMember{}).Select("user_id").Where("room_id = ?", root.GetRoomID()))
+	} else {
+		query = query.Where("user_id IN ?", []uint{root.SenderID, root.GetReceiverID()})
+	}
+
+	followers := make([]uint, 0)
+	query.Pluck("user_id", &followers)
+	return followers
+}
+
+// GetThreadRoot 取得使用者可存取的討論串根訊息
+func GetThreadRoot(messageID, userID uint) (*models.Message, error) {
+	root, err := GetAccessibleMessage(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if root.ThreadRootID != nil {
+		return nil, ErrInvalidThreadRoot
+	}
+	return root, nil
+}
+
+// GetThreadReplies 依游標分頁取得討論串回覆（由舊到新），排除使用者自行刪除的訊息
+func GetThreadReplies(rootID, userID uint, cursor MessageCursor) (*MessagePage, error) {
+	return PageMessages(func(db *gorm.DB) *gorm.DB {
+		return db.Where("messages.thread_root_id = ?", rootID).Scopes(NotDeletedForUser(userID))
+	}, cursor)
+}
+
+// IsFollowingThread 檢查使用者是否追蹤討論串
+func IsFollowingThread(rootID, userID uint) bool {
+	var follow models.ThreadFollow
+	if err := config.DB.Where("root_message_id = ? AND user_id = ?", rootID, userID).
+		First(&follow).Error; err != nil {
+		return false
+	}
+	return follow.Following
+}
+
+// SetThreadFollow 追蹤或取消追蹤討論串
+func SetThreadFollow(rootID, userID uint, following bool) error {
+	if _, err := GetThreadRoot(rootID, userID); err != nil {
+		return err
+	}
+	return config.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"following", "updated_at"}),
+	}).Create(&models.ThreadFollow{RootMessageID: rootID, UserID: userID, Following: following}).Error
+}
+
+// deliveryRecipients 取得訊息要推送的接收者（不含發送者）
+// 討論串回覆只推送給追蹤討論串的參與者，其餘訊息推送給對話所有參與者
+func (h *Hub) deliveryRecipients(message *models.Message) []uint {
+	if message.ThreadRootID == nil {
+		return h.recipientIDs(message)
+	}
+
+	var root models.Message
+	if err := config.DB.First(&root, *message.ThreadRootID).Error; err != nil {
+		return []uint{}
+	}
+	followers := ThreadFollowerIDs(&root)
+	recipients := make([]uint, 0, len(followers))
+	for _, id := range followers {
+		if id != message.SenderID {
+			recipients = append(recipients, id)
+		}
+	}
+	return recipients
+}
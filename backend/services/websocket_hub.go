@@ -1,10 +1,15 @@
 package services
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"gin-project/models"
 	"log"
+	"net"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -15,24 +20,117 @@ type Client struct {
 	Conn     *websocket.Conn
 	UserID   uint
 	Username string
-	Send     chan []byte
+
+	// SessionID 連線識別碼，同一使用者的每個裝置各自獨立
+	SessionID string
+
+	// DeviceID 客戶端自行提供的裝置識別（可選，僅供記錄）
+	DeviceID string
+
+	// Resume 為 true 時，連線建立後先補發序號大於 LastSeq 的事件
+	Resume  bool
+	LastSeq uint64
+
+	Send chan []byte
+
+	// registered 在 Hub 完成註冊後關閉，補發事件前需等待以免遺漏
+	registered chan struct{}
+
+	// startSeq 註冊前的事件序號，新連線從此序號之後開始補發
+	startSeq uint64
+
+	// 閒置偵測：最後活動時間與客戶端回報的閒置狀態
+	activityMu   sync.Mutex
+	lastActivity time.Time
+	reportedIdle bool
+
+	// locationUpdatedAt 各即時位置訊息最後一次寫入的時間，只在 ReadPump 中存取
+	locationUpdatedAt map[uint]time.Time
+}
+
+// NewClient 建立新的客戶端連線
+func NewClient(hub *Hub, conn *websocket.Conn, userID uint, username, deviceID string) *Client {
+	return &Client{
+		Hub:        hub,
+		Conn:       conn,
+		UserID:     userID,
+		Username:   username,
+		SessionID:  NewSessionID(),
+		DeviceID:   deviceID,
+		Send:       make(chan []byte, 256),
+		registered: make(chan struct{}),
+
+		lastActivity: time.Now(),
+	}
+}
+
+// NewSessionID 產生新的連線識別碼
+func NewSessionID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("❌ 產生連線識別碼失敗: %v", err)
+	}
+	return hex.EncodeToString(buf)
 }
 
 // Message 定義 WebSocket 訊息結構
 type Message struct {
-	Type       string      `json:"type"`        // message, typing, read, online, offline
-	SenderID   uint        `json:"sender_id"`   // 發送者 ID
-	ReceiverID uint        `json:"receiver_id"` // 接收者 ID
-	Content    string      `json:"content"`     // 訊息內容
-	MessageID  uint        `json:"message_id"`  // 訊息 ID（用於已讀回執）
-	Timestamp  string      `json:"timestamp"`   // 時間戳
-	Data       interface{} `json:"data"`        // 額外數據
+	Type       string      `json:"type"`              // message, typing, read, activity, presence
+	SenderID   uint        `json:"sender_id"`         // 發送者 ID
+	ReceiverID uint        `json:"receiver_id"`       // 接收者 ID
+	RoomID     uint        `json:"room_id,omitempty"` // 群組聊天室 ID
+	Content    string      `json:"content"`           // 訊息內容
+	MessageID  uint        `json:"message_id"`        // 訊息 ID（用於已讀回執）
+	Timestamp  string      `json:"timestamp"`         // 時間戳
+	Data       interface{} `json:"data"`              // 額外數據
+
+	// 聊天訊息欄位（type 為 message 時使用）
+	MessageType  string `json:"message_type,omitempty"` // text, image, video, file
+	FileURL      string `json:"file_url,omitempty"`
+	FileName     string `json:"file_name,omitempty"`
+	FileSize     int64  `json:"file_size,omitempty"`
+	ClientMsgID  string `json:"client_msg_id,omitempty"`  // 客戶端冪等鍵
+	ReplyToID    uint   `json:"reply_to_id,omitempty"`    // 回覆的訊息
+	ThreadRootID uint   `json:"thread_root_id,omitempty"` // 發送到討論串
+
+	// 結構化訊息欄位，與 POST /api/chat/send 相同
+	Poll     *PollParams             `json:"poll,omitempty"`     // 投票內容（message_type 為 poll 時必填）
+	Location *models.LocationPayload `json:"location,omitempty"` // 位置（message_type 為 location 時必填）
+	Contact  *models.ContactPayload  `json:"contact,omitempty"`  // 名片，只需填 user_id（message_type 為 contact 時必填）
+
+	// Seq 使用者事件序號（單調遞增，重連時用於補發）
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// HeartbeatConfig WebSocket 心跳與逾時設定
+type HeartbeatConfig struct {
+	// PingInterval 伺服器發送 ping 的間隔，必須小於 PongWait
+	PingInterval time.Duration
+
+	// PongWait 等待 pong 或任何客戶端訊息的逾時，逾時視為連線中斷
+	PongWait time.Duration
+
+	// WriteWait 單次寫入的逾時
+	WriteWait time.Duration
+
+	// MaxMessageSize 客戶端單一訊息的最大位元組數
+	MaxMessageSize int64
+}
+
+// DefaultHeartbeatConfig 預設心跳設定
+func DefaultHeartbeatConfig() HeartbeatConfig {
+	return HeartbeatConfig{
+		PingInterval:   54 * time.Second,
+		PongWait:       60 * time.Second,
+		WriteWait:      10 * time.Second,
+		MaxMessageSize: 64 * 1024,
+	}
 }
 
 // Hub 管理所有 WebSocket 連接
 type Hub struct {
-	// 已註冊的客戶端，key 為 UserID
-	Clients map[uint]*Client
+	// 已註冊的客戶端，key 為 UserID，value 為該使用者所有連線（key 為 SessionID）
+	Clients map[uint]map[string]*Client
 
 	// 廣播訊息通道
 	Broadcast chan *Message
@@ -43,6 +141,19 @@ type Hub struct {
 	// 註銷客戶端
 	Unregister chan *Client
 
+	// 心跳與逾時設定
+	Heartbeat HeartbeatConfig
+
+	// 跨實例訊息代理與叢集在線狀態登記（單機部署時使用記憶體實作）
+	Broker     Broker
+	Presence   PresenceRegistry
+	InstanceID string
+
+	// IdleTimeout 所有連線超過此時間沒有活動時自動顯示為 away
+	IdleTimeout time.Duration
+	idleUsers   map[uint]bool
+	idleMu      sync.Mutex
+
 	// 讀寫鎖
 	mu sync.RWMutex
 }
@@ -50,116 +161,202 @@ type Hub struct {
 // NewHub 建立新的 Hub
 func NewHub() *Hub {
 	return &Hub{
-		Clients:    make(map[uint]*Client),
+		Clients:    make(map[uint]map[string]*Client),
 		Broadcast:  make(chan *Message),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
+		Heartbeat:  DefaultHeartbeatConfig(),
+		Broker:     NewMemoryBroker(),
+		Presence:   NewMemoryPresence(),
+		InstanceID: NewSessionID(),
+
+		IdleTimeout: 5 * time.Minute,
+		idleUsers:   make(map[uint]bool),
 	}
 }
 
+// RegisterClient 記錄目前的事件序號後註冊客戶端
+// 序號需在註冊前取得：註冊後產生的事件會同時出現在補發結果與發送通道，以序號去重
+func (h *Hub) RegisterClient(client *Client) {
+	client.startSeq = CurrentEventSeq(client.UserID)
+	h.Register <- client
+}
+
 // Run 啟動 Hub
 func (h *Hub) Run() {
+	// 接收其他實例發布的推送訊息
+	if err := h.Broker.Subscribe(hubChannel, h.handleBrokerMessage); err != nil {
+		log.Printf("❌ 訂閱跨實例推送頻道失敗，僅推送給本實例連線: %v", err)
+	}
+
 	for {
 		select {
 		case client := <-h.Register:
 			h.mu.Lock()
-			h.Clients[client.UserID] = client
+			sessions, ok := h.Clients[client.UserID]
+			if !ok {
+				sessions = make(map[string]*Client)
+				h.Clients[client.UserID] = sessions
+			}
+			sessions[client.SessionID] = client
+			localSessions := len(sessions)
 			h.mu.Unlock()
-			log.Printf("✓ 使用者 %s (ID: %d) 已連接 WebSocket", client.Username, client.UserID)
+			if client.registered != nil {
+				close(client.registered)
+			}
+			log.Printf("✓ 使用者 %s (ID: %d) 已連接 WebSocket（連線 %s，本實例共 %d 個）",
+				client.Username, client.UserID, client.SessionID, localSessions)
 
-			// 通知使用者上線
-			h.BroadcastOnlineStatus(client.UserID, true)
+			// 使用者在整個叢集的第一個連線建立時才通知上線
+			firstSession, err := h.Presence.AddSession(client.UserID, client.SessionID)
+			if err != nil {
+				log.Printf("❌ 登記使用者 %d 在線狀態失敗: %v", client.UserID, err)
+			}
+			if firstSession {
+				h.BroadcastPresence(client.UserID)
+			} else {
+				// 新裝置連線代表使用者回到活躍狀態
+				h.refreshIdle(client.UserID)
+			}
 
 		case client := <-h.Unregister:
 			h.mu.Lock()
-			if _, ok := h.Clients[client.UserID]; ok {
-				delete(h.Clients, client.UserID)
-				close(client.Send)
-				log.Printf("✓ 使用者 %s (ID: %d) 已斷開 WebSocket", client.Username, client.UserID)
-			}
+			removed := h.removeClient(client)
 			h.mu.Unlock()
 
-			// 通知使用者下線
-			h.BroadcastOnlineStatus(client.UserID, false)
+			if removed {
+				h.leavePresence(client)
+			}
 
 		case message := <-h.Broadcast:
-			h.mu.RLock()
-			// 根據接收者 ID 發送訊息
-			if client, ok := h.Clients[message.ReceiverID]; ok {
-				select {
-				case client.Send <- h.encodeMessage(message):
-				default:
-					close(client.Send)
-					delete(h.Clients, client.UserID)
-				}
-			}
-			h.mu.RUnlock()
+			// 根據接收者 ID 發送訊息給其所有連線
+			h.SendToUser(message.ReceiverID, message)
 		}
 	}
 }
 
-// SendToUser 發送訊息給指定使用者
-func (h *Hub) SendToUser(userID uint, message *Message) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+// removeClient 移除指定連線並關閉其發送通道（呼叫者需持有寫鎖）
+// 回傳值表示連線是否確實被移除
+func (h *Hub) removeClient(client *Client) bool {
+	sessions, ok := h.Clients[client.UserID]
+	if !ok {
+		return false
+	}
+	if current, ok := sessions[client.SessionID]; !ok || current != client {
+		return false
+	}
 
-	if client, ok := h.Clients[userID]; ok {
-		select {
-		case client.Send <- h.encodeMessage(message):
-		default:
-			log.Printf("⚠ 發送訊息給使用者 %d 失敗：通道已滿", userID)
-		}
+	delete(sessions, client.SessionID)
+	close(client.Send)
+	log.Printf("✓ 使用者 %s (ID: %d) 已斷開 WebSocket（連線 %s）", client.Username, client.UserID, client.SessionID)
+
+	if len(sessions) == 0 {
+		delete(h.Clients, client.UserID)
 	}
+	return true
 }
 
-// BroadcastOnlineStatus 廣播使用者在線狀態
-func (h *Hub) BroadcastOnlineStatus(userID uint, isOnline bool) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+// leavePresence 從叢集在線狀態移除連線，使用者在整個叢集都沒有連線時廣播下線
+func (h *Hub) leavePresence(client *Client) {
+	lastSession, err := h.Presence.RemoveSession(client.UserID, client.SessionID)
+	if err != nil {
+		log.Printf("❌ 移除使用者 %d 在線狀態失敗: %v", client.UserID, err)
+		return
+	}
+	if lastSession {
+		h.markOffline(client.UserID)
+	}
+}
 
-	status := "offline"
-	if isOnline {
-		status = "online"
+// markOffline 使用者在整個叢集都沒有連線時，記錄最後上線時間並廣播下線
+func (h *Hub) markOffline(userID uint) {
+	// 清除閒置狀態，下次上線時從活躍開始
+	h.idleMu.Lock()
+	delete(h.idleUsers, userID)
+	h.idleMu.Unlock()
+	setUserIdle(userID, false)
+
+	RecordLastSeen(userID)
+	h.BroadcastPresence(userID)
+}
+
+// SendToUser 發送訊息給指定使用者的所有連線（包含其他實例），回傳本實例成功送達的連線數
+// 訊息會先配置事件序號並儲存，使用者重連時可補發
+func (h *Hub) SendToUser(userID uint, message *Message) int {
+	data := h.recordUserEvent(userID, message)
+	delivered := h.deliverToUser(userID, data)
+	h.publish(brokerEnvelope{UserIDs: []uint{userID}, Payload: data})
+	return delivered
+}
+
+// sendEphemeral 推送不需補發的即時訊息（正在輸入、在線狀態）給多位使用者的所有連線（包含其他實例）
+// 不配置事件序號也不儲存，避免高頻訊息寫入資料庫
+func (h *Hub) sendEphemeral(userIDs []uint, message *Message) {
+	if len(userIDs) == 0 {
+		return
 	}
+	data := h.encodeMessage(message)
+	for _, userID := range userIDs {
+		h.deliverToUser(userID, data)
+	}
+	h.publish(brokerEnvelope{UserIDs: userIDs, Payload: data})
+}
 
-	message := &Message{
-		Type:     status,
-		SenderID: userID,
-		Data: map[string]interface{}{
-			"user_id":   userID,
-			"is_online": isOnline,
-		},
+// deliverToUser 將已編碼的訊息推送給使用者在本實例的所有連線
+func (h *Hub) deliverToUser(userID uint, data []byte) int {
+	h.mu.RLock()
+	var delivered int
+	var stalled []*Client
+	for _, client := range h.Clients[userID] {
+		select {
+		case client.Send <- data:
+			delivered++
+		default:
+			log.Printf("⚠ 發送訊息給使用者 %d（連線 %s）失敗：通道已滿", userID, client.SessionID)
+			stalled = append(stalled, client)
+		}
 	}
+	h.mu.RUnlock()
 
-	// 發送給所有已連接的使用者
-	for _, client := range h.Clients {
-		if client.UserID != userID {
-			select {
-			case client.Send <- h.encodeMessage(message):
-			default:
-			}
+	// 移除無法跟上的連線，避免通道持續阻塞
+	if len(stalled) > 0 {
+		h.dropClients(stalled)
+	}
+
+	return delivered
+}
+
+// dropClients 強制移除多個連線，必要時廣播下線
+func (h *Hub) dropClients(clients []*Client) {
+	var removed []*Client
+	h.mu.Lock()
+	for _, client := range clients {
+		if h.removeClient(client) {
+			removed = append(removed, client)
 		}
 	}
+	h.mu.Unlock()
+
+	for _, client := range removed {
+		h.leavePresence(client)
+	}
 }
 
-// IsUserOnline 檢查使用者是否在線
+// IsUserOnline 檢查使用者是否在叢集任一實例上在線
 func (h *Hub) IsUserOnline(userID uint) bool {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	_, ok := h.Clients[userID]
-	return ok
+	return h.Presence.IsOnline(userID)
 }
 
-// GetOnlineUsers 取得所有在線使用者
-func (h *Hub) GetOnlineUsers() []uint {
+// GetUserSessionCount 取得使用者在本實例的連線數
+func (h *Hub) GetUserSessionCount(userID uint) int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
+	return len(h.Clients[userID])
+}
 
-	users := make([]uint, 0, len(h.Clients))
-	for userID := range h.Clients {
-		users = append(users, userID)
-	}
-	return users
+// GetOnlineUsers 取得叢集中所有在線使用者
+func (h *Hub) GetOnlineUsers() []uint {
+	return h.Presence.OnlineUsers()
 }
 
 // encodeMessage 將訊息編碼為 JSON
@@ -173,21 +370,38 @@ func (h *Hub) encodeMessage(message *Message) []byte {
 }
 
 // readPump 從 WebSocket 連接讀取訊息
+// 逾時未收到 pong 或任何訊息的連線會被視為中斷並註銷，由 Hub 廣播下線狀態
 func (c *Client) ReadPump() {
 	defer func() {
 		c.Hub.Unregister <- c
 		c.Conn.Close()
 	}()
 
+	heartbeat := c.Hub.Heartbeat
+	c.Conn.SetReadLimit(heartbeat.MaxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(heartbeat.PongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(heartbeat.PongWait))
+	})
+
 	for {
 		_, messageData, err := c.Conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			var netErr net.Error
+			switch {
+			case errors.As(err, &netErr) && netErr.Timeout():
+				log.Printf("⚠ 使用者 %d（連線 %s）心跳逾時，關閉連線", c.UserID, c.SessionID)
+			case errors.Is(err, websocket.ErrReadLimit):
+				log.Printf("⚠ 使用者 %d（連線 %s）訊息超過 %d bytes，關閉連線", c.UserID, c.SessionID, heartbeat.MaxMessageSize)
+			case websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure):
 				log.Printf("❌ WebSocket 讀取錯誤: %v", err)
 			}
 			break
 		}
 
+		// 任何客戶端訊息都代表連線仍存活
+		c.Conn.SetReadDeadline(time.Now().Add(heartbeat.PongWait))
+
 		var message Message
 		if err := json.Unmarshal(messageData, &message); err != nil {
 			log.Printf("❌ JSON 解碼失敗: %v", err)
@@ -197,47 +411,253 @@ func (c *Client) ReadPump() {
 		// 設置發送者資訊
 		message.SenderID = c.UserID
 
+		// 記錄活動，供閒置偵測使用（activity 訊息可回報 idle 表示客戶端已閒置）
+		idle := message.Type == "activity" && activityState(message.Data) == "idle"
+		if c.markActivity(idle, c.Hub.IdleTimeout) {
+			c.Hub.refreshIdle(c.UserID)
+		}
+
 		// 根據訊息類型處理
 		switch message.Type {
 		case "message":
-			// 發送訊息給接收者
-			c.Hub.Broadcast <- &message
+			// 與 REST API 相同流程：檢查好友關係並寫入資料庫，再推送給雙方
+			saved, duplicate, err := SaveMessageToDB(SendMessageParams{
+				SenderID:     c.UserID,
+				ReceiverID:   message.ReceiverID,
+				RoomID:       message.RoomID,
+				Content:      message.Content,
+				MessageType:  message.MessageType,
+				FileURL:      message.FileURL,
+				FileName:     message.FileName,
+				FileSize:     message.FileSize,
+				ClientMsgID:  message.ClientMsgID,
+				ReplyToID:    message.ReplyToID,
+				ThreadRootID: message.ThreadRootID,
+				Poll:         message.Poll,
+				Location:     message.Location,
+				Contact:      message.Contact,
+			})
+			if err != nil {
+				log.Printf("❌ 使用者 %d 透過 WebSocket 發送訊息失敗: %v", c.UserID, err)
+				c.sendError(err.Error())
+				continue
+			}
+			c.Hub.DispatchChatMessage(saved, duplicate)
 
 		case "typing":
-			// 轉發正在輸入狀態
-			c.Hub.SendToUser(message.ReceiverID, &message)
+			// 轉發正在輸入狀態（群組聊天室轉發給其他成員，私訊只轉發給好友）
+			if message.RoomID != 0 {
+				c.Hub.sendToRoom(message.RoomID, c.UserID, &message)
+				continue
+			}
+			if !AreFriends(c.UserID, message.ReceiverID) {
+				continue
+			}
+			c.Hub.sendEphemeral([]uint{message.ReceiverID}, &message)
 
 		case "read":
-			// 轉發已讀回執
-			c.Hub.SendToUser(message.ReceiverID, &message)
+			// 前進已讀位置（receiver_id 為私訊對象，或以 room_id 指定聊天室），由伺服器推送已讀回執
+			receipt, err := MarkConversationRead(MarkReadParams{
+				UserID:    c.UserID,
+				PeerID:    message.ReceiverID,
+				RoomID:    message.RoomID,
+				MessageID: message.MessageID,
+			})
+			if err != nil {
+				c.sendError(err.Error())
+				continue
+			}
+			if receipt != nil {
+				c.Hub.PushReadReceipt(receipt)
+			}
+
+		case "location":
+			// 更新即時位置（message_id 為分享中的位置訊息，data 含 latitude、longitude），由伺服器推送給對話參與者
+			// 每則位置訊息在 MinLiveLocationInterval 內只寫入一次，過於頻繁的回報直接捨棄
+			latitude, longitude, ok := locationCoordinates(message.Data)
+			if !ok {
+				c.sendError(ErrInvalidLocation.Error())
+				continue
+			}
+			now := time.Now()
+			if !c.allowLocationUpdate(message.MessageID, now) {
+				continue
+			}
+			saved, location, err := UpdateLiveLocation(message.MessageID, c.UserID, latitude, longitude, now)
+			if err != nil {
+				c.sendError(err.Error())
+				continue
+			}
+			c.Hub.PushLocationUpdated(saved, location)
 		}
 	}
 }
 
-// writePump 向 WebSocket 連接寫入訊息
+// locationCoordinates 取得 location 訊息回報的經緯度
+func locationCoordinates(data interface{}) (float64, float64, bool) {
+	fields, ok := data.(map[string]interface{})
+	if !ok {
+		return 0, 0, false
+	}
+	latitude, latOK := fields["latitude"].(float64)
+	longitude, lngOK := fields["longitude"].(float64)
+	return latitude, longitude, latOK && lngOK
+}
+
+// activityState 取得 activity 訊息回報的狀態（active 或 idle）
+func activityState(data interface{}) string {
+	fields, ok := data.(map[string]interface{})
+	if !ok {
+		return "active"
+	}
+	state, _ := fields["state"].(string)
+	return state
+}
+
+// sendError 回傳錯誤訊息給此連線
+func (c *Client) sendError(reason string) {
+	c.Hub.mu.RLock()
+	defer c.Hub.mu.RUnlock()
+
+	// 連線已註銷時通道已關閉，不可再寫入
+	if current, ok := c.Hub.Clients[c.UserID][c.SessionID]; !ok || current != c {
+		return
+	}
+
+	select {
+	case c.Send <- c.Hub.encodeMessage(&Message{
+		Type:       "error",
+		ReceiverID: c.UserID,
+		Content:    reason,
+		Timestamp:  time.Now().Format(time.RFC3339),
+	}):
+	default:
+	}
+}
+
+// writePump 向 WebSocket 連接寫入訊息，並定期發送 ping 維持心跳
 func (c *Client) WritePump() {
+	ticker := time.NewTicker(c.Hub.Heartbeat.PingInterval)
 	defer func() {
+		ticker.Stop()
 		c.Conn.Close()
 	}()
 
+	// 先補發斷線期間的事件，再開始即時推送
+	replayedUpTo, err := c.replayMissedEvents()
+	if err != nil {
+		log.Printf("❌ 補發事件給使用者 %d 失敗: %v", c.UserID, err)
+		return
+	}
+
 	for {
-		message, ok := <-c.Send
-		if !ok {
-			// Hub 關閉了通道
-			c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-			return
+		select {
+		case message, ok := <-c.Send:
+			if !ok {
+				// Hub 關閉了通道
+				c.write(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			// 略過已在補發階段送出的事件
+			if replayedUpTo > 0 {
+				if seq := peekEventSeq(message); seq != 0 && seq <= replayedUpTo {
+					continue
+				}
+			}
+
+			if err := c.write(websocket.TextMessage, message); err != nil {
+				log.Printf("❌ WebSocket 寫入錯誤: %v", err)
+				return
+			}
+
+		case <-ticker.C:
+			// ping 失敗代表連線已中斷，關閉後由 ReadPump 註銷
+			if err := c.write(websocket.PingMessage, nil); err != nil {
+				log.Printf("⚠ 使用者 %d（連線 %s）ping 失敗: %v", c.UserID, c.SessionID, err)
+				return
+			}
 		}
+	}
+}
+
+// write 在寫入逾時限制內寫入一則 WebSocket 訊息
+func (c *Client) write(messageType int, data []byte) error {
+	c.Conn.SetWriteDeadline(time.Now().Add(c.Hub.Heartbeat.WriteWait))
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// replayMissedEvents 補發序號大於 LastSeq（新連線為註冊前的序號）的事件，並送出 session 訊息表示開始即時推送
+// 回傳已補發的最大序號
+func (c *Client) replayMissedEvents() (uint64, error) {
+	if c.registered != nil {
+		<-c.registered
+	}
 
-		if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			log.Printf("❌ WebSocket 寫入錯誤: %v", err)
-			return
+	// 新連線從註冊前的序號開始，補發取得序號到完成註冊之間產生的事件
+	afterSeq := c.startSeq
+	if c.Resume {
+		afterSeq = c.LastSeq
+	}
+
+	var replayedUpTo uint64
+	var replayed int
+	resync := false
+
+	events, err := LoadEventsAfter(c.UserID, afterSeq, MaxReplayEvents+1)
+	if err != nil {
+		return 0, err
+	}
+
+	// 遺漏太多事件時不補發，要求客戶端透過 REST API 重新同步
+	if len(events) > MaxReplayEvents {
+		resync = true
+	} else {
+		for _, event := range events {
+			if err := c.write(websocket.TextMessage, []byte(event.Payload)); err != nil {
+				return 0, err
+			}
+			replayedUpTo = event.Seq
+			replayed++
 		}
 	}
+
+	// 客戶端應記錄的基準序號：補發時為最後補發的序號，其餘情況為開始的序號
+	baseSeq := afterSeq
+	if replayedUpTo > baseSeq {
+		baseSeq = replayedUpTo
+	}
+	if resync {
+		// 重新同步後從目前序號開始；發送通道中的事件不再略過，客戶端收到重複事件時以序號去重
+		baseSeq = CurrentEventSeq(c.UserID)
+		replayedUpTo = 0
+	}
+
+	session := c.Hub.encodeMessage(&Message{
+		Type:       "session",
+		ReceiverID: c.UserID,
+		Timestamp:  time.Now().Format(time.RFC3339),
+		Data: map[string]interface{}{
+			"session_id": c.SessionID,
+			"last_seq":   baseSeq,
+			"replayed":   replayed,
+			"resync":     resync,
+		},
+	})
+	if err := c.write(websocket.TextMessage, session); err != nil {
+		return 0, err
+	}
+
+	return replayedUpTo, nil
 }
 
-// SaveMessageToDB 將訊息儲存到資料庫
-func SaveMessageToDB(senderID, receiverID uint, content string) (*models.Message, error) {
-	// 這個函數會在 chat_controller.go 中實現
-	// 這裡只是定義介面
-	return nil, nil
+// peekEventSeq 取得已編碼訊息中的事件序號
+func peekEventSeq(data []byte) uint64 {
+	var header struct {
+		Seq uint64 `json:"seq"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0
+	}
+	return header.Seq
 }
@@ -1,7 +1,7 @@
 import { apiClient } from './client';
 
 // 發送訊息
-export const sendMessage = async (receiverId, content, messageType = 'text', fileData = null) => {
+export const sendMessage = async (receiverId, content, messageType = 'text', fileData = null, replyToId = null) => {
   return await apiClient.post('/chat/send', {
     receiver_id: receiverId,
     content,
@@ -9,6 +9,7 @@ export const sendMessage = async (receiverId, content, messageType = 'text', fil
     file_url: fileData?.file_url,
     file_name: fileData?.file_name,
     file_size: fileData?.file_size,
+    reply_to_id: replyToId || undefined,
   });
 };
 
@@ -27,10 +28,10 @@ export const uploadFile = async (file, fileType) => {
   });
 };
 
-// 獲取聊天記錄
-export const getMessages = async (friendId, page = 1, pageSize = 50) => {
+// 獲取聊天記錄（cursor 可包含 before、after 或 around 訊息 ID 與 limit，未提供時取最新訊息）
+export const getMessages = async (friendId, cursor = {}) => {
   return await apiClient.get(`/chat/${friendId}/messages`, {
-    params: { page, page_size: pageSize },
+    params: { limit: 50, ...cursor },
   });
 };
 
@@ -39,12 +40,144 @@ export const markAsRead = async (messageId) => {
   return await apiClient.put(`/messages/${messageId}/read`);
 };
 
+// 將與好友的對話標記已讀到指定訊息（省略時為最新訊息）
+export const markChatRead = async (friendId, messageId) => {
+  return await apiClient.put(`/chat/${friendId}/read`, messageId ? { message_id: messageId } : {});
+};
+
+// 取得與好友對話的個人設定
+export const getChatConversation = async (friendId) => {
+  return await apiClient.get(`/chat/${friendId}/conversation`);
+};
+
+// 更新與好友對話的個人設定（mute_seconds、pinned、archived、marked_unread、draft）
+export const updateChatConversation = async (friendId, settings) => {
+  return await apiClient.put(`/chat/${friendId}/conversation`, settings);
+};
+
+// 編輯訊息
+export const editMessage = async (messageId, content) => {
+  return await apiClient.put(`/messages/${messageId}`, { content });
+};
+
+// 刪除訊息（僅對自己隱藏）
+export const deleteMessageForMe = async (messageId) => {
+  return await apiClient.delete(`/messages/${messageId}`);
+};
+
+// 收回訊息
+export const recallMessage = async (messageId) => {
+  return await apiClient.post(`/messages/${messageId}/recall`);
+};
+
+// 加上表情回應
+export const addReaction = async (messageId, emoji) => {
+  return await apiClient.post(`/messages/${messageId}/reactions`, { emoji });
+};
+
+// 移除表情回應
+export const removeReaction = async (messageId, emoji) => {
+  return await apiClient.delete(`/messages/${messageId}/reactions/${encodeURIComponent(emoji)}`);
+};
+
 // 獲取未讀訊息數量
 export const getUnreadCount = async () => {
   return await apiClient.get('/messages/unread');
 };
 
 // 獲取最近聊天列表
-export const getRecentChats = async () => {
-  return await apiClient.get('/chat/recent');
+export const getRecentChats = async ({ archived = false, cursor, limit } = {}) => {
+  return await apiClient.get('/chat/recent', { params: { archived: archived || undefined, cursor, limit } });
+};
+
+// 搜尋訊息（filters 可包含 friend_id、room_id、sender_id、type、from、to、cursor、limit）
+export const searchMessages = async (q, filters = {}) => {
+  return await apiClient.get('/search/messages', { params: { q, ...filters } });
+};
+
+// 建立排程訊息（scheduledAt 為 ISO 8601 時間字串）
+export const scheduleMessage = async ({ receiverId, roomId, content, messageType, fileUrl, fileName, fileSize, replyToId, scheduledAt }) => {
+  return await apiClient.post('/scheduled-messages', {
+    receiver_id: receiverId,
+    room_id: roomId,
+    content,
+    message_type: messageType,
+    file_url: fileUrl,
+    file_name: fileName,
+    file_size: fileSize,
+    reply_to_id: replyToId,
+    scheduled_at: scheduledAt,
+  });
+};
+
+// 獲取排程訊息（status 預設為 pending）
+export const getScheduledMessages = async (status) => {
+  return await apiClient.get('/scheduled-messages', { params: { status } });
+};
+
+// 修改排程訊息
+export const updateScheduledMessage = async (id, { content, scheduledAt }) => {
+  return await apiClient.put(`/scheduled-messages/${id}`, { content, scheduled_at: scheduledAt });
+};
+
+// 取消排程訊息
+export const cancelScheduledMessage = async (id) => {
+  return await apiClient.delete(`/scheduled-messages/${id}`);
+};
+
+// 獲取與好友對話的訊息自動銷毀設定
+export const getDisappearingTimer = async (friendId) => {
+  return await apiClient.get(`/chat/${friendId}/disappearing`);
+};
+
+// 設定與好友對話的訊息自動銷毀（seconds 為 0 表示關閉，mode 為 after_read 或 after_send）
+export const setDisappearingTimer = async (friendId, seconds, mode = 'after_read') => {
+  return await apiClient.put(`/chat/${friendId}/disappearing`, { seconds, mode });
+};
+
+// 發送投票（poll 包含 question、options、multiple_choice、anonymous、closes_at）
+export const sendPoll = async (receiverId, poll) => {
+  return await apiClient.post('/chat/send', {
+    receiver_id: receiverId,
+    message_type: 'poll',
+    poll,
+  });
+};
+
+// 投票（取代先前的選擇）
+export const votePoll = async (messageId, optionIds) => {
+  return await apiClient.post(`/messages/${messageId}/votes`, { option_ids: optionIds });
+};
+
+// 收回投票
+export const retractPollVote = async (messageId) => {
+  return await apiClient.delete(`/messages/${messageId}/votes`);
+};
+
+// 發送位置（location 包含 latitude、longitude、label，live_until 提供時為即時位置分享）
+export const sendLocation = async (receiverId, location) => {
+  return await apiClient.post('/chat/send', {
+    receiver_id: receiverId,
+    message_type: 'location',
+    location,
+  });
+};
+
+// 提前結束即時位置分享
+export const stopLiveLocation = async (messageId) => {
+  return await apiClient.post(`/messages/${messageId}/location/stop`);
+};
+
+// 分享名片（自己或好友）
+export const sendContact = async (receiverId, userId) => {
+  return await apiClient.post('/chat/send', {
+    receiver_id: receiverId,
+    message_type: 'contact',
+    contact: { user_id: userId },
+  });
+};
+
+// 向名片中的使用者發送好友請求
+export const requestContactFriend = async (messageId) => {
+  return await apiClient.post(`/messages/${messageId}/contact/friend-request`);
 };
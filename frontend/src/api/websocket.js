@@ -7,6 +7,7 @@ class WebSocketClient {
     this.reconnectAttempts = 0;
     this.maxReconnectAttempts = 5;
     this.reconnectDelay = 1000;
+    this.lastSeq = null; // 最後收到的事件序號，重連時用於補發
   }
 
   connect(token) {
@@ -15,7 +16,10 @@ class WebSocketClient {
       return;
     }
 
-    const wsUrl = `${WS_BASE_URL}?token=${token}`;
+    let wsUrl = `${WS_BASE_URL}?token=${token}`;
+    if (this.lastSeq !== null) {
+      wsUrl += `&last_seq=${this.lastSeq}`;
+    }
     
     try {
       this.ws = new WebSocket(wsUrl);
@@ -30,23 +34,61 @@ class WebSocketClient {
         try {
           const message = JSON.parse(event.data);
           console.log('收到訊息:', message);
+
+          // 記錄事件序號
+          if (message.seq) {
+            this.lastSeq = Math.max(this.lastSeq || 0, message.seq);
+          }
           
           // 根據訊息類型觸發不同事件
           switch (message.type) {
             case 'message':
               this.emit('message', message);
               break;
-            case 'online':
-              this.emit('online', message);
+            case 'presence':
+              this.emit('presence', message);
+              break;
+            case 'thread_message':
+              this.emit('thread_message', message);
+              break;
+            case 'message_edited':
+              this.emit('message_edited', message);
+              break;
+            case 'message_recalled':
+              this.emit('message_recalled', message);
+              break;
+            case 'reaction_added':
+              this.emit('reaction_added', message);
               break;
-            case 'offline':
-              this.emit('offline', message);
+            case 'reaction_removed':
+              this.emit('reaction_removed', message);
               break;
             case 'typing':
               this.emit('typing', message);
               break;
-            case 'read':
-              this.emit('read', message);
+            case 'conversation_updated':
+              this.emit('conversation_updated', message);
+              break;
+            case 'read_receipt':
+              this.emit('read_receipt', message);
+              break;
+            case 'poll_updated':
+              this.emit('poll_updated', message);
+              break;
+            case 'location_updated':
+              this.emit('location_updated', message);
+              break;
+            case 'message_expired':
+              this.emit('message_expired', message);
+              break;
+            case 'disappearing_timer_updated':
+              this.emit('disappearing_timer_updated', message);
+              break;
+            case 'scheduled_message_sent':
+              this.emit('scheduled_message_sent', message);
+              break;
+            case 'scheduled_message_failed':
+              this.emit('scheduled_message_failed', message);
               break;
             case 'friend_request':
               this.emit('friend_request', message);
@@ -57,6 +99,23 @@ class WebSocketClient {
             case 'friend_rejected':
               this.emit('friend_rejected', message);
               break;
+            case 'ack':
+              this.emit('ack', message);
+              break;
+            case 'delivered':
+              this.emit('delivered', message);
+              break;
+            case 'error':
+              this.emit('server_error', message);
+              break;
+            case 'session':
+              if (message.data) {
+                this.lastSeq = message.data.last_seq;
+                if (message.data.resync) {
+                  this.emit('resync', message);
+                }
+              }
+              break;
             default:
               this.emit('unknown', message);
           }
@@ -95,6 +154,7 @@ class WebSocketClient {
     this.listeners = {};
     this.reconnectAttempts = 0;
     this.reconnectDelay = 1000;
+    this.lastSeq = null;
   }
 
   send(type, data) {
@@ -111,12 +171,14 @@ class WebSocketClient {
   }
 
   // 發送訊息
-  sendMessage(receiverId, content, messageType = 'text') {
+  sendMessage(receiverId, content, messageType = 'text', clientMsgId = crypto.randomUUID()) {
     this.send('message', {
       receiver_id: receiverId,
       content,
       message_type: messageType,
+      client_msg_id: clientMsgId,
     });
+    return clientMsgId;
   }
 
   // 發送正在輸入通知
@@ -126,10 +188,27 @@ class WebSocketClient {
     });
   }
 
-  // 發送已讀通知
-  sendRead(messageId) {
+  // 已讀位置前進到 messageId（私訊指定 receiverId 為對方，群組指定 roomId）
+  sendRead(messageId, { receiverId, roomId } = {}) {
     this.send('read', {
       message_id: messageId,
+      receiver_id: receiverId,
+      room_id: roomId,
+    });
+  }
+
+  // 回報即時位置（messageId 為分享中的位置訊息）
+  sendLocationUpdate(messageId, latitude, longitude) {
+    this.send('location', {
+      message_id: messageId,
+      data: { latitude, longitude },
+    });
+  }
+
+  // 回報活躍 / 閒置狀態（例如分頁隱藏時回報 idle）
+  sendActivity(state = 'active') {
+    this.send('activity', {
+      data: { state },
     });
   }
 
@@ -1,7 +1,7 @@
 import { useLocation, useParams, useNavigate } from "react-router-dom";
 import { useState, useEffect, useRef } from "react";
 import { useAuth } from "../contexts/AuthContext";
-import { getMessages, sendMessage as sendChatMessage, markAsRead, uploadFile } from "../api/chat";
+import { getMessages, sendMessage as sendChatMessage, markAsRead, markChatRead, uploadFile, addReaction, removeReaction } from "../api/chat";
 import { STATIC_BASE_URL } from "../api/client";
 import wsClient from "../api/websocket";
 
@@ -62,38 +62,90 @@ export default function ChatPage() {
                     return [...prev, fullMessage];
                 });
                 scrollToBottom();
-                // 標記為已讀（只有收到對方的訊息時）
+                // 標記為已讀（只有收到對方的訊息時），伺服器會推送已讀回執給對方
                 if (isSenderMatch && fullMessage.message_id) {
-                    markAsRead(fullMessage.message_id).then(() => {
-                        // 標記成功後，透過 WebSocket 通知發送者
-                        if (wsClient.isConnected()) {
-                            wsClient.send('read', {
-                                message_id: fullMessage.message_id,
-                                receiver_id: fullMessage.sender_id,
-                            });
-                        }
-                    }).catch(console.error);
+                    markAsRead(fullMessage.message_id).catch(console.error);
                 }
             }
         };
 
-        // 監聽已讀通知
+        // 監聽已讀回執（對方已讀到 last_read_message_id，之前的訊息都視為已讀）
         const handleReadReceipt = (msg) => {
-            console.log('收到已讀通知:', msg);
-            // 更新本地訊息的已讀狀態
-            if (msg.message_id) {
-                setMessages(prev => prev.map(m => 
-                    m.id === msg.message_id ? { ...m, is_read: true } : m
+            const receipt = msg.data;
+            if (!receipt || receipt.user_id != friendId) return;
+            setMessages(prev => prev.map(m =>
+                m.sender_id === user.id && m.id <= receipt.last_read_message_id ? { ...m, is_read: true } : m
+            ));
+        };
+
+        // 監聽訊息編輯與收回（以伺服器回傳的最新版本取代）
+        const handleMessageEdited = (msg) => {
+            if (msg.data) {
+                setMessages(prev => prev.map(m =>
+                    m.id === msg.data.id ? { ...m, ...msg.data } : m
                 ));
             }
         };
 
+        // 監聽投票統計更新（伺服器以自己的角度統計）
+        const handlePollUpdated = (msg) => {
+            if (!msg.data) return;
+            setMessages(prev => prev.map(m =>
+                m.id === msg.message_id ? { ...m, poll: msg.data } : m
+            ));
+        };
+
+        // 監聽即時位置更新
+        const handleLocationUpdated = (msg) => {
+            if (!msg.data) return;
+            setMessages(prev => prev.map(m =>
+                m.id === msg.message_id ? { ...m, payload: { ...m.payload, location: msg.data } } : m
+            ));
+        };
+
+        // 監聽自動銷毀的訊息到期
+        const handleMessageExpired = (msg) => {
+            setMessages(prev => prev.filter(m => m.id !== msg.message_id));
+        };
+
+        // 監聽表情回應（伺服器回傳該表情最新的回應數）
+        const handleReaction = (msg) => {
+            const data = msg.data;
+            if (!data) return;
+            setMessages(prev => prev.map(m => {
+                if (m.id !== data.message_id) return m;
+                const others = (m.reactions || []).filter(r => r.emoji !== data.emoji);
+                const current = (m.reactions || []).find(r => r.emoji === data.emoji);
+                const reactedByMe = data.user_id === user.id
+                    ? msg.type === 'reaction_added'
+                    : !!current?.reacted_by_me;
+                const reactions = data.count > 0
+                    ? [...others, { emoji: data.emoji, count: data.count, reacted_by_me: reactedByMe }]
+                    : others;
+                return { ...m, reactions };
+            }));
+        };
+
         wsClient.on('message', handleNewMessage);
-        wsClient.on('read', handleReadReceipt);
+        wsClient.on('read_receipt', handleReadReceipt);
+        wsClient.on('reaction_added', handleReaction);
+        wsClient.on('reaction_removed', handleReaction);
+        wsClient.on('message_edited', handleMessageEdited);
+        wsClient.on('message_recalled', handleMessageEdited);
+        wsClient.on('message_expired', handleMessageExpired);
+        wsClient.on('poll_updated', handlePollUpdated);
+        wsClient.on('location_updated', handleLocationUpdated);
 
         return () => {
             wsClient.off('message', handleNewMessage);
-            wsClient.off('read', handleReadReceipt);
+            wsClient.off('read_receipt', handleReadReceipt);
+            wsClient.off('reaction_added', handleReaction);
+            wsClient.off('reaction_removed', handleReaction);
+            wsClient.off('message_edited', handleMessageEdited);
+            wsClient.off('message_recalled', handleMessageEdited);
+            wsClient.off('message_expired', handleMessageExpired);
+            wsClient.off('poll_updated', handlePollUpdated);
+            wsClient.off('location_updated', handleLocationUpdated);
         };
     }, [friendId, user.id]);
 
@@ -127,16 +179,9 @@ export default function ChatPage() {
                 const unreadMessages = messages.filter(
                     msg => !msg.is_read && msg.receiver_id === user.id
                 );
-                for (const msg of unreadMessages) {
-                    await markAsRead(msg.id).then(() => {
-                        // 標記成功後，透過 WebSocket 通知發送者
-                        if (wsClient.isConnected()) {
-                            wsClient.send('read', {
-                                message_id: msg.id,
-                                receiver_id: msg.sender_id,
-                            });
-                        }
-                    }).catch(console.error);
+                if (unreadMessages.length > 0) {
+                    const lastUnread = unreadMessages[unreadMessages.length - 1];
+                    await markChatRead(parseInt(friendId), lastUnread.id).catch(console.error);
                 }
             }
         } catch (error) {
@@ -177,26 +222,8 @@ export default function ChatPage() {
             
             // 添加到本地訊息列表
             if (response.data) {
-                setMessages(prev => [...prev, response.data]);
-                
-                // 透過 WebSocket 通知對方（發送完整的訊息資料）
-                if (wsClient.isConnected()) {
-                    wsClient.send('message', {
-                        sender_id: response.data.sender_id,
-                        receiver_id: parseInt(friendId),
-                        content: response.data.content,
-                        message_id: response.data.id,
-                        data: {
-                            id: response.data.id,
-                            message_type: response.data.message_type,
-                            file_url: response.data.file_url,
-                            file_name: response.data.file_name,
-                            file_size: response.data.file_size,
-                            created_at: response.data.created_at,
-                            is_read: false,
-                        },
-                    });
-                }
+                // 伺服器會透過 WebSocket 推送同一則訊息，這裡先去重再加入
+                setMessages(prev => prev.some(m => m.id === response.data.id) ? prev : [...prev, response.data]);
             }
             
             setMessage("");
@@ -307,6 +334,7 @@ export default function ChatPage() {
                                 {/* 自己的訊息：時間和已讀在左邊 */}
                                 {isMe && (
                                     <div className="text-xs md:text-sm text-gray-500 mb-1 whitespace-nowrap">
+                                        {msg.edited && '已編輯 '}
                                         {formatTime(msg.created_at || msg.timestamp)}
                                         {msg.is_read && ' ✓✓'}
                                     </div>
@@ -319,6 +347,15 @@ export default function ChatPage() {
                                             : 'bg-white text-gray-800'
                                     }`}
                                 >
+                                    {/* 被回覆訊息的預覽 */}
+                                    {msg.reply_to && (
+                                        <div className="mb-1 pl-2 border-l-2 border-gray-300 text-sm opacity-75 truncate">
+                                            {msg.reply_to.deleted
+                                                ? '原訊息已刪除'
+                                                : `${msg.reply_to.sender?.display_name || msg.reply_to.sender?.username || ''}: ${msg.reply_to.content || msg.reply_to.file_name || ''}`}
+                                        </div>
+                                    )}
+
                                     {/* 顯示不同類型的訊息 */}
                                     {msg.message_type === 'image' && msg.file_url && (
                                         <div>
@@ -364,15 +401,35 @@ export default function ChatPage() {
                                             )}
                                         </a>
                                     )}
+                                    {msg.recalled && (
+                                        <div className="italic text-gray-400">訊息已收回</div>
+                                    )}
                                     {(!msg.message_type || msg.message_type === 'text') && msg.content && (
                                         <div>{msg.content}</div>
                                     )}
+
+                                    {/* 表情回應 */}
+                                    {msg.reactions?.length > 0 && (
+                                        <div className="flex flex-wrap gap-1 mt-1 text-sm">
+                                            {msg.reactions.map(r => (
+                                                <button
+                                                    key={r.emoji}
+                                                    type="button"
+                                                    onClick={() => (r.reacted_by_me ? removeReaction : addReaction)(msg.id, r.emoji).catch(console.error)}
+                                                    className={`px-1 rounded ${r.reacted_by_me ? 'bg-blue-200 text-blue-800' : 'bg-gray-200 text-gray-700'}`}
+                                                >
+                                                    {r.emoji} {r.count}
+                                                </button>
+                                            ))}
+                                        </div>
+                                    )}
                                 </div>
                                 
                                 {/* 對方的訊息：時間在右邊 */}
                                 {!isMe && (
                                     <div className="text-xs md:text-sm text-gray-500 mb-1 whitespace-nowrap">
                                         {formatTime(msg.created_at || msg.timestamp)}
+                                        {msg.edited && ' 已編輯'}
                                     </div>
                                 )}
                             </div>
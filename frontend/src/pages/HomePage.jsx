@@ -73,7 +73,7 @@ export default function HomePage() {
       // console.log("Friends 資料:", friendsData.data);
       // console.log("Recent Chats 資料:", chatsData.data);
       setFriends(friendsData.data || []);
-      setRecentChats(chatsData.data || []);
+      setRecentChats([...(chatsData.data?.pinned || []), ...(chatsData.data?.conversations || [])]);
       setFriendRequests(requestsData.data || []);
       setUnreadCount(unreadData.data?.total || 0);
     } catch (error) {
@@ -191,14 +191,20 @@ export default function HomePage() {
               <ul className="divide-y divide-gray-200">
                 {recentChats.map((chat) => (
                   <li
-                    key={chat.friend.id}
+                    key={`${chat.type}-${chat.friend?.id ?? chat.room?.id}`}
                     className="py-3 px-4 hover:bg-gray-50 cursor-pointer rounded-md transition"
-                    onClick={() => navigate(`/chat/${chat.friend.id}`, { state: { friendName: chat.friend.display_name } })}
+                    onClick={() => chat.friend && navigate(`/chat/${chat.friend.id}`, { state: { friendName: chat.friend.display_name } })}
                   >
                     <div className="flex justify-between items-center">
                       <div>
-                        <div className="font-semibold">{chat.friend.display_name}</div>
-                        <div className="text-sm text-gray-600 truncate">{chat.last_message}</div>
+                        <div className="font-semibold">
+                          {chat.pinned && '📌 '}
+                          {chat.friend ? chat.friend.display_name : chat.room?.name}
+                          {chat.muted && ' 🔕'}
+                        </div>
+                        <div className="text-sm text-gray-600 truncate">
+                          {chat.draft ? <span className="text-red-500">[草稿] {chat.draft}</span> : chat.last_message}
+                        </div>
                       </div>
                       {chat.unread_count > 0 && (
                         <span className="bg-red-500 text-white text-xs px-2 py-1 rounded-full">